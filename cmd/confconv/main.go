@@ -0,0 +1,168 @@
+// confconv converts documents between jsonx, cso, yaml, toml, ini and xml formats.
+// Comments are kept if the target format supports them.
+//
+// Usage:
+//
+//	confconv [flags] [file]
+//
+// Formats are decided by flags -from and -to, or by suffixes of input file and
+// output file. Without file, it reads standard input.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/encoding/cso"
+	"github.com/mkideal/pkg/encoding/ini"
+	"github.com/mkideal/pkg/encoding/jsonx"
+	"github.com/mkideal/pkg/encoding/toml"
+	"github.com/mkideal/pkg/encoding/xmlx"
+	"github.com/mkideal/pkg/encoding/yaml"
+)
+
+var (
+	from   = flag.String("from", "", "input format: json, cso, yaml, toml, ini or xml")
+	to     = flag.String("to", "", "output format: json, cso, yaml, toml, ini or xml")
+	output = flag.String("o", "", "write result to file instead of stdout")
+	indent = flag.String("indent", "\t", "indent string of json")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: confconv [flags] [file]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() > 1 {
+		usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// formatOf returns format of file by suffix
+func formatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".jsonx":
+		return "json"
+	case ".cso":
+		return "cso"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".ini":
+		return "ini"
+	case ".xml":
+		return "xml"
+	}
+	return ""
+}
+
+func run(filename string) error {
+	var (
+		src []byte
+		err error
+	)
+	if filename == "" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+	inFormat, outFormat := *from, *to
+	if inFormat == "" {
+		inFormat = formatOf(filename)
+	}
+	if outFormat == "" {
+		outFormat = formatOf(*output)
+	}
+	if inFormat == "" || outFormat == "" {
+		return fmt.Errorf("unknown format, use -from and -to to specify formats")
+	}
+	doc, err := read(src, inFormat)
+	if err != nil {
+		if filename != "" {
+			err = fmt.Errorf("%s: %v", filename, err)
+		}
+		return err
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, doc, outFormat); err != nil {
+		return err
+	}
+	if *output != "" {
+		return ioutil.WriteFile(*output, buf.Bytes(), 0644)
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func read(src []byte, format string) (*encoding.Value, error) {
+	switch format {
+	case "json":
+		node, err := jsonx.ReadBytes(src, jsonx.WithComment(), jsonx.WithExtraComma())
+		if err != nil {
+			return nil, err
+		}
+		return jsonx.ToValue(node), nil
+	case "cso":
+		nodes, err := cso.ReadBytes(src)
+		if err != nil {
+			return nil, err
+		}
+		return cso.ToDocument(nodes), nil
+	case "yaml":
+		return yaml.ReadBytes(src)
+	case "toml":
+		return toml.ReadBytes(src)
+	case "ini":
+		return ini.ReadBytes(src)
+	case "xml":
+		return xmlx.ReadBytes(src)
+	}
+	return nil, fmt.Errorf("unsupported input format %q", format)
+}
+
+func write(w io.Writer, doc *encoding.Value, format string) error {
+	switch format {
+	case "json":
+		var buf bytes.Buffer
+		if err := jsonx.Write(&buf, jsonx.FromValue(doc), jsonx.WithComment(), jsonx.WithIndent(*indent)); err != nil {
+			return err
+		}
+		// format to align comments
+		res, err := jsonx.Format(buf.Bytes(), jsonx.WithIndent(*indent))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(res)
+		return err
+	case "cso":
+		return cso.WriteAll(w, cso.FromDocument(doc))
+	case "yaml":
+		return yaml.Write(w, doc)
+	case "toml":
+		return toml.Write(w, doc)
+	case "ini":
+		return ini.Write(w, doc)
+	case "xml":
+		return xmlx.Write(w, doc)
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
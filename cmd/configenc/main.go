@@ -0,0 +1,107 @@
+// configenc encrypts values of config, encrypted values prefixed by "enc:" are
+// decrypted by package config when config loaded.
+//
+// Usage:
+//
+//	configenc -genkey [-o keyfile]
+//	configenc [flags] [value...]
+//
+// Key is read from file of flag -key-file, or from environment variable
+// CONFIG_SECRET_KEY or the file named by CONFIG_SECRET_KEY_FILE. Without
+// values, it encrypts each line of standard input.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkideal/pkg/config"
+)
+
+var (
+	genkey  = flag.Bool("genkey", false, "generate a new key")
+	keyFile = flag.String("key-file", "", "file of base64 encoded key")
+	decrypt = flag.Bool("d", false, "decrypt values instead of encrypting")
+	output  = flag.String("o", "", "write generated key to file instead of stdout")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: configenc -genkey [-o keyfile]\n")
+	fmt.Fprintf(os.Stderr, "       configenc [flags] [value...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	var err error
+	if *genkey {
+		err = generateKey()
+	} else {
+		err = run(flag.Args())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func generateKey() error {
+	key, err := config.GenerateSecretKey()
+	if err != nil {
+		return err
+	}
+	text := config.EncodeSecretKey(key) + "\n"
+	if *output != "" {
+		// key file must be readable by owner only
+		return ioutil.WriteFile(*output, []byte(text), 0600)
+	}
+	_, err = os.Stdout.WriteString(text)
+	return err
+}
+
+func run(values []string) error {
+	var (
+		key []byte
+		err error
+	)
+	if *keyFile != "" {
+		key, err = config.ReadSecretKeyFile(*keyFile)
+	} else {
+		key, err = config.LoadSecretKey()
+	}
+	if err != nil {
+		return err
+	}
+	convert := func(value string) error {
+		var res string
+		if *decrypt {
+			res, err = config.DecryptValue(key, value)
+		} else {
+			res, err = config.EncryptValue(key, value)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(res)
+		return nil
+	}
+	if len(values) > 0 {
+		for _, value := range values {
+			if err := convert(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if err := convert(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,175 @@
+// csoconv converts CSV (or TSV) files exported from spreadsheets to CSO and back.
+//
+// Usage:
+//
+//	csoconv [flags] [file]
+//
+// Direction is decided by flag -to, or by suffix of file: .csv and .tsv files
+// are converted to CSO, other files to CSV. Without file, it reads standard input.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mkideal/pkg/encoding/cso"
+)
+
+var (
+	to         = flag.String("to", "", "output format: cso or csv")
+	output     = flag.String("o", "", "write result to file instead of stdout")
+	tsv        = flag.Bool("tsv", false, "use tab as field delimiter of CSV")
+	comma      = flag.String("comma", ",", "field delimiter of CSV")
+	header     = flag.Bool("header", false, "first line is table header")
+	quote      = flag.Bool("quote", false, "write strings quoted in CSV")
+	inferIdent = flag.Bool("ident", false, "keep identifiers in CSV as idents instead of strings")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: csoconv [flags] [file]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func run() error {
+	if flag.NArg() > 1 {
+		usage()
+		os.Exit(2)
+	}
+	var (
+		in       io.Reader = os.Stdin
+		filename           = "<standard input>"
+	)
+	if flag.NArg() == 1 {
+		filename = flag.Arg(0)
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	format := *to
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv", ".tsv":
+			format = "cso"
+		case ".cso":
+			format = "csv"
+		default:
+			return fmt.Errorf("%s: unknown format, use -to to specify output format", filename)
+		}
+	}
+	delim := ','
+	if *tsv || strings.ToLower(filepath.Ext(filename)) == ".tsv" {
+		delim = '\t'
+	} else if *comma != "," {
+		r, size := utf8.DecodeRuneInString(*comma)
+		if size == 0 || size != len(*comma) {
+			return fmt.Errorf("invalid delimiter %q", *comma)
+		}
+		delim = r
+	}
+
+	var opts []cso.CSVOption
+	if *header {
+		opts = append(opts, cso.WithHeader())
+	}
+	if *quote {
+		opts = append(opts, cso.WithQuoteStrings())
+	}
+	if *inferIdent {
+		opts = append(opts, cso.WithInferIdent())
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch format {
+	case "cso":
+		r := csv.NewReader(in)
+		r.Comma = delim
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		nodes, err := cso.FromCSV(records, opts...)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		return cso.WriteAll(out, nodes)
+	case "csv":
+		records, err := readCSO(in, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		w := csv.NewWriter(out)
+		w.Comma = delim
+		w.WriteAll(records)
+		return w.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func readCSO(in io.Reader, opts []cso.CSVOption) ([][]string, error) {
+	if !*header {
+		all, err := cso.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+		// skip empty lines
+		nodes := all[:0]
+		for _, node := range all {
+			if node.NumChild() > 0 {
+				nodes = append(nodes, node)
+			}
+		}
+		return cso.ToCSV(nodes, opts...)
+	}
+	t, err := cso.NewTableReader(in)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		columns = t.Columns()
+		head    = make([]string, len(columns))
+		nodes   []cso.Node
+	)
+	for i, c := range columns {
+		head[i] = c.String()
+	}
+	for t.Next() {
+		nodes = append(nodes, t.Row())
+	}
+	if err := t.Err(); err != nil {
+		return nil, err
+	}
+	records, err := cso.ToCSV(nodes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]string{head}, records...), nil
+}
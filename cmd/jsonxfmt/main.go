@@ -0,0 +1,141 @@
+// jsonxfmt formats json files which may contain comments, extra commas and unquoted keys.
+//
+// Usage:
+//
+//	jsonxfmt [flags] [path ...]
+//
+// Without paths, it formats standard input. Given a directory, it formats
+// all .json and .jsonx files in the directory recursively.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding/jsonx"
+)
+
+var (
+	list       = flag.Bool("l", false, "list files whose formatting differs from jsonxfmt's")
+	write      = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff     = flag.Bool("d", false, "display diffs instead of rewriting files")
+	sortKeys   = flag.Bool("s", false, "sort keys of objects")
+	indent     = flag.String("indent", "\t", "indent string")
+	unquoted   = flag.Bool("unquoted", false, "write keys unquoted if possible")
+	extraComma = flag.Bool("comma", false, "append extra comma to last member of objects and arrays")
+)
+
+var exitCode = 0
+
+func report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	exitCode = 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jsonxfmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	opts := []jsonx.Option{jsonx.WithIndent(*indent)}
+	if *sortKeys {
+		opts = append(opts, jsonx.WithSortKeys())
+	}
+	if *unquoted {
+		opts = append(opts, jsonx.WithUnquotedKey())
+	}
+	if *extraComma {
+		opts = append(opts, jsonx.WithExtraComma())
+	}
+
+	if flag.NArg() == 0 {
+		if *write {
+			report(fmt.Errorf("error: cannot use -w with standard input"))
+		} else if err := processFile("<standard input>", os.Stdin, opts); err != nil {
+			report(err)
+		}
+		os.Exit(exitCode)
+	}
+
+	for _, path := range flag.Args() {
+		switch info, err := os.Stat(path); {
+		case err != nil:
+			report(err)
+		case info.IsDir():
+			err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+				if err == nil && isJSONFile(info) {
+					err = processFile(path, nil, opts)
+				}
+				if err != nil {
+					report(err)
+				}
+				return nil
+			})
+			if err != nil {
+				report(err)
+			}
+		default:
+			if err := processFile(path, nil, opts); err != nil {
+				report(err)
+			}
+		}
+	}
+	os.Exit(exitCode)
+}
+
+func isJSONFile(info os.FileInfo) bool {
+	name := info.Name()
+	return !info.IsDir() && !strings.HasPrefix(name, ".") &&
+		(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".jsonx"))
+}
+
+func processFile(filename string, in *os.File, opts []jsonx.Option) error {
+	var (
+		src []byte
+		err error
+	)
+	if in != nil {
+		src, err = ioutil.ReadAll(in)
+	} else {
+		src, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+	res, err := jsonx.Format(src, opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if !*list && !*write && !*doDiff {
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if *list {
+		fmt.Println(filename)
+	}
+	if *write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if *doDiff {
+		fmt.Print(diff(filename+".orig", filename, src, res))
+	}
+	return nil
+}
@@ -1,23 +1,13 @@
 package config
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
-
-	"github.com/mkideal/pkg/encoding/jsonx"
-	"github.com/mkideal/pkg/netutil/httputil"
-)
-
-var (
-	errUnsupportedOutputFormat = errors.New("unsupported output format")
 )
 
 type Configurator interface {
@@ -31,10 +21,18 @@ type CommandLineConfigurator interface {
 
 // Config implements Configurator interface
 type Config struct {
-	// source of config, must be a filename or http URL
-	SourceOfConfig string `json:"-" xml:"-" cli:"config-source" usage:"source of config, filename or http URL"`
-	// output of config, exit process if non-empty
+	// source of config, a filename or URL supported by OpenSource
+	SourceOfConfig string `json:"-" xml:"-" cli:"config-source" usage:"source of config, filename or URL"`
+	// output of config, exit process if non-empty. Use Export or ExportFile
+	// to export config without exiting
 	OutputOfConfig string `json:"-" xml:"-" cli:"config-output" usage:"output of config, exit process if non-empty"`
+
+	// options of http source, e.g. auth, timeout and cache. URL of it is
+	// replaced by SourceOfConfig
+	HTTPSource *HTTPSource `json:"-" xml:"-" cli:"-"`
+
+	// flags bound by BindFlags override values loaded from source
+	flagSet *flag.FlagSet `json:"-" xml:"-" cli:"-"`
 }
 
 func filenameSuffix(filename, dft string) string {
@@ -44,87 +42,53 @@ func filenameSuffix(filename, dft string) string {
 	return dft
 }
 
+// openSource opens SourceOfConfig by OpenSource, options of http source are
+// copied from HTTPSource
+func (c *Config) openSource() (Source, error) {
+	if isHTTPSource(c.SourceOfConfig) && c.HTTPSource != nil {
+		source := *c.HTTPSource
+		source.URL = c.SourceOfConfig
+		return &source, nil
+	}
+	return OpenSource(c.SourceOfConfig)
+}
+
 func (c *Config) Init(conf interface{}) error {
 	if c.SourceOfConfig != "" {
-		var (
-			reader io.Reader
-			err    error
-			format = "json"
-		)
-		if strings.HasPrefix(c.SourceOfConfig, "http://") || strings.HasPrefix(c.SourceOfConfig, "https://") {
-			var resp *http.Response
-			resp, err = http.Get(c.SourceOfConfig)
-			if err == nil {
-				defer resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
-					reader = resp.Body
-				} else {
-					err = errors.New(resp.Status)
-				}
-			}
-			contentType := resp.Header.Get(httputil.HeaderContentType)
-			if strings.Contains(contentType, httputil.MIMEApplicationJSON) {
-				format = "json"
-			} else if strings.Contains(contentType, httputil.MIMEApplicationXML) {
-				format = "xml"
-			}
-		} else {
-			var file *os.File
-			file, err = os.Open(c.SourceOfConfig)
-			if err == nil {
-				defer file.Close()
-				reader = file
-			}
-			format = filenameSuffix(c.SourceOfConfig, format)
-		}
-		if reader != nil {
-			switch format {
-			case "json":
-				// using jsonx to support c++-style comments and extra comma at last element of object or array
-				err = jsonx.NewDecoder(reader, jsonx.WithComment(), jsonx.WithExtraComma()).Decode(conf)
-			case "xml":
-				err = xml.NewDecoder(reader).Decode(conf)
-			// TODO: case "ini", "toml", "yaml" ...
-			default:
-				err = errUnsupportedOutputFormat
+		source, err := c.openSource()
+		if err == nil {
+			var (
+				data   []byte
+				format *Format
+			)
+			if data, format, err = source.Load(context.Background()); err == nil {
+				err = format.Decode(bytes.NewReader(data), conf)
 			}
 		}
 		if err != nil {
 			return errors.New("read config from " + c.SourceOfConfig + ": " + err.Error())
 		}
 	}
+	flagSet := c.flagSet
+	if flagSet == nil {
+		flagSet = flag.CommandLine
+	}
+	if err := applyFlags(flagSet); err != nil {
+		return err
+	}
+	// encrypted values may be defaults, loaded from source or set by flags
+	if err := Decrypt(conf, nil); err != nil {
+		return err
+	}
+	if err := Validate(conf); err != nil {
+		return err
+	}
 	if c.OutputOfConfig != "" {
-		var (
-			format   = "json"
-			filename = c.OutputOfConfig
-			data     []byte
-			err      error
-		)
-		out := strings.Split(c.OutputOfConfig, ":")
-		if len(out) == 2 {
-			// json:xxx
-			if out[0] != "" {
-				format = out[0]
-			}
-			filename = out[1]
-		} else if len(out) == 1 {
-			// yyy.json
-			format = filenameSuffix(c.OutputOfConfig, format)
-		}
-		switch format {
-		case "json":
-			data, err = json.MarshalIndent(conf, "", "    ")
-		case "xml":
-			data, err = xml.MarshalIndent(conf, "", "    ")
-		default:
-			err = errUnsupportedOutputFormat
-		}
-		if err != nil {
-			return err
-		}
-		if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+		// use ExportFile to export config without exiting
+		if err := ExportFile(conf, c.OutputOfConfig); err != nil {
 			return err
 		}
+		_, filename := parseOutput(c.OutputOfConfig)
 		fmt.Printf("config output to file %s\n", filename)
 		os.Exit(2)
 	}
@@ -149,7 +113,15 @@ func (c *CommandLineConfig) Init(conf interface{}) error {
 	return c.Config.Init(conf)
 }
 
+// SetCommandLineFlags registers flags of source and output of config, flags of
+// fields bound by BindFlags on flagSet override values loaded from source
 func (c *CommandLineConfig) SetCommandLineFlags(flagSet *flag.FlagSet) {
-	flagSet.StringVar(&c.SourceOfConfig, c.sourceFlag, c.SourceOfConfig, "source of config, filename or http URL")
-	flagSet.StringVar(&c.OutputOfConfig, c.outputFlag, c.OutputOfConfig, "output of config, exit process if non-empty")
+	c.flagSet = flagSet
+	// flags may be registered by BindFlags already
+	if flagSet.Lookup(c.sourceFlag) == nil {
+		flagSet.StringVar(&c.SourceOfConfig, c.sourceFlag, c.SourceOfConfig, "source of config, filename or http URL")
+	}
+	if flagSet.Lookup(c.outputFlag) == nil {
+		flagSet.StringVar(&c.OutputOfConfig, c.outputFlag, c.OutputOfConfig, "output of config, exit process if non-empty")
+	}
 }
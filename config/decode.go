@@ -0,0 +1,333 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decodeValue decodes document v into conf which must be a pointer. Fields
+// are mapped by json names like json.Unmarshal, but scalars are converted by
+// type of target: numbers and bools are accepted by string fields as text,
+// strings are parsed by number and bool fields, and durations accept strings
+// like "5s" or nanoseconds, so documents of formats which infer types of
+// scalars like INI are decoded as expected.
+func decodeValue(v *encoding.Value, conf interface{}) error {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("config: decode into non-pointer %v", reflect.TypeOf(conf))
+	}
+	return decodeInto("", v, rv.Elem())
+}
+
+func decodeError(path string, v *encoding.Value, t reflect.Type, err error) error {
+	if path == "" {
+		path = "value"
+	}
+	msg := fmt.Sprintf("cannot decode %v into %v", v.Kind, t)
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	if v.Pos.Line > 0 {
+		return fmt.Errorf("%s: %s at %v", path, msg, v.Pos)
+	}
+	return fmt.Errorf("%s: %s", path, msg)
+}
+
+func decodeInto(path string, v *encoding.Value, rv reflect.Value) error {
+	if v.Kind == encoding.NullValue {
+		switch rv.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			rv.Set(reflect.Zero(rv.Type()))
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeInto(path, v, rv.Elem())
+	}
+	pt := reflect.PtrTo(rv.Type())
+	if v.Kind == encoding.StringValue && pt.Implements(textUnmarshalerType) {
+		if err := rv.Addr().Interface().(interface{ UnmarshalText([]byte) error }).UnmarshalText([]byte(v.String)); err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		return nil
+	}
+	if pt.Implements(jsonUnmarshalerType) || (rv.Kind() == reflect.Interface && rv.NumMethod() == 0) {
+		// values of interfaces are decoded by json, e.g. numbers are float64
+		data, err := json.Marshal(v.Interface())
+		if err == nil {
+			err = json.Unmarshal(data, rv.Addr().Interface())
+		}
+		if err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		return nil
+	}
+	if rv.Type() == durationType {
+		d, err := decodeDuration(v)
+		if err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		rv.SetInt(int64(d))
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		switch v.Kind {
+		case encoding.StringValue, encoding.BoolValue, encoding.IntValue, encoding.FloatValue:
+			rv.SetString(v.Text())
+			return nil
+		}
+	case reflect.Bool:
+		switch v.Kind {
+		case encoding.BoolValue:
+			rv.SetBool(v.Bool)
+			return nil
+		case encoding.StringValue:
+			b, err := strconv.ParseBool(strings.TrimSpace(v.String))
+			if err != nil {
+				return decodeError(path, v, rv.Type(), err)
+			}
+			rv.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok, err := decodeInt(v)
+		if err == nil && ok && rv.OverflowInt(i) {
+			err = fmt.Errorf("%d overflows", i)
+		}
+		if err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		if ok {
+			rv.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok, err := decodeInt(v)
+		if err == nil && ok && (i < 0 || rv.OverflowUint(uint64(i))) {
+			err = fmt.Errorf("%d overflows", i)
+		}
+		if err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		if ok {
+			rv.SetUint(uint64(i))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		var (
+			f   float64
+			err error
+		)
+		switch v.Kind {
+		case encoding.IntValue:
+			f = float64(v.Int)
+		case encoding.FloatValue:
+			f = v.Float
+		case encoding.StringValue:
+			f, err = strconv.ParseFloat(strings.TrimSpace(v.String), rv.Type().Bits())
+		default:
+			return decodeError(path, v, rv.Type(), nil)
+		}
+		if err == nil && rv.OverflowFloat(f) {
+			err = fmt.Errorf("%v overflows", f)
+		}
+		if err != nil {
+			return decodeError(path, v, rv.Type(), err)
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && v.Kind == encoding.StringValue {
+			// bytes are base64 encoded as json
+			b, err := base64.StdEncoding.DecodeString(v.String)
+			if err != nil {
+				return decodeError(path, v, rv.Type(), err)
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+		if v.Kind == encoding.ArrayValue {
+			s := reflect.MakeSlice(rv.Type(), len(v.Elems), len(v.Elems))
+			for i, elem := range v.Elems {
+				if err := decodeInto(joinFieldPath(path, strconv.Itoa(i)), elem, s.Index(i)); err != nil {
+					return err
+				}
+			}
+			rv.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if v.Kind == encoding.ArrayValue {
+			for i := 0; i < rv.Len(); i++ {
+				if i < len(v.Elems) {
+					if err := decodeInto(joinFieldPath(path, strconv.Itoa(i)), v.Elems[i], rv.Index(i)); err != nil {
+						return err
+					}
+				} else {
+					rv.Index(i).Set(reflect.Zero(rv.Type().Elem()))
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if v.Kind == encoding.ObjectValue {
+			if rv.IsNil() {
+				rv.Set(reflect.MakeMap(rv.Type()))
+			}
+			for _, f := range v.Fields {
+				fpath := joinFieldPath(path, f.Key)
+				key := reflect.New(rv.Type().Key()).Elem()
+				if err := decodeInto(fpath, encoding.NewString(f.Key), key); err != nil {
+					return err
+				}
+				elem := reflect.New(rv.Type().Elem()).Elem()
+				if old := rv.MapIndex(key); old.IsValid() {
+					elem.Set(old)
+				}
+				if err := decodeInto(fpath, f.Value, elem); err != nil {
+					return err
+				}
+				rv.SetMapIndex(key, elem)
+			}
+			return nil
+		}
+	case reflect.Struct:
+		if v.Kind == encoding.ObjectValue {
+			return decodeStruct(path, v, rv)
+		}
+	}
+	return decodeError(path, v, rv.Type(), nil)
+}
+
+// decodeInt converts v to integer, ok is false if v is not a number or string
+func decodeInt(v *encoding.Value) (i int64, ok bool, err error) {
+	switch v.Kind {
+	case encoding.IntValue:
+		return v.Int, true, nil
+	case encoding.FloatValue:
+		if v.Float != math.Trunc(v.Float) || v.Float < math.MinInt64 || v.Float >= math.MaxInt64 {
+			return 0, true, fmt.Errorf("%v is not an integer", v.Float)
+		}
+		return int64(v.Float), true, nil
+	case encoding.StringValue:
+		i, err := strconv.ParseInt(strings.TrimSpace(v.String), 10, 64)
+		return i, true, err
+	}
+	return 0, false, nil
+}
+
+// decodeDuration converts v to duration, numbers are nanoseconds
+func decodeDuration(v *encoding.Value) (time.Duration, error) {
+	if v.Kind == encoding.StringValue {
+		text := strings.TrimSpace(v.String)
+		if d, err := time.ParseDuration(text); err == nil {
+			return d, nil
+		}
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", v.String)
+		}
+		return time.Duration(i), nil
+	}
+	i, ok, err := decodeInt(v)
+	if !ok {
+		return 0, fmt.Errorf("invalid duration")
+	}
+	return time.Duration(i), err
+}
+
+// decodeStruct decodes fields of object v into struct rv, keys are matched
+// to json names of fields case-insensitively, unknown keys are ignored
+func decodeStruct(path string, v *encoding.Value, rv reflect.Value) error {
+	fields := jsonFields(rv.Type())
+	for _, f := range v.Fields {
+		index, ok := fields[f.Key]
+		if !ok {
+			index, ok = fields[strings.ToLower(f.Key)]
+		}
+		if !ok {
+			continue
+		}
+		fv, err := fieldByIndex(rv, index)
+		if err != nil {
+			return fmt.Errorf("%s: %v", joinFieldPath(path, f.Key), err)
+		}
+		if err := decodeInto(joinFieldPath(path, f.Key), f.Value, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns field of index, nil pointers to embedded structs are
+// allocated
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// jsonFields returns indexes of fields of struct type t by json names and
+// lower case json names, fields of embedded structs are promoted unless
+// shadowed by fields of outer structs
+func jsonFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	depths := make(map[string]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			fi := append(append([]int(nil), index...), i)
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, fi)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			for _, key := range []string{name, strings.ToLower(name)} {
+				if d, ok := depths[key]; !ok || len(fi) < d {
+					fields[key], depths[key] = fi, len(fi)
+				}
+			}
+		}
+	}
+	walk(t, nil)
+	return fields
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/encoding/jsonx"
+)
+
+// Export encodes conf by format which is a name or filename suffix of
+// registered format, fields tagged by secret:"true" are redacted
+func Export(conf interface{}, format string) ([]byte, error) {
+	f := LookupFormat(format)
+	if f == nil {
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+	return f.Encode(Redact(conf))
+}
+
+// ExportFile exports conf to output which is a filename like foo.yaml, or
+// format and filename separated by colon like yaml:foo.conf. Default format
+// is json.
+func ExportFile(conf interface{}, output string) error {
+	format, filename := parseOutput(output)
+	data, err := Export(conf, format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
+
+// parseOutput parses output of ExportFile to format and filename
+func parseOutput(output string) (format, filename string) {
+	if i := strings.Index(output, ":"); i >= 0 {
+		format = "json"
+		if i > 0 {
+			format = output[:i]
+		}
+		return format, output[i+1:]
+	}
+	return filenameSuffix(output, "json"), output
+}
+
+// Template generates a sample config of jsonx format from conf which is a
+// pointer to struct with defaults. Each field is documented by comments of its
+// usage tag, type and rules of validate tag, e.g.
+//
+//	{
+//		// address of server
+//		// type: string, validate: required
+//		"addr": ":8080",
+//	}
+//
+// Nil pointers to structs are expanded so all fields are documented, except
+// pointers to structs already being expanded, e.g. Next of
+// type Node struct{ Next *Node }, which are left null. Fields tagged by
+// secret:"true" are redacted.
+func Template(conf interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: Template(non-pointer to struct %v)", reflect.TypeOf(conf))
+	}
+	redacted := reflect.ValueOf(Redact(conf))
+	expandStructs(redacted.Elem(), make(map[reflect.Type]bool))
+	doc, err := valueOf(redacted.Interface())
+	if err != nil {
+		return nil, err
+	}
+	documentFields(doc, rv.Elem().Type(), make(map[reflect.Type]bool))
+
+	var buf bytes.Buffer
+	if err := jsonx.Write(&buf, jsonx.FromValue(doc), jsonx.WithComment(), jsonx.WithIndent("\t")); err != nil {
+		return nil, err
+	}
+	return jsonx.Format(buf.Bytes(), jsonx.WithIndent("\t"))
+}
+
+// expandStructs allocates nil pointers to structs in struct v recursively,
+// struct types in visiting are on the current path and not expanded again
+func expandStructs(v reflect.Value, visiting map[reflect.Type]bool) {
+	t := v.Type()
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr && !isLeaf(sf.Type) {
+			if fv.IsNil() {
+				if !fv.CanSet() || visiting[sf.Type.Elem()] {
+					continue
+				}
+				fv.Set(reflect.New(sf.Type.Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && !isLeaf(fv.Type()) && !visiting[fv.Type()] {
+			expandStructs(fv, visiting)
+		}
+	}
+}
+
+// documentFields sets comments of fields of object v by fields of struct type
+// t, struct types in visiting are on the current path and not documented again
+func documentFields(v *encoding.Value, t reflect.Type, visiting map[reflect.Type]bool) {
+	if v == nil || v.Kind != encoding.ObjectValue || visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			documentFields(v, ft, visiting)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fv := v.Get(name)
+		if fv == nil {
+			continue
+		}
+		if usage := sf.Tag.Get("usage"); usage != "" {
+			fv.Doc = append(fv.Doc, usage)
+		}
+		desc := "type: " + typeName(sf.Type)
+		if rules := sf.Tag.Get("validate"); rules != "" {
+			desc += ", validate: " + rules
+		}
+		if isSecret(sf) {
+			desc += ", secret"
+		}
+		fv.Doc = append(fv.Doc, desc)
+		if !isLeaf(sf.Type) {
+			documentFields(fv, ft, visiting)
+		}
+	}
+}
+
+// typeName returns name of type t shown in template
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration in nanoseconds"
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return "base64 string"
+		}
+		return "array of " + typeName(t.Elem())
+	case reflect.Map:
+		return "object of " + typeName(t.Elem())
+	case reflect.Struct:
+		return "object"
+	case reflect.Interface:
+		return "any"
+	}
+	return t.Kind().String()
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkideal/pkg/encoding/jsonx"
+)
+
+type exportDB struct {
+	Host     string `json:"host" usage:"host of database" validate:"required"`
+	Password string `json:"password" secret:"true"`
+}
+
+type exportConfig struct {
+	Config
+	Addr    string        `json:"addr" usage:"address of server"`
+	Timeout time.Duration `json:"timeout"`
+	Tags    []string      `json:"tags"`
+	DB      *exportDB     `json:"db"`
+}
+
+func TestExport(t *testing.T) {
+	conf := &exportConfig{Addr: ":8080", DB: &exportDB{Host: "localhost", Password: "pass"}}
+	data, err := Export(conf, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); !strings.Contains(s, "localhost") || strings.Contains(s, "pass\n") {
+		t.Errorf("unexpected exported yaml:\n%s", s)
+	}
+	if _, err := Export(conf, "unknown"); err == nil {
+		t.Errorf("want error of unsupported format, but got nil")
+	}
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.conf")
+	if err := ExportFile(conf, "json:"+filename); err != nil {
+		t.Fatal(err)
+	}
+	var loaded exportConfig
+	if err := NewLoader(WithFiles(filename + ".json")).Load(&loaded); err == nil {
+		t.Errorf("want error of missing file, but got nil")
+	}
+	os.Rename(filename, filename+".json")
+	if err := NewLoader(WithFiles(filename + ".json")).Load(&loaded); err != nil || loaded.Addr != ":8080" || loaded.DB.Password != RedactedText {
+		t.Errorf("unexpected loaded config %+v, error %v", loaded, err)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	data, err := Template(&exportConfig{Addr: ":8080", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	// address of server
+	// type: string
+	"addr": ":8080",
+	// type: duration in nanoseconds
+	"timeout": 1000000000,
+	// type: array of string
+	"tags": null,
+	// type: object
+	"db": {
+		// host of database
+		// type: string, validate: required
+		"host": "",
+		// type: string, secret
+		"password": ""
+	}
+}`
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("want template:\n%s\nbut got:\n%s", want, got)
+	}
+	if _, err := jsonx.ReadBytes(data, jsonx.WithComment()); err != nil {
+		t.Errorf("template can't be read: %v", err)
+	}
+}
+
+type templateNode struct {
+	Name string        `json:"name"`
+	Next *templateNode `json:"next"`
+}
+
+func TestTemplateRecursive(t *testing.T) {
+	data, err := Template(&templateNode{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	// type: string
+	"name": "a",
+	// type: object
+	"next": null
+}`
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("want template:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	for i, ts := range []struct {
+		output, format, filename string
+	}{
+		{"app.yaml", "yaml", "app.yaml"},
+		{"app", "json", "app"},
+		{"yaml:out.conf", "yaml", "out.conf"},
+		{":out.conf", "json", "out.conf"},
+	} {
+		if format, filename := parseOutput(ts.output); format != ts.format || filename != ts.filename {
+			t.Errorf("%dth: want %s and %s, but got %s and %s", i, ts.format, ts.filename, format, filename)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkideal/pkg/textutil/namemapper"
+)
+
+// BindFlags registers a flag on flagSet for every field of conf which must be
+// a pointer to struct. Name of flag is the first name of cli tag, or converted
+// from field name, e.g. MaxConns to max-conns. Usage of flag is usage tag.
+// Fields of nested structs are prefixed by name of struct field and a dot,
+// e.g. -db.max-conns.
+//
+// Supported types are strings, bools, numbers, time.Duration, types which
+// implement encoding.TextUnmarshaler, pointers to them and slices of them.
+// Values of slices are separated by comma and repeated flags are appended.
+// Values of other types like maps, slices of structs and interfaces are json,
+// e.g. -labels '{"env":"prod"}', fields of types which can't be json like
+// channels and functions are skipped.
+//
+// Default values of fields tagged by secret:"true" are not shown in usage.
+//
+// Fields tagged by cli:"-" are skipped, so are fields tagged by json:"-"
+// without cli tag. Flags already defined in flagSet are skipped too.
+//
+// Flags override values loaded from source by Init of Config and Loader.
+func BindFlags(flagSet *flag.FlagSet, conf interface{}) error {
+	v := reflect.ValueOf(conf)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: BindFlags(non-pointer to struct %v)", reflect.TypeOf(conf))
+	}
+	return bindFlags(flagSet, v.Elem(), v.Elem().Type(), nil, "", make(map[reflect.Type]bool))
+}
+
+// bindFlags binds fields of struct type t which are reached by index from
+// root. Nil pointers to structs are not allocated until flags set, and struct
+// types already on the path are skipped, e.g. Next of type Node struct{ Next *Node }.
+func bindFlags(flagSet *flag.FlagSet, root reflect.Value, t reflect.Type, index []int, prefix string, visiting map[reflect.Type]bool) error {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		cli := sf.Tag.Get("cli")
+		if cli == "-" || (cli == "" && sf.Tag.Get("json") == "-") {
+			continue
+		}
+		fi := append(append([]int(nil), index...), i)
+		if sf.Anonymous && cli == "" && sf.Type.Kind() == reflect.Struct {
+			if err := bindFlags(flagSet, root, sf.Type, fi, prefix, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		names := flagNames(sf)
+		value := &fieldValue{root: root, index: fi, typ: sf.Type, secret: isSecret(sf)}
+		if !isFlagType(sf.Type) {
+			if isLeaf(sf.Type) {
+				if !isJSONType(sf.Type) {
+					continue
+				}
+				value.json = true
+				bindFlag(flagSet, value, prefix, names, sf.Tag.Get("usage"))
+				continue
+			}
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if err := bindFlags(flagSet, root, ft, fi, prefix+names[0]+".", visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		bindFlag(flagSet, value, prefix, names, sf.Tag.Get("usage"))
+	}
+	return nil
+}
+
+func bindFlag(flagSet *flag.FlagSet, value *fieldValue, prefix string, names []string, usage string) {
+	for _, name := range names {
+		if flagSet.Lookup(prefix+name) == nil {
+			flagSet.Var(value, prefix+name, usage)
+		}
+	}
+}
+
+// flagNames returns names of cli tag, e.g. "p,port" or "-p, --port", or name
+// converted from field name
+func flagNames(sf reflect.StructField) []string {
+	var names []string
+	for _, name := range strings.Split(sf.Tag.Get("cli"), ",") {
+		// marks of required and other options of cli tag
+		name = strings.TrimLeft(strings.TrimSpace(name), "*!-")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, strings.Replace(namemapper.UnderScore(sf.Name), "_", "-", -1))
+	}
+	return names
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// isFlagType reports whether values of type t can be set by flags
+func isFlagType(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isJSONType reports whether values of type t can be json
+func isJSONType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		if t.Kind() == reflect.Map && t.Key().Kind() != reflect.String && !isFlagType(t.Key()) {
+			return false
+		}
+		return isJSONType(t.Elem())
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// fieldValue implements flag.Value which sets a field of config
+type fieldValue struct {
+	root   reflect.Value // struct passed to BindFlags
+	index  []int         // index of field in root
+	typ    reflect.Type  // type of field
+	texts  []string      // texts of Set called, used to set field again
+	secret bool          // value of secret field is hidden from usage
+	json   bool          // value is json
+}
+
+// field returns the bound field, nil pointers to structs on the path are
+// allocated if alloc is true, or an invalid value returned
+func (f *fieldValue) field(alloc bool) reflect.Value {
+	v := f.root
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (f *fieldValue) String() string {
+	if f.secret {
+		return ""
+	}
+	v := f.field(false)
+	if !v.IsValid() {
+		return ""
+	}
+	if f.json {
+		if isZero(v) {
+			return ""
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	if v.Kind() == reflect.Slice {
+		texts := make([]string, v.Len())
+		for i := range texts {
+			texts[i] = formatFlag(v.Index(i))
+		}
+		return strings.Join(texts, ",")
+	}
+	return formatFlag(v)
+}
+
+func (f *fieldValue) Set(text string) error {
+	v := f.field(true)
+	if f.json {
+		// repeated flags replace value
+		p := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(text), p.Interface()); err != nil {
+			return err
+		}
+		v.Set(p.Elem())
+	} else if v.Kind() == reflect.Slice {
+		if len(f.texts) == 0 {
+			// the first flag replaces default value
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		if text != "" {
+			for _, s := range strings.Split(text, ",") {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setFlag(elem, strings.TrimSpace(s)); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, elem))
+			}
+		}
+	} else if err := setFlag(v, text); err != nil {
+		return err
+	}
+	f.texts = append(f.texts, text)
+	return nil
+}
+
+func (f *fieldValue) IsBoolFlag() bool {
+	t := f.typ
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
+
+// text returns text of flags set, texts of repeated slice flags are joined
+func (f *fieldValue) text() string {
+	if len(f.texts) == 0 {
+		return f.String()
+	}
+	if f.typ.Kind() == reflect.Slice && !f.json {
+		return strings.Join(f.texts, ",")
+	}
+	return f.texts[len(f.texts)-1]
+}
+
+// apply sets field again by texts of flags
+func (f *fieldValue) apply() error {
+	texts := f.texts
+	f.texts = nil
+	for _, text := range texts {
+		if err := f.Set(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFlag(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(interface{ MarshalText() ([]byte, error) }); ok {
+		text, err := m.MarshalText()
+		if err == nil {
+			return string(text)
+		}
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func setFlag(v reflect.Value, text string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if u, ok := v.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(text, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// applyFlags sets fields bound by BindFlags again by flags set in flagSet, so
+// that flags override values loaded from source
+func applyFlags(flagSet *flag.FlagSet) error {
+	var err error
+	flagSet.Visit(func(fl *flag.Flag) {
+		if fv, ok := fl.Value.(*fieldValue); ok && err == nil {
+			if err = fv.apply(); err != nil {
+				err = fmt.Errorf("flag -%s: %v", fl.Name, err)
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type flagsConfig struct {
+	CommandLineConfig
+	Name    string        `json:"name" cli:"n,name" usage:"name of app"`
+	Port    int           `json:"port"`
+	Debug   bool          `json:"debug"`
+	Timeout time.Duration `json:"timeout"`
+	Hosts   []string      `json:"hosts"`
+	DB      struct {
+		MaxConns int `json:"max_conns"`
+	} `json:"db" cli:"database"`
+}
+
+func TestBindFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.json")
+	ioutil.WriteFile(filename, []byte(`{"name":"file","port":80,"timeout":1000,"hosts":["x"],"db":{"max_conns":5}}`), 0644)
+
+	var conf flagsConfig
+	conf.CommandLineConfig = *NewCommandLineConfig("config-source", "config-output")
+	conf.Hosts = []string{"default"}
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := BindFlags(flagSet, &conf); err != nil {
+		t.Fatalf("BindFlags error: %v", err)
+	}
+	conf.SetCommandLineFlags(flagSet)
+	for _, name := range []string{"n", "name", "port", "debug", "timeout", "hosts", "database.max-conns", "config-source", "config-output"} {
+		if flagSet.Lookup(name) == nil {
+			t.Errorf("flag %s not found", name)
+		}
+	}
+	if usage := flagSet.Lookup("name").Usage; usage != "name of app" {
+		t.Errorf("want usage of name, but got %q", usage)
+	}
+	args := []string{"-config-source", filename, "-n", "flag", "-debug", "-timeout", "2s", "-hosts", "a,b", "-hosts", "c", "-database.max-conns", "10"}
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if err := conf.Init(&conf); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+	want := conf
+	want.Name = "flag"
+	want.Port = 80
+	want.Debug = true
+	want.Timeout = 2 * time.Second
+	want.Hosts = []string{"a", "b", "c"}
+	want.DB.MaxConns = 10
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("want %+v, but got %+v", want, conf)
+	}
+
+	// loader takes flags as the last layer
+	var loaded flagsConfig
+	l := NewLoader(WithFiles(filename), WithFlagSet(flagSet))
+	if err := l.Load(&loaded); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if conf := loaded; conf.Name != "flag" || conf.Port != 80 || conf.Timeout != 2*time.Second || l.Source("db.max_conns") != "flag:database.max-conns" {
+		t.Errorf("unexpected config %+v loaded from %v", conf, l.Sources())
+	}
+}
+
+func TestBindJSONFlags(t *testing.T) {
+	type server struct {
+		Addr string `json:"addr"`
+	}
+	var conf struct {
+		Labels  map[string]string `json:"labels"`
+		Servers []server          `json:"servers"`
+		Backups []*server         `json:"backups"`
+		Extra   interface{}       `json:"extra"`
+		Notify  chan int          `json:"-" cli:"notify"`
+	}
+	conf.Labels = map[string]string{"env": "dev"}
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	if err := BindFlags(flagSet, &conf); err != nil {
+		t.Fatalf("BindFlags error: %v", err)
+	}
+	if flagSet.Lookup("notify") != nil {
+		t.Errorf("want flag of channel skipped")
+	}
+	if fl := flagSet.Lookup("labels"); fl == nil || fl.DefValue != `{"env":"dev"}` {
+		t.Errorf("want default value of labels as json, but got %+v", fl)
+	}
+	args := []string{
+		"-labels", `{"env":"prod","zone":"a"}`,
+		"-servers", `[{"addr":":1"},{"addr":":2"}]`,
+		"-backups", `[{"addr":":3"}]`,
+		"-extra", `[1,"x"]`,
+	}
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if !reflect.DeepEqual(conf.Labels, map[string]string{"env": "prod", "zone": "a"}) {
+		t.Errorf("unexpected labels %v", conf.Labels)
+	}
+	if !reflect.DeepEqual(conf.Servers, []server{{":1"}, {":2"}}) {
+		t.Errorf("unexpected servers %v", conf.Servers)
+	}
+	if len(conf.Backups) != 1 || conf.Backups[0].Addr != ":3" {
+		t.Errorf("unexpected backups %v", conf.Backups)
+	}
+	if !reflect.DeepEqual(conf.Extra, []interface{}{1.0, "x"}) {
+		t.Errorf("unexpected extra %v", conf.Extra)
+	}
+	if err := flagSet.Parse([]string{"-labels", "{"}); err == nil {
+		t.Errorf("want error of invalid json")
+	}
+}
+
+type flagsNode struct {
+	Name string     `json:"name"`
+	Next *flagsNode `json:"next"`
+	Sub  *struct {
+		Port int `json:"port"`
+	} `json:"sub"`
+	Opt *struct {
+		Debug bool `json:"debug"`
+	} `json:"opt"`
+}
+
+func TestBindPointerFlags(t *testing.T) {
+	var conf flagsNode
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	if err := BindFlags(flagSet, &conf); err != nil {
+		t.Fatalf("BindFlags error: %v", err)
+	}
+	if conf.Sub != nil || conf.Opt != nil || conf.Next != nil {
+		t.Errorf("want nil pointers not allocated by BindFlags, but got %+v", conf)
+	}
+	if flagSet.Lookup("next.name") != nil {
+		t.Errorf("want recursive struct skipped")
+	}
+	for _, name := range []string{"name", "sub.port", "opt.debug"} {
+		if flagSet.Lookup(name) == nil {
+			t.Errorf("flag %s not found", name)
+		}
+	}
+	if err := flagSet.Parse([]string{"-sub.port", "80"}); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if conf.Sub == nil || conf.Sub.Port != 80 {
+		t.Errorf("want sub allocated by flag, but got %+v", conf.Sub)
+	}
+	if conf.Opt != nil {
+		t.Errorf("want opt not allocated, but got %+v", conf.Opt)
+	}
+}
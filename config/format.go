@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/encoding/ini"
+	"github.com/mkideal/pkg/encoding/jsonx"
+	"github.com/mkideal/pkg/encoding/toml"
+	"github.com/mkideal/pkg/encoding/xmlx"
+	"github.com/mkideal/pkg/encoding/yaml"
+	"github.com/mkideal/pkg/netutil/httputil"
+)
+
+// Format represents a format of config which decodes config from source
+// and encodes config to output
+type Format struct {
+	Name      string   // name of format, e.g. yaml
+	Suffixes  []string // filename suffixes without dot, e.g. yaml, yml
+	MIMETypes []string // content types of http sources, e.g. application/x-yaml
+	Decode    func(r io.Reader, conf interface{}) error
+	Encode    func(conf interface{}) ([]byte, error)
+	// Read reads config as a format-neutral document, it's required by Loader
+	// which merges documents of layers. Fields of document are mapped to config
+	// by json names.
+	Read func(r io.Reader) (*encoding.Value, error)
+}
+
+var (
+	formatsMu       sync.RWMutex
+	formatsByName   = map[string]*Format{}
+	formatsBySuffix = map[string]*Format{}
+	formatsByMIME   = map[string]*Format{}
+)
+
+// RegisterFormat registers format by name, suffixes and MIME types. Formats
+// registered before with same name, suffix or MIME type are replaced.
+func RegisterFormat(format *Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formatsByName[strings.ToLower(format.Name)] = format
+	for _, suffix := range format.Suffixes {
+		formatsBySuffix[strings.ToLower(suffix)] = format
+	}
+	for _, typ := range format.MIMETypes {
+		formatsByMIME[strings.ToLower(typ)] = format
+	}
+}
+
+// LookupFormat finds format by name or filename suffix, nil returned if not found
+func LookupFormat(name string) *Format {
+	name = strings.ToLower(name)
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	if format, ok := formatsByName[name]; ok {
+		return format
+	}
+	return formatsBySuffix[name]
+}
+
+// LookupFormatByMIME finds format by content type, parameters such as charset
+// are ignored. nil returned if not found.
+func LookupFormatByMIME(contentType string) *Format {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return formatsByMIME[typ]
+}
+
+// documentFormat creates a format which reads and writes config as
+// format-neutral documents, config is decoded from documents by json names with
+// conversion of scalars, see decodeValue, and encoded to documents via json
+func documentFormat(name string, suffixes, mimeTypes []string,
+	read func(io.Reader) (*encoding.Value, error),
+	write func(io.Writer, *encoding.Value) error,
+) *Format {
+	return &Format{
+		Name:      name,
+		Suffixes:  suffixes,
+		MIMETypes: mimeTypes,
+		Read:      read,
+		Decode: func(r io.Reader, conf interface{}) error {
+			doc, err := read(r)
+			if err != nil {
+				return err
+			}
+			return decodeValue(doc, conf)
+		},
+		Encode: func(conf interface{}) ([]byte, error) {
+			v, err := valueOf(conf)
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := write(&buf, v); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+	}
+}
+
+// readXML reads XML document whose root element contains fields of config,
+// name of root element is ignored
+func readXML(r io.Reader) (*encoding.Value, error) {
+	doc, err := xmlx.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Fields) == 1 && doc.Fields[0].Value.Kind == encoding.ObjectValue {
+		return doc.Fields[0].Value, nil
+	}
+	return doc, nil
+}
+
+// writeXML writes fields of config in root element <config>
+func writeXML(w io.Writer, v *encoding.Value) error {
+	doc := encoding.NewObject()
+	doc.Set("config", v)
+	return xmlx.Write(w, doc)
+}
+
+func init() {
+	RegisterFormat(&Format{
+		Name:      "json",
+		Suffixes:  []string{"json"},
+		MIMETypes: []string{httputil.MIMEApplicationJSON, "text/json"},
+		Decode: func(r io.Reader, conf interface{}) error {
+			// using jsonx to support c++-style comments and extra comma at last element of object or array
+			return jsonx.NewDecoder(r, jsonx.WithComment(), jsonx.WithExtraComma()).Decode(conf)
+		},
+		Encode: func(conf interface{}) ([]byte, error) {
+			return json.MarshalIndent(conf, "", "    ")
+		},
+		Read: func(r io.Reader) (*encoding.Value, error) {
+			node, err := jsonx.Read(r, jsonx.WithComment(), jsonx.WithExtraComma())
+			if err != nil {
+				return nil, err
+			}
+			return jsonx.ToValue(node), nil
+		},
+	})
+	RegisterFormat(documentFormat("xml",
+		[]string{"xml"},
+		[]string{httputil.MIMEApplicationXML, "text/xml"},
+		readXML, writeXML,
+	))
+	RegisterFormat(documentFormat("yaml",
+		[]string{"yaml", "yml"},
+		[]string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+		yaml.Read, yaml.Write,
+	))
+	RegisterFormat(documentFormat("toml",
+		[]string{"toml"},
+		[]string{"application/toml", "text/toml"},
+		toml.Read, toml.Write,
+	))
+	RegisterFormat(documentFormat("ini",
+		[]string{"ini"},
+		[]string{"text/x-ini"},
+		ini.Read, ini.Write,
+	))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Config
+	Name  string   `json:"name"`
+	Port  int      `json:"port"`
+	Debug bool     `json:"debug"`
+	Hosts []string `json:"hosts"`
+	DB    struct {
+		Host string `json:"host"`
+	} `json:"db"`
+}
+
+func TestFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var want testConfig
+	want.Name = "app"
+	want.Port = 8080
+	want.Debug = true
+	want.Hosts = []string{"a", "b"}
+	want.DB.Host = "localhost"
+
+	for i, ts := range []struct {
+		filename string
+		content  string
+	}{
+		{"app.json", `{"name":"app","port":8080,"debug":true,"hosts":["a","b"],"db":{"host":"localhost"},}`},
+		{"app.yml", "name: app\nport: 8080\ndebug: true\nhosts: [a, b]\ndb:\n  host: localhost\n"},
+		{"app.toml", "name = \"app\"\nport = 8080\ndebug = true\nhosts = [\"a\", \"b\"]\n[db]\nhost = \"localhost\"\n"},
+		{"app.ini", "name = app\nport = 8080\ndebug = true\nhosts[] = a\nhosts[] = b\n[db]\nhost = localhost\n"},
+	} {
+		filename := filepath.Join(dir, ts.filename)
+		if err := ioutil.WriteFile(filename, []byte(ts.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var got testConfig
+		got.SourceOfConfig = filename
+		if err := got.Init(&got); err != nil {
+			t.Errorf("%dth: Init error: %v", i, err)
+			continue
+		}
+		got.Config = want.Config
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%dth: want %+v, but got %+v", i, want, got)
+			continue
+		}
+
+		// encode then decode
+		format := LookupFormat(filepath.Ext(ts.filename)[1:])
+		data, err := format.Encode(&want)
+		if err != nil {
+			t.Errorf("%dth: Encode error: %v", i, err)
+			continue
+		}
+		var decoded testConfig
+		if err := format.Decode(bytes.NewReader(data), &decoded); err != nil {
+			t.Errorf("%dth: Decode error: %v\n%s", i, err, data)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, want) {
+			t.Errorf("%dth: want %+v, but got %+v", i, want, decoded)
+		}
+	}
+
+	if LookupFormatByMIME("application/x-yaml; charset=utf-8") != LookupFormat("yaml") {
+		t.Errorf("want yaml format of application/x-yaml")
+	}
+	if LookupFormat("unknown") != nil {
+		t.Errorf("want nil format of unknown")
+	}
+}
+
+func TestFormatDecodeScalars(t *testing.T) {
+	type decodeConfig struct {
+		Password string        `json:"password"`
+		Zip      string        `json:"zip"`
+		Enabled  string        `json:"enabled"`
+		Port     int           `json:"port"`
+		Timeout  time.Duration `json:"timeout"`
+		Interval time.Duration `json:"interval"`
+		Ratio    float64       `json:"ratio"`
+	}
+	want := decodeConfig{
+		Password: "123456",
+		Zip:      "08080",
+		Enabled:  "true",
+		Port:     8080,
+		Timeout:  5 * time.Second,
+		Interval: 1000,
+		Ratio:    0.5,
+	}
+	for i, ts := range []struct {
+		format  string
+		content string
+	}{
+		{"yaml", "password: 123456\nzip: \"08080\"\nenabled: true\nport: \"8080\"\ntimeout: 5s\ninterval: 1000\nratio: \"0.5\"\n"},
+		{"toml", "password = 123456\nzip = \"08080\"\nenabled = true\nport = \"8080\"\ntimeout = \"5s\"\ninterval = 1000\nratio = 0.5\n"},
+		{"ini", "password = 123456\nzip = 08080\nenabled = true\nport = 08080\ntimeout = 5s\ninterval = 1000\nratio = 0.50\n"},
+		{"xml", "<app><password>123456</password><zip>08080</zip><enabled>true</enabled><port>8080</port><timeout>5s</timeout><interval>1000</interval><ratio>0.5</ratio></app>"},
+	} {
+		var got decodeConfig
+		if err := LookupFormat(ts.format).Decode(strings.NewReader(ts.content), &got); err != nil {
+			t.Errorf("%dth: Decode error: %v", i, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%dth: want %+v, but got %+v", i, want, got)
+		}
+	}
+
+	var got decodeConfig
+	if err := LookupFormat("yaml").Decode(strings.NewReader("port: abc\n"), &got); err == nil || !strings.HasPrefix(err.Error(), "port: ") {
+		t.Errorf("want error of port, but got %v", err)
+	}
+}
+
+func TestXMLFormat(t *testing.T) {
+	type xmlConfig struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+		DB   struct {
+			MaxConns int `json:"max_conns"`
+		} `json:"db"`
+	}
+	var conf xmlConfig
+	conf.Name = "app"
+	conf.Tags = []string{"a", "b"}
+	conf.DB.MaxConns = 10
+	format := LookupFormat("xml")
+	data, err := format.Encode(&conf)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	// fields are mapped by json names by both Decode and Read
+	var got xmlConfig
+	if err := format.Decode(bytes.NewReader(data), &got); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(got, conf) {
+		t.Errorf("want %+v, but got %+v", conf, got)
+	}
+	doc, err := format.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if v := doc.Get("db"); v == nil || v.Get("max_conns") == nil {
+		t.Errorf("want db.max_conns read, but got %s", data)
+	}
+}
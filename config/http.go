@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mkideal/pkg/netutil/httputil"
+)
+
+// HTTPSource fetches config from http URL
+type HTTPSource struct {
+	URL string
+
+	// BearerToken sets header `Authorization: Bearer <token>` if non-empty
+	BearerToken string
+	// Username and Password set basic auth if Username is non-empty
+	Username string
+	Password string
+	// Header contains additional headers of request
+	Header http.Header
+
+	// CertFile and KeyFile are PEM encoded client certificate and key
+	CertFile string
+	KeyFile  string
+	// CAFile is PEM encoded certificates of root CAs to verify server, system
+	// roots are used if empty
+	CAFile string
+
+	// Timeout of each request, default is 10 seconds
+	Timeout time.Duration
+	// Retries is max number of retries after network errors and 5xx or 429
+	// responses, waiting Backoff before the first retry and doubling it after
+	// every retry. Default backoff is 500 milliseconds.
+	Retries int
+	Backoff time.Duration
+
+	// Checksum is expected checksum of content, e.g. sha256:<hex>.
+	// ChecksumHeader is name of response header which contains checksum in
+	// same form. Supported algorithms are sha256, sha1 and md5.
+	Checksum       string
+	ChecksumHeader string
+
+	// CacheFile saves last-known-good content with mode 0600. Content of
+	// CacheFile is used if server is unavailable, i.e. fetching failed by
+	// network errors or 5xx or 429 responses, other errors like 4xx responses
+	// and checksum mismatch are returned. Format of cached content is decided
+	// by suffix of CacheFile, or suffix of URL.
+	CacheFile string
+
+	// ErrorHandler is called with errors which don't fail fetching, e.g.
+	// error of fetching before content of cache used and error of writing cache
+	ErrorHandler func(error)
+
+	// Client is used instead of client created by above options if non-nil
+	Client *http.Client
+}
+
+// Fetch fetches content and its format from URL, or from cache file if
+// server is unavailable
+func (s *HTTPSource) Fetch() ([]byte, *Format, error) {
+	return s.Load(context.Background())
+}
+
+// Load implements Source interface, it's same as Fetch but requests are
+// canceled when ctx done
+func (s *HTTPSource) Load(ctx context.Context) ([]byte, *Format, error) {
+	return s.load(ctx, nil)
+}
+
+// errNotModified is returned by conditional loading if content not modified
+var errNotModified = errors.New("not modified")
+
+// validators of content which are sent by conditional requests
+type validators struct {
+	etag    string // sent by If-None-Match
+	lastMod string // sent by If-Modified-Since
+}
+
+// load loads content like Load, requests are conditional if cond is non-nil,
+// errNotModified returned if server responds 304, and cond is updated by
+// headers of response if content fetched
+func (s *HTTPSource) load(ctx context.Context, cond *validators) ([]byte, *Format, error) {
+	data, format, unavailable, err := s.fetch(ctx, cond)
+	if err == nil {
+		if s.CacheFile != "" {
+			s.handleError(writeFileAtomic(s.CacheFile, data, 0600))
+		}
+		return data, format, nil
+	}
+	if s.CacheFile == "" || !unavailable {
+		return nil, nil, err
+	}
+	cached, cacheErr := ioutil.ReadFile(s.CacheFile)
+	if cacheErr != nil {
+		return nil, nil, err
+	}
+	s.handleError(fmt.Errorf("%v, using cache %s", err, s.CacheFile))
+	format = LookupFormat(filenameSuffix(s.CacheFile, ""))
+	if format == nil {
+		format = formatOfURL(s.URL, "")
+	}
+	return cached, format, nil
+}
+
+func (s *HTTPSource) handleError(err error) {
+	if err != nil && s.ErrorHandler != nil {
+		s.ErrorHandler(err)
+	}
+}
+
+// fetch fetches content with retries, it reports whether server is unavailable
+// if failed
+func (s *HTTPSource) fetch(ctx context.Context, cond *validators) (data []byte, format *Format, unavailable bool, err error) {
+	client := s.Client
+	if client == nil {
+		if client, err = s.newClient(); err != nil {
+			return nil, nil, false, err
+		}
+		defer client.CloseIdleConnections()
+	}
+	backoff := s.Backoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	for i := 0; ; i++ {
+		var retry bool
+		data, format, retry, err = s.do(ctx, client, cond)
+		if err == nil {
+			return data, format, false, nil
+		}
+		if !retry || i >= s.Retries {
+			return nil, nil, retry, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, true, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// do requests URL once, it reports whether request should be retried if failed
+func (s *HTTPSource) do(ctx context.Context, client *http.Client, cond *validators) (data []byte, format *Format, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	if s.BearerToken != "" {
+		req.Header.Set(httputil.HeaderAuthorization, "Bearer "+s.BearerToken)
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	if cond != nil {
+		if cond.etag != "" {
+			req.Header.Set(httputil.HeaderIfNoneMatch, cond.etag)
+		}
+		if cond.lastMod != "" {
+			req.Header.Set(httputil.HeaderIfModifiedSince, cond.lastMod)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	defer resp.Body.Close()
+	if cond != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, nil, false, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, nil, retry, errors.New(resp.Status)
+	}
+	if data, err = ioutil.ReadAll(resp.Body); err != nil {
+		return nil, nil, true, err
+	}
+	if s.Checksum != "" {
+		if err := verifyChecksum(data, s.Checksum); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if s.ChecksumHeader != "" {
+		if err := verifyChecksum(data, resp.Header.Get(s.ChecksumHeader)); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	format = formatOfURL(s.URL, resp.Header.Get(httputil.HeaderContentType))
+	if format == nil {
+		return nil, nil, false, fmt.Errorf("unsupported format of %s", s.URL)
+	}
+	if cond != nil {
+		cond.etag = resp.Header.Get(httputil.HeaderETag)
+		cond.lastMod = resp.Header.Get(httputil.HeaderLastModified)
+	}
+	return data, format, false, nil
+}
+
+func (s *HTTPSource) newClient() (*http.Client, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.CertFile != "" || s.CAFile != "" {
+		tlsConfig := &tls.Config{}
+		if s.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if s.CAFile != "" {
+			pem, err := ioutil.ReadFile(s.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", s.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// verifyChecksum verifies checksum of data, checksum is formatted as
+// <algorithm>:<hex> or <algorithm>=<hex>
+func verifyChecksum(data []byte, checksum string) error {
+	i := strings.IndexAny(checksum, ":=")
+	if i < 0 {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	var h hash.Hash
+	switch algo := strings.ToLower(checksum[:i]); algo {
+	case "sha256":
+		h = sha256.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return fmt.Errorf("unsupported checksum algorithm %s", algo)
+	}
+	h.Write(data)
+	want, err := hex.DecodeString(strings.TrimSpace(checksum[i+1:]))
+	if err != nil {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("checksum mismatch: want %x, but got %x", want, got)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file of mode perm then renames it
+// to filename
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
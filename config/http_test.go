@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const content = "name: app\nport: 8080\n"
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Header().Set("X-Checksum", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content))))
+		w.Write([]byte(content))
+	}))
+
+	cacheFile := filepath.Join(dir, "app.cache.yaml")
+	source := &HTTPSource{
+		URL:            server.URL + "/app",
+		BearerToken:    "token",
+		Retries:        2,
+		Backoff:        time.Millisecond,
+		ChecksumHeader: "X-Checksum",
+		CacheFile:      cacheFile,
+	}
+	data, format, err := source.Fetch()
+	if err != nil || string(data) != content || format.Name != "yaml" {
+		t.Fatalf("want yaml content, but got %q, %v and error %v", data, format, err)
+	}
+	if cached, _ := ioutil.ReadFile(cacheFile); string(cached) != content {
+		t.Errorf("want cached content, but got %q", cached)
+	}
+	if info, err := os.Stat(cacheFile); err != nil {
+		t.Error(err)
+	} else if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("want cache file of mode 0600, but got %v", mode)
+	}
+
+	// unauthorized is not retried and cache is not used
+	failures = 0
+	if _, _, err := (&HTTPSource{URL: source.URL, Retries: 2, CacheFile: cacheFile}).Fetch(); err == nil || err.Error() != "401 Unauthorized" {
+		t.Errorf("want 401 error, but got %v", err)
+	}
+	// checksum mismatch
+	if _, _, err := (&HTTPSource{URL: source.URL, BearerToken: "token", Checksum: "sha256:00", CacheFile: cacheFile}).Fetch(); err == nil {
+		t.Errorf("want checksum error, but got nil")
+	}
+	// cache is used if server fails
+	failures = 1
+	if data, _, err := (&HTTPSource{URL: source.URL, BearerToken: "token", CacheFile: cacheFile}).Fetch(); err != nil || string(data) != content {
+		t.Errorf("want cached content after 503, but got %q and error %v", data, err)
+	}
+
+	// fall back to cache if server is unreachable
+	server.Close()
+	var fallback error
+	source.ErrorHandler = func(err error) { fallback = err }
+	data, format, err = source.Fetch()
+	if err != nil || string(data) != content || format.Name != "yaml" || fallback == nil {
+		t.Errorf("want cached yaml content, but got %q, %v, error %v and fallback %v", data, format, err, fallback)
+	}
+
+	// load config via Config
+	var conf struct {
+		Config
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	conf.SourceOfConfig = source.URL
+	conf.HTTPSource = &HTTPSource{CacheFile: cacheFile, Timeout: time.Second}
+	if err := conf.Init(&conf); err != nil || conf.Name != "app" || conf.Port != 8080 {
+		t.Errorf("want config loaded from cache, but got %+v and error %v", conf, err)
+	}
+}
+
+func TestHTTPSourceTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"port":443}`))
+	}))
+	defer server.Close()
+
+	if _, _, err := (&HTTPSource{URL: server.URL}).Fetch(); err == nil {
+		t.Errorf("want certificate error, but got nil")
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, format, err := (&HTTPSource{URL: server.URL, CAFile: caFile}).Fetch()
+	if err != nil || string(data) != `{"port":443}` || format.Name != "json" {
+		t.Errorf("want json content, but got %q, %v and error %v", data, format, err)
+	}
+}
@@ -0,0 +1,481 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/encoding/jsonx"
+	"github.com/mkideal/pkg/textutil/namemapper"
+)
+
+// Layer names reported by Loader.Source
+const (
+	LayerDefault = "default"
+	LayerFile    = "file"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+// LoaderOption represents a function for setting options of Loader
+type LoaderOption func(*Loader)
+
+// WithFiles returns an option which appends config files, files are loaded in
+// order and format of each file is decided by its suffix. Files may be URLs of
+// sources supported by OpenSource, e.g. kv://local/app.yaml.
+func WithFiles(filenames ...string) LoaderOption {
+	return func(l *Loader) {
+		l.files = append(l.files, filenames...)
+	}
+}
+
+// WithEnv returns an option which loads fields from environment variables,
+// e.g. field DB.MaxConns is loaded from APP_DB_MAX_CONNS if prefix is APP
+func WithEnv(prefix string) LoaderOption {
+	return func(l *Loader) {
+		l.env = true
+		l.envPrefix = prefix
+	}
+}
+
+// WithEnvStyle returns an option which sets style of words of environment
+// variable names, default is namemapper.UNDER_SCORE. Names are always upper-cased.
+func WithEnvStyle(style namemapper.NameStyle) LoaderOption {
+	return func(l *Loader) {
+		l.envStyle = style
+	}
+}
+
+// WithLookupEnv returns an option which looks up environment variables by
+// function lookup instead of os.LookupEnv
+func WithLookupEnv(lookup func(string) (string, bool)) LoaderOption {
+	return func(l *Loader) {
+		l.env = true
+		l.lookupEnv = lookup
+	}
+}
+
+// WithFlagSet returns an option which loads fields from flags set in flagSet,
+// see SetCommandLineFlags
+func WithFlagSet(flagSet *flag.FlagSet) LoaderOption {
+	return func(l *Loader) {
+		l.flagSet = flagSet
+	}
+}
+
+// WithSecretKey returns an option which sets key of decrypting encrypted
+// values, default key is loaded by LoadSecretKey
+func WithSecretKey(key []byte) LoaderOption {
+	return func(l *Loader) {
+		l.secretKey = key
+	}
+}
+
+// Loader loads config from layers, each layer overrides the previous one:
+//
+//  1. defaults, i.e. values of config before loading
+//  2. config files in order
+//  3. environment variables
+//  4. command-line flags
+//
+// Fields are identified by dotted paths of json names, e.g. db.host. Names of
+// environment variables are converted from Go names of fields, e.g. field
+// DB.MaxConns is loaded from environment variable PREFIX_DB_MAX_CONNS. Names
+// of flags are same as BindFlags, e.g. -db.max-conns.
+//
+// Loader implements CommandLineConfigurator, so it can be used as:
+//
+//	l := config.NewLoader(config.WithFiles("app.yaml"), config.WithEnv("APP"))
+//	l.SetCommandLineFlags(flag.CommandLine)
+//	if err := l.Init(&conf); err != nil {
+//		return err
+//	}
+type Loader struct {
+	files     []string
+	env       bool
+	envPrefix string
+	envStyle  namemapper.NameStyle
+	lookupEnv func(string) (string, bool)
+	flagSet   *flag.FlagSet
+	secretKey []byte
+
+	sources map[string]string // layer of each field path
+}
+
+// NewLoader creates a Loader
+func NewLoader(opts ...LoaderOption) *Loader {
+	l := &Loader{
+		envStyle:  namemapper.UNDER_SCORE,
+		lookupEnv: os.LookupEnv,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// SetCommandLineFlags sets flagSet whose flags are loaded as the last layer.
+// Only flags which are set explicitly override fields.
+func (l *Loader) SetCommandLineFlags(flagSet *flag.FlagSet) {
+	l.flagSet = flagSet
+}
+
+// Init implements Configurator interface, it's equivalent to Load
+func (l *Loader) Init(conf interface{}) error {
+	return l.Load(conf)
+}
+
+// Load loads conf which must be a pointer to struct, encrypted values of
+// loaded conf are decrypted by Decrypt, then conf is validated by Validate
+func (l *Loader) Load(conf interface{}) error {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load(non-pointer to struct %v)", reflect.TypeOf(conf))
+	}
+	l.sources = make(map[string]string)
+
+	// defaults
+	root, err := valueOf(conf)
+	if err != nil {
+		return err
+	}
+	if root.Kind != encoding.ObjectValue {
+		root = encoding.NewObject()
+	}
+	l.setSources(nil, root, LayerDefault)
+
+	// files
+	for _, filename := range l.files {
+		v, err := readFile(filename)
+		if err != nil {
+			return fmt.Errorf("config: read %s: %v", filename, err)
+		}
+		l.merge(nil, root, v, LayerFile+":"+filename)
+	}
+
+	fields := structFields(rv.Elem().Type(), nil, nil, "", make(map[reflect.Type]bool))
+
+	// environment variables
+	if l.env {
+		for _, f := range fields {
+			name := l.envName(f)
+			text, ok := l.lookupEnv(name)
+			if !ok {
+				continue
+			}
+			v, err := parseText(text, f.typ)
+			if err != nil {
+				return fmt.Errorf("config: env %s: %v", name, err)
+			}
+			l.set(root, f.path, v, LayerEnv+":"+name)
+		}
+	}
+
+	// flags
+	if l.flagSet != nil {
+		if l.flagSet == flag.CommandLine && !flag.Parsed() {
+			flag.Parse()
+		}
+		byName := make(map[string]field, len(fields))
+		for _, f := range fields {
+			for _, name := range f.flags {
+				byName[name] = f
+			}
+		}
+		var err error
+		l.flagSet.Visit(func(fl *flag.Flag) {
+			f, ok := byName[fl.Name]
+			if !ok || err != nil {
+				return
+			}
+			text := fl.Value.String()
+			if fv, ok := fl.Value.(*fieldValue); ok {
+				text = fv.text()
+			}
+			var v *encoding.Value
+			if v, err = parseText(text, f.typ); err != nil {
+				err = fmt.Errorf("config: flag -%s: %v", fl.Name, err)
+				return
+			}
+			l.set(root, f.path, v, LayerFlag+":"+fl.Name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := decodeValue(root, conf); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	if err := Decrypt(conf, l.secretKey); err != nil {
+		return err
+	}
+	return Validate(conf)
+}
+
+// Source returns layer which supplied value of field path, e.g. "default",
+// "file:app.yaml", "env:APP_PORT" or "flag:port". Empty string returned if the
+// field not found.
+func (l *Loader) Source(path string) string {
+	return l.sources[path]
+}
+
+// Sources returns layers of all loaded fields by path
+func (l *Loader) Sources() map[string]string {
+	sources := make(map[string]string, len(l.sources))
+	for path, layer := range l.sources {
+		sources[path] = layer
+	}
+	return sources
+}
+
+// Paths returns sorted paths of all loaded fields
+func (l *Loader) Paths() []string {
+	paths := make([]string, 0, len(l.sources))
+	for path := range l.sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func readFile(filename string) (*encoding.Value, error) {
+	source, err := OpenSource(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, format, err := source.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if format.Read == nil {
+		return nil, fmt.Errorf("format %s can't be read as document", format.Name)
+	}
+	return format.Read(bytes.NewReader(data))
+}
+
+// valueOf converts conf to document via json
+func valueOf(conf interface{}) (*encoding.Value, error) {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	node, err := jsonx.ReadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return jsonx.ToValue(node), nil
+}
+
+func joinPath(path []string) string { return strings.Join(path, ".") }
+
+// setSources sets layer of v and all values in v
+func (l *Loader) setSources(path []string, v *encoding.Value, layer string) {
+	if v.Kind == encoding.ObjectValue {
+		for _, f := range v.Fields {
+			l.setSources(append(path[:len(path):len(path)], f.Key), f.Value, layer)
+		}
+		if len(v.Fields) > 0 || len(path) == 0 {
+			return
+		}
+	}
+	l.sources[joinPath(path)] = layer
+}
+
+// removeSources removes layers of path and all paths under it
+func (l *Loader) removeSources(path []string) {
+	prefix := joinPath(path)
+	for p := range l.sources {
+		if p == prefix || strings.HasPrefix(p, prefix+".") {
+			delete(l.sources, p)
+		}
+	}
+}
+
+// merge merges src into dst, objects are merged by fields and other values
+// are replaced
+func (l *Loader) merge(path []string, dst, src *encoding.Value, layer string) {
+	for _, f := range src.Fields {
+		subpath := append(path[:len(path):len(path)], f.Key)
+		old := dst.Get(f.Key)
+		if old != nil && old.Kind == encoding.ObjectValue && f.Value.Kind == encoding.ObjectValue {
+			l.merge(subpath, old, f.Value, layer)
+			continue
+		}
+		l.removeSources(subpath)
+		dst.Set(f.Key, f.Value)
+		l.setSources(subpath, f.Value, layer)
+	}
+}
+
+// set sets value of path, objects on the path are created if not found
+func (l *Loader) set(root *encoding.Value, path []string, v *encoding.Value, layer string) {
+	parent := root
+	for _, key := range path[:len(path)-1] {
+		next := parent.Get(key)
+		if next == nil || next.Kind != encoding.ObjectValue {
+			next = encoding.NewObject()
+			parent.Set(key, next)
+		}
+		parent = next
+	}
+	l.removeSources(path)
+	parent.Set(path[len(path)-1], v)
+	l.setSources(path, v, layer)
+}
+
+// field represents a leaf field of config struct
+type field struct {
+	path  []string // json names
+	names []string // Go names
+	flags []string // names of flags, see BindFlags
+	typ   reflect.Type
+}
+
+var textUnmarshalerType = reflect.TypeOf((*interface{ UnmarshalText([]byte) error })(nil)).Elem()
+
+// isLeaf reports whether values of type t are loaded as a whole
+func isLeaf(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// structFields returns leaf fields of struct type t by json rules: fields
+// tagged by json:"-" and unexported fields are ignored, fields of embedded
+// structs without json name are promoted. Struct types in visiting are on the
+// current path and skipped, so recursive types like Next of
+// type Node struct{ Next *Node } are not loaded.
+func structFields(t reflect.Type, path, names []string, prefix string, visiting map[reflect.Type]bool) []field {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, structFields(ft, path, names, prefix, visiting)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fpath := append(path[:len(path):len(path)], name)
+		fnames := append(names[:len(names):len(names)], sf.Name)
+		flags := flagNames(sf)
+		if isLeaf(sf.Type) {
+			for i := range flags {
+				flags[i] = prefix + flags[i]
+			}
+			fields = append(fields, field{path: fpath, names: fnames, flags: flags, typ: sf.Type})
+		} else {
+			fields = append(fields, structFields(ft, fpath, fnames, prefix+flags[0]+".", visiting)...)
+		}
+	}
+	return fields
+}
+
+// envName returns name of environment variable of field f
+func (l *Loader) envName(f field) string {
+	words := make([]string, 0, len(f.names)+1)
+	if l.envPrefix != "" {
+		words = append(words, l.envPrefix)
+	}
+	for _, name := range f.names {
+		words = append(words, namemapper.Convert(name, l.envStyle))
+	}
+	return strings.ToUpper(strings.Join(words, "_"))
+}
+
+// parseText parses text of environment variable or flag as value of type t.
+// Slices of scalars are separated by comma, structs and maps are parsed as json.
+func parseText(text string, t reflect.Type) (*encoding.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return encoding.NewString(text), nil
+	}
+	if t == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", text)
+		}
+		return encoding.NewInt(int64(d)), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return encoding.NewString(text), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", text)
+		}
+		return encoding.NewBool(b), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 0, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v %q", t.Kind(), text)
+		}
+		return encoding.NewInt(i), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(text, 0, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v %q", t.Kind(), text)
+		}
+		if int64(i) < 0 {
+			return encoding.NewFloat(float64(i)), nil
+		}
+		return encoding.NewInt(int64(i)), nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v %q", t.Kind(), text)
+		}
+		return encoding.NewFloat(f), nil
+	case reflect.Slice, reflect.Array:
+		if isLeaf(t.Elem()) && t.Elem().Kind() != reflect.Slice && t.Elem().Kind() != reflect.Map {
+			arr := encoding.NewArray()
+			if text == "" {
+				return arr, nil
+			}
+			for _, s := range strings.Split(text, ",") {
+				elem, err := parseText(strings.TrimSpace(s), t.Elem())
+				if err != nil {
+					return nil, err
+				}
+				arr.Elems = append(arr.Elems, elem)
+			}
+			return arr, nil
+		}
+	}
+	node, err := jsonx.ReadBytes([]byte(text), jsonx.WithExtraComma())
+	if err != nil {
+		return nil, err
+	}
+	return jsonx.ToValue(node), nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type loaderConfig struct {
+	Name  string   `json:"name"`
+	Port  int      `json:"port"`
+	Debug bool     `json:"debug"`
+	Tags  []string `json:"tags"`
+	DB    struct {
+		Host     string `json:"host"`
+		MaxConns int    `json:"max_conns"`
+	} `json:"db"`
+}
+
+func TestLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.yaml")
+	local := filepath.Join(dir, "local.toml")
+	ioutil.WriteFile(base, []byte("name: app\nport: 80\ndb:\n  host: db1\n  max_conns: 10\n"), 0644)
+	ioutil.WriteFile(local, []byte("port = 8080\n[db]\nhost = \"db2\"\n"), 0644)
+
+	env := map[string]string{
+		"APP_DB_MAX_CONNS": "20",
+		"APP_TAGS":         "a, b",
+		"APP_DEBUG":        "true",
+	}
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.Bool("debug", false, "")
+	flagSet.String("unknown", "", "")
+	if err := flagSet.Parse([]string{"-debug=false", "-unknown=x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var conf loaderConfig
+	conf.Tags = []string{"default"}
+	l := NewLoader(
+		WithFiles(base, local),
+		WithEnv("APP"),
+		WithLookupEnv(func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}),
+		WithFlagSet(flagSet),
+	)
+	if err := l.Load(&conf); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	var want loaderConfig
+	want.Name = "app"
+	want.Port = 8080
+	want.Tags = []string{"a", "b"}
+	want.DB.Host = "db2"
+	want.DB.MaxConns = 20
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("want %+v, but got %+v", want, conf)
+	}
+	for path, layer := range map[string]string{
+		"name":         "file:" + base,
+		"port":         "file:" + local,
+		"debug":        "flag:debug",
+		"tags":         "env:APP_TAGS",
+		"db.host":      "file:" + local,
+		"db.max_conns": "env:APP_DB_MAX_CONNS",
+	} {
+		if got := l.Source(path); got != layer {
+			t.Errorf("%s: want layer %s, but got %s", path, layer, got)
+		}
+	}
+
+	env["APP_PORT"] = "x"
+	if err := l.Load(&conf); err == nil || err.Error() != `config: env APP_PORT: invalid int "x"` {
+		t.Errorf("want error of APP_PORT, but got %v", err)
+	}
+}
+
+type lNode struct {
+	Name string `json:"name"`
+	Next *lNode `json:"next"`
+}
+
+func TestLoaderRecursiveType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "node.json")
+	ioutil.WriteFile(filename, []byte(`{"name":"a","next":{"name":"b"}}`), 0644)
+
+	var conf lNode
+	l := NewLoader(
+		WithFiles(filename),
+		WithEnv("APP"),
+		WithLookupEnv(func(name string) (string, bool) {
+			if name == "APP_NAME" {
+				return "x", true
+			}
+			return "", false
+		}),
+	)
+	if err := l.Load(&conf); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if conf.Name != "x" || conf.Next == nil || conf.Next.Name != "b" || conf.Next.Next != nil {
+		t.Errorf("unexpected config %+v", conf)
+	}
+}
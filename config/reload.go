@@ -0,0 +1,373 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReloadOption represents a function for setting options of Reloadable
+type ReloadOption func(*Reloadable)
+
+// WithInterval returns an option which sets interval of checking source for
+// changes, default is 5 seconds
+func WithInterval(interval time.Duration) ReloadOption {
+	return func(r *Reloadable) {
+		r.interval = interval
+	}
+}
+
+// WithValidator returns an option which validates reloaded config before it's
+// swapped in, the config is dropped if validate returns an error. It's called
+// after config passed Validate.
+func WithValidator(validate func(conf interface{}) error) ReloadOption {
+	return func(r *Reloadable) {
+		r.validate = validate
+	}
+}
+
+// WithErrorHandler returns an option which sets handler of errors of reloading
+// in background, errors are ignored by default
+func WithErrorHandler(handler func(error)) ReloadOption {
+	return func(r *Reloadable) {
+		r.errorHandler = handler
+	}
+}
+
+// WithHTTPClient returns an option which sets client of http source, default
+// client is created by options of HTTPSource, see WithHTTPSource
+func WithHTTPClient(client *http.Client) ReloadOption {
+	return func(r *Reloadable) {
+		r.client = client
+	}
+}
+
+// WithHTTPSource returns an option which sets options of http source like
+// auth, TLS, timeout, retries and cache, URL of source is replaced by source
+// of Reloadable
+func WithHTTPSource(source *HTTPSource) ReloadOption {
+	return func(r *Reloadable) {
+		r.httpSource = source
+	}
+}
+
+// Reloadable holds config which is reloaded when its source changes. Source
+// is a filename or URL like SourceOfConfig of Config, file is checked by
+// modification time and size while http source is loaded by HTTPSource and
+// polled by conditional requests with ETag and If-Modified-Since. Loading is
+// canceled by Close. Other sources opened by OpenSource
+// are polled by comparing content, and sources which implement
+// WatchableSource are reloaded as soon as they notify changes.
+//
+// Reloaded config is decoded into a fresh struct, validated by Validate and
+// the validator set by WithValidator, swapped in atomically, and then
+// subscribers are notified. A failed reload keeps the previous config.
+//
+//	r, err := config.NewReloadable("game.yaml", func() interface{} { return new(GameConfig) })
+//	if err != nil {
+//		return err
+//	}
+//	r.Subscribe(func(old, new interface{}) {
+//		log.Printf("config changed")
+//	})
+//	r.Watch()
+//	defer r.Close()
+//	conf := r.Get().(*GameConfig)
+type Reloadable struct {
+	source       string
+	newConf      func() interface{}
+	interval     time.Duration
+	validate     func(interface{}) error
+	errorHandler func(error)
+	client       *http.Client
+	httpSource   *HTTPSource
+	filename     string // filename of file source
+	src          Source // source other than file and http
+	ctx          context.Context
+	cancel       context.CancelFunc // cancels loading, called by Close
+
+	value atomic.Value
+
+	mu          sync.Mutex // guards following fields and serializes reloading
+	subscribers []func(old, new interface{})
+	modTime     time.Time
+	size        int64
+	validators  validators // validators of http content
+	content     []byte     // last content of src or http source
+	quit        chan struct{}
+	done        chan struct{}
+}
+
+// NewReloadable creates a Reloadable and loads config from source. newConf
+// creates a fresh config, e.g. a pointer to zero struct with defaults.
+func NewReloadable(source string, newConf func() interface{}, opts ...ReloadOption) (*Reloadable, error) {
+	r := &Reloadable{
+		source:   source,
+		newConf:  newConf,
+		interval: 5 * time.Second,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if isHTTPSource(source) {
+		hs := &HTTPSource{}
+		if r.httpSource != nil {
+			*hs = *r.httpSource
+		}
+		hs.URL = source
+		if r.client != nil {
+			hs.Client = r.client
+		}
+		r.httpSource = hs
+	} else {
+		src, err := OpenSource(source)
+		if err != nil {
+			return nil, err
+		}
+		if file, ok := src.(*FileSource); ok {
+			r.filename = file.Filename
+		} else {
+			r.src = src
+		}
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	if _, err := r.Reload(); err != nil {
+		r.cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Get returns current config
+func (r *Reloadable) Get() interface{} {
+	return r.value.Load()
+}
+
+// Subscribe adds fn which is called with old and new config after config
+// changed. fn is called while reloading, so it must not call Subscribe or Reload.
+func (r *Reloadable) Subscribe(fn func(old, new interface{})) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload reloads config if source changed, it reports whether config changed.
+// Previous config is kept if an error returned.
+func (r *Reloadable) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conf, err := r.load()
+	if err != nil {
+		return false, fmt.Errorf("reload config from %s: %v", r.source, err)
+	}
+	if conf == nil {
+		// not modified
+		return false, nil
+	}
+	old := r.value.Load()
+	r.value.Store(conf)
+	for _, fn := range r.subscribers {
+		fn(old, conf)
+	}
+	return true, nil
+}
+
+// Watch starts checking source for changes in background until Close called
+func (r *Reloadable) Watch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.quit != nil {
+		return
+	}
+	r.quit = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.watch(r.quit, r.done)
+}
+
+func (r *Reloadable) watch(quit, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	var changed chan struct{}
+	if source, ok := r.src.(WatchableSource); ok {
+		changed = make(chan struct{}, 1)
+		ctx, cancel := context.WithCancel(r.ctx)
+		watchDone := make(chan struct{})
+		defer func() {
+			cancel()
+			<-watchDone
+		}()
+		go func() {
+			defer close(watchDone)
+			err := source.Watch(ctx, func() {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil && err != ErrWatchNotSupported && ctx.Err() == nil {
+				r.handleError(fmt.Errorf("watch config %s: %v", r.source, err))
+			}
+		}()
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+		if _, err := r.Reload(); err != nil {
+			r.handleError(err)
+		}
+	}
+}
+
+func (r *Reloadable) handleError(err error) {
+	if r.errorHandler != nil {
+		r.errorHandler(err)
+	}
+}
+
+// Close stops watching and cancels loading in progress, config can't be
+// reloaded after closed
+func (r *Reloadable) Close() error {
+	// cancel before locking as reloading holds the lock
+	r.cancel()
+	r.mu.Lock()
+	quit, done := r.quit, r.done
+	r.quit, r.done = nil, nil
+	r.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+	return nil
+}
+
+// load loads a fresh config from source, nil returned if source not modified
+func (r *Reloadable) load() (interface{}, error) {
+	if r.src != nil {
+		return r.loadSource()
+	}
+	if isHTTPSource(r.source) {
+		return r.loadHTTP()
+	}
+	return r.loadFile()
+}
+
+func (r *Reloadable) loadSource() (interface{}, error) {
+	data, format, err := r.src.Load(r.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r.value.Load() != nil && bytes.Equal(data, r.content) {
+		return nil, nil
+	}
+	conf, err := r.decode(format, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r.content = data
+	return conf, nil
+}
+
+func (r *Reloadable) loadFile() (interface{}, error) {
+	info, err := os.Stat(r.filename)
+	if err != nil {
+		return nil, err
+	}
+	if r.value.Load() != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil, nil
+	}
+	file, err := os.Open(r.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	format := LookupFormat(filenameSuffix(r.filename, "json"))
+	if format == nil {
+		return nil, fmt.Errorf("unsupported format %q", filenameSuffix(r.filename, "json"))
+	}
+	conf, err := r.decode(format, file)
+	if err != nil {
+		return nil, err
+	}
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	return conf, nil
+}
+
+func (r *Reloadable) loadHTTP() (interface{}, error) {
+	cond := r.validators
+	if r.value.Load() == nil {
+		cond = validators{}
+	}
+	data, format, err := r.httpSource.load(r.ctx, &cond)
+	if err == errNotModified {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// content of cache file is loaded again if server unavailable
+	if r.value.Load() != nil && bytes.Equal(data, r.content) {
+		r.validators = cond
+		return nil, nil
+	}
+	conf, err := r.decode(format, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r.validators = cond
+	r.content = data
+	return conf, nil
+}
+
+func (r *Reloadable) decode(format *Format, reader io.Reader) (interface{}, error) {
+	conf := r.newConf()
+	if old := r.value.Load(); old != nil && reflect.TypeOf(old) != reflect.TypeOf(conf) {
+		return nil, fmt.Errorf("type of config changed from %T to %T", old, conf)
+	}
+	if err := format.Decode(reader, conf); err != nil {
+		return nil, err
+	}
+	if err := Decrypt(conf, nil); err != nil {
+		return nil, err
+	}
+	if err := Validate(conf); err != nil {
+		return nil, err
+	}
+	if r.validate != nil {
+		if err := r.validate(conf); err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
+
+func isHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// formatOfURL finds format of http source by content type, or by suffix of
+// URL path if content type is unknown. Default format is json.
+func formatOfURL(source, contentType string) *Format {
+	if format := LookupFormatByMIME(contentType); format != nil {
+		return format
+	}
+	path := source
+	if u, err := url.Parse(source); err == nil {
+		path = u.Path
+	}
+	return LookupFormat(filenameSuffix(path, "json"))
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type reloadConfig struct {
+	Rate int `json:"rate"`
+}
+
+func newReloadConfig() interface{} { return new(reloadConfig) }
+
+func TestReloadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "game.yaml")
+	write := func(content string, mtime time.Time) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("rate: 1\n", now)
+
+	r, err := NewReloadable(filename, newReloadConfig, WithValidator(func(conf interface{}) error {
+		if conf.(*reloadConfig).Rate < 0 {
+			return errors.New("negative rate")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("NewReloadable error: %v", err)
+	}
+	var changes []string
+	r.Subscribe(func(old, new interface{}) {
+		changes = append(changes, fmt.Sprintf("%d->%d", old.(*reloadConfig).Rate, new.(*reloadConfig).Rate))
+	})
+
+	for i, ts := range []struct {
+		content string
+		mtime   time.Time
+		changed bool
+		err     bool
+		rate    int
+	}{
+		{"rate: 1\n", now, false, false, 1},
+		{"rate: 2\n", now.Add(time.Second), true, false, 2},
+		{"rate: -1\n", now.Add(2 * time.Second), false, true, 2},
+		{"rate: [\n", now.Add(3 * time.Second), false, true, 2},
+		{"rate: 3\n", now.Add(4 * time.Second), true, false, 3},
+	} {
+		write(ts.content, ts.mtime)
+		changed, err := r.Reload()
+		if changed != ts.changed || (err != nil) != ts.err {
+			t.Errorf("%dth: want changed %v and error %v, but got %v and %v", i, ts.changed, ts.err, changed, err)
+		}
+		if rate := r.Get().(*reloadConfig).Rate; rate != ts.rate {
+			t.Errorf("%dth: want rate %d, but got %d", i, ts.rate, rate)
+		}
+	}
+	if fmt.Sprint(changes) != "[1->2 2->3]" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
+
+func TestReloadHTTP(t *testing.T) {
+	version := 1
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := fmt.Sprintf(`"v%d"`, version)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/x-yaml")
+		fmt.Fprintf(w, "rate: %d\n", version)
+	}))
+	defer server.Close()
+
+	r, err := NewReloadable(server.URL+"/game", newReloadConfig)
+	if err != nil {
+		t.Fatalf("NewReloadable error: %v", err)
+	}
+	if changed, err := r.Reload(); changed || err != nil {
+		t.Errorf("want not modified, but got %v and %v", changed, err)
+	}
+	version = 2
+	if changed, err := r.Reload(); !changed || err != nil {
+		t.Errorf("want changed, but got %v and %v", changed, err)
+	}
+	if rate := r.Get().(*reloadConfig).Rate; rate != 2 || requests != 3 {
+		t.Errorf("want rate 2 after 3 requests, but got %d after %d requests", rate, requests)
+	}
+}
+
+func TestReloadHTTPSource(t *testing.T) {
+	stalled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") != "" {
+			// stall until request canceled
+			select {
+			case stalled <- struct{}{}:
+			default:
+			}
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"rate":1}`)
+	}))
+	defer server.Close()
+
+	if _, err := NewReloadable(server.URL, newReloadConfig); err == nil {
+		t.Errorf("want error of unauthorized")
+	}
+	r, err := NewReloadable(server.URL, newReloadConfig,
+		WithHTTPSource(&HTTPSource{BearerToken: "token", Timeout: time.Minute}),
+		WithInterval(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewReloadable error: %v", err)
+	}
+	if rate := r.Get().(*reloadConfig).Rate; rate != 1 {
+		t.Errorf("want rate 1, but got %d", rate)
+	}
+	r.Watch()
+	select {
+	case <-stalled:
+	case <-time.After(time.Second):
+		t.Fatal("conditional request not sent")
+	}
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by stalled request")
+	}
+}
@@ -0,0 +1,383 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Secret values
+//
+// Fields tagged by secret:"true" are redacted by Redact and Sprint, and in
+// output of Config. Values of string fields prefixed by "enc:" are encrypted
+// values which are decrypted by Decrypt, e.g.
+//
+//	Password string `json:"password" secret:"true"`
+//
+//	{"password": "enc:1XKo2bq6jdT+0rYQKfWt3J7Sx8L8P0i6hA=="}
+//
+// Encrypted values are produced by command configenc or EncryptValue. Key of
+// encryption is a base64 encoded AES key of 16, 24 or 32 bytes, which is read
+// from environment variable CONFIG_SECRET_KEY, or from the file named by
+// CONFIG_SECRET_KEY_FILE.
+const (
+	SecretKeyEnv     = "CONFIG_SECRET_KEY"
+	SecretKeyFileEnv = "CONFIG_SECRET_KEY_FILE"
+
+	// EncryptedPrefix is prefix of encrypted values
+	EncryptedPrefix = "enc:"
+	// RedactedText replaces strings of secret fields
+	RedactedText = "******"
+)
+
+// ErrNoSecretKey is returned if encrypted values found but no key provided
+var ErrNoSecretKey = errors.New("config: no secret key, set " + SecretKeyEnv + " or " + SecretKeyFileEnv)
+
+// GenerateSecretKey generates a random 32 bytes key
+func GenerateSecretKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeSecretKey encodes key as text used by environment variable and key file
+func EncodeSecretKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParseSecretKey parses base64 encoded key
+func ParseSecretKey(text string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid secret key: %v", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("config: invalid secret key size %d", len(key))
+}
+
+// LoadSecretKey loads key from environment variable CONFIG_SECRET_KEY, or
+// from the file named by CONFIG_SECRET_KEY_FILE. ErrNoSecretKey returned if
+// neither is set.
+func LoadSecretKey() ([]byte, error) {
+	if text := os.Getenv(SecretKeyEnv); text != "" {
+		return ParseSecretKey(text)
+	}
+	if filename := os.Getenv(SecretKeyFileEnv); filename != "" {
+		return ReadSecretKeyFile(filename)
+	}
+	return nil, ErrNoSecretKey
+}
+
+// ReadSecretKeyFile reads base64 encoded key from file
+func ReadSecretKeyFile(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSecretKey(string(data))
+}
+
+// EncryptValue encrypts plaintext by AES-GCM, the result is prefixed by "enc:"
+// followed by base64 encoded nonce and ciphertext
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue decrypts value produced by EncryptValue
+func DecryptValue(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("config: value is not encrypted")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len(EncryptedPrefix):])
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("config: malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("config: decrypt value failed, wrong key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt decrypts encrypted values of strings in conf which must be a pointer,
+// including strings in slices and maps. If key is nil, it's loaded by
+// LoadSecretKey when an encrypted value found.
+func Decrypt(conf interface{}, key []byte) error {
+	v := reflect.ValueOf(conf)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("config: Decrypt(non-pointer %v)", reflect.TypeOf(conf))
+	}
+	d := &decrypter{key: key}
+	return d.decrypt("", v)
+}
+
+type decrypter struct {
+	key []byte
+}
+
+func (d *decrypter) decryptString(path, s string) (string, error) {
+	if d.key == nil {
+		key, err := LoadSecretKey()
+		if err != nil {
+			return "", err
+		}
+		d.key = key
+	}
+	plaintext, err := DecryptValue(d.key, s)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return plaintext, nil
+}
+
+// decrypt decrypts strings in v recursively, strings must be settable
+func (d *decrypter) decrypt(path string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values in interface are not settable
+			elem := v.Elem()
+			if elem.Kind() == reflect.String && IsEncrypted(elem.String()) && v.CanSet() {
+				s, err := d.decryptString(path, elem.String())
+				if err != nil {
+					return err
+				}
+				v.Set(reflect.ValueOf(s).Convert(elem.Type()))
+				return nil
+			}
+			if elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Map && elem.Kind() != reflect.Slice {
+				return nil
+			}
+			return d.decrypt(path, elem)
+		}
+		return d.decrypt(path, v.Elem())
+	case reflect.String:
+		if IsEncrypted(v.String()) && v.CanSet() {
+			s, err := d.decryptString(path, v.String())
+			if err != nil {
+				return err
+			}
+			v.SetString(s)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			if err := d.decrypt(joinFieldPath(path, jsonName(sf)), v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decrypt(joinFieldPath(path, fmt.Sprint(i)), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// values of map are not addressable, decrypt a copy then put it back
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := d.decrypt(joinFieldPath(path, fmt.Sprint(key.Interface())), elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// jsonName returns json name of struct field
+func jsonName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+func isSecret(sf reflect.StructField) bool {
+	return sf.Tag.Get("secret") == "true"
+}
+
+// Redact returns a deep copy of conf in which values of fields tagged by
+// secret:"true" are replaced: strings by RedactedText, others by zero values.
+// Type of result is same as conf.
+func Redact(conf interface{}) interface{} {
+	if conf == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(conf)).Interface()
+}
+
+// Sprint formats conf as indented json with secret fields redacted, it's used
+// for printing config in logs
+func Sprint(conf interface{}) string {
+	data, err := json.MarshalIndent(Redact(conf), "", "\t")
+	if err != nil {
+		return fmt.Sprintf("%%!(config: %v)", err)
+	}
+	return string(data)
+}
+
+// redactValue copies v, secret fields in the copy are redacted
+func redactValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(redactValue(v.Elem()))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(redactValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			if isSecret(sf) {
+				redactSecret(c.Field(i))
+			} else {
+				c.Field(i).Set(redactValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			c.SetMapIndex(key, redactValue(v.MapIndex(key)))
+		}
+		return c
+	}
+	return v
+}
+
+// redactSecret replaces value of secret field v which is a copy, strings in
+// pointers, slices and maps are replaced by RedactedText
+func redactSecret(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() > 0 {
+			v.SetString(RedactedText)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() && v.Elem().Kind() == reflect.String {
+			p := reflect.New(v.Type().Elem())
+			p.Elem().Set(v.Elem())
+			redactSecret(p.Elem())
+			v.Set(p)
+			return
+		}
+		v.Set(reflect.Zero(v.Type()))
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return
+		}
+		if v.Type().Elem().Kind() != reflect.String {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		c := v
+		if v.Kind() == reflect.Slice {
+			c = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			reflect.Copy(c, v)
+		}
+		for i := 0; i < c.Len(); i++ {
+			redactSecret(c.Index(i))
+		}
+		v.Set(c)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		if v.Type().Elem().Kind() != reflect.String {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			redactSecret(elem)
+			c.SetMapIndex(key, elem)
+		}
+		v.Set(c)
+	default:
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
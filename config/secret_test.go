@@ -0,0 +1,124 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type secretDB struct {
+	Host     string `json:"host"`
+	Password string `json:"password" secret:"true"`
+}
+
+type secretConfig struct {
+	Config
+	Name   string            `json:"name"`
+	Token  *string           `json:"token" secret:"true"`
+	Keys   []string          `json:"keys" secret:"true"`
+	Salt   int               `json:"salt" secret:"true"`
+	DBs    []secretDB        `json:"dbs"`
+	Labels map[string]string `json:"labels"`
+}
+
+func TestRedact(t *testing.T) {
+	token := "token"
+	conf := &secretConfig{
+		Name:  "app",
+		Token: &token,
+		Keys:  []string{"a", "b"},
+		Salt:  42,
+		DBs:   []secretDB{{Host: "localhost", Password: "pass"}},
+	}
+	redacted := Redact(conf).(*secretConfig)
+	if *redacted.Token != RedactedText || redacted.Keys[1] != RedactedText || redacted.Salt != 0 ||
+		redacted.DBs[0].Password != RedactedText || redacted.DBs[0].Host != "localhost" || redacted.Name != "app" {
+		t.Errorf("unexpected redacted config %+v", redacted)
+	}
+	if token != "token" || conf.Keys[1] != "b" || conf.Salt != 42 || conf.DBs[0].Password != "pass" {
+		t.Errorf("original config modified: %+v", conf)
+	}
+	if s := Sprint(conf); strings.Contains(s, `"pass"`) || !strings.Contains(s, "localhost") {
+		t.Errorf("unexpected Sprint result %s", s)
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(s string) string {
+		value, err := EncryptValue(key, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	password, label := encrypt("pass"), encrypt("secret label")
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte(EncodeSecretKey(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "app.json")
+	data := `{"name":"app","dbs":[{"host":"localhost","password":"` + password + `"}],"labels":{"a":"` + label + `"}}`
+	if err := ioutil.WriteFile(source, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var conf secretConfig
+	conf.SourceOfConfig = source
+	conf.flagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	os.Unsetenv(SecretKeyEnv)
+	os.Unsetenv(SecretKeyFileEnv)
+	if err := conf.Init(&conf); err != ErrNoSecretKey {
+		t.Errorf("want ErrNoSecretKey, but got %v", err)
+	}
+
+	os.Setenv(SecretKeyFileEnv, keyFile)
+	defer os.Unsetenv(SecretKeyFileEnv)
+	conf = secretConfig{}
+	conf.SourceOfConfig = source
+	conf.flagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := conf.Init(&conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.DBs[0].Password != "pass" || conf.Labels["a"] != "secret label" {
+		t.Errorf("unexpected decrypted config %+v", conf)
+	}
+
+	// encrypted values of defaults and flags without source
+	conf = secretConfig{Labels: map[string]string{"a": label}}
+	conf.flagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := BindFlags(conf.flagSet, &conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.flagSet.Parse([]string{"-token", password}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.Init(&conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Token == nil || *conf.Token != "pass" || conf.Labels["a"] != "secret label" {
+		t.Errorf("unexpected decrypted config %+v", conf)
+	}
+
+	other, _ := GenerateSecretKey()
+	if _, err := DecryptValue(other, password); err == nil {
+		t.Errorf("want error of decrypting by wrong key, but got nil")
+	}
+	var loaded secretConfig
+	l := NewLoader(WithFiles(source), WithSecretKey(other))
+	if err := l.Load(&loaded); err == nil || !strings.HasPrefix(err.Error(), "dbs.0.password: ") {
+		t.Errorf("want error of dbs.0.password, but got %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source loads content of config
+type Source interface {
+	// Load loads content and its format
+	Load(ctx context.Context) ([]byte, *Format, error)
+}
+
+// WatchableSource is a Source which notifies changes of content
+type WatchableSource interface {
+	Source
+	// Watch calls changed after content changed, it blocks until ctx done or
+	// an error occurred
+	Watch(ctx context.Context, changed func()) error
+}
+
+// ErrWatchNotSupported is returned by Watch if source doesn't support watching
+var ErrWatchNotSupported = errors.New("config: watch not supported")
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]func(u *url.URL) (Source, error){}
+)
+
+// RegisterScheme registers opener of sources of URL scheme, e.g. etcd
+func RegisterScheme(scheme string, open func(u *url.URL) (Source, error)) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	schemes[strings.ToLower(scheme)] = open
+}
+
+func init() {
+	RegisterScheme("file", func(u *url.URL) (Source, error) {
+		filename := u.Path
+		if u.Host != "" {
+			// relative path like file://etc/app.json
+			filename = u.Host + filename
+		}
+		return &FileSource{Filename: filename}, nil
+	})
+	openHTTP := func(u *url.URL) (Source, error) {
+		return &HTTPSource{URL: u.String()}, nil
+	}
+	RegisterScheme("http", openHTTP)
+	RegisterScheme("https", openHTTP)
+	RegisterScheme("env", func(u *url.URL) (Source, error) {
+		return &EnvSource{Prefix: u.Host + u.Path}, nil
+	})
+	RegisterScheme("kv", func(u *url.URL) (Source, error) {
+		kv := LookupKV(u.Host)
+		if kv == nil {
+			return nil, fmt.Errorf("config: kv %q not registered", u.Host)
+		}
+		return &KVSource{KV: kv, Key: strings.TrimPrefix(u.Path, "/")}, nil
+	})
+}
+
+// OpenSource opens source of URL by scheme:
+//
+//	app.json, file://app.json     file, format decided by suffix
+//	http://host/app.yaml          http(s), see HTTPSource
+//	env://APP                     environment variables prefixed by APP_, see EnvSource
+//	kv://name/app.yaml            key of kv registered by RegisterKV, see KVSource
+//
+// Sources of other schemes are opened by openers registered by RegisterScheme.
+func OpenSource(rawurl string) (Source, error) {
+	i := strings.Index(rawurl, "://")
+	if i <= 0 {
+		return &FileSource{Filename: rawurl}, nil
+	}
+	scheme := strings.ToLower(rawurl[:i])
+	schemesMu.RLock()
+	open := schemes[scheme]
+	schemesMu.RUnlock()
+	if open == nil {
+		return nil, fmt.Errorf("config: unsupported source scheme %q", scheme)
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return open(u)
+}
+
+// FileSource loads config from file, format is decided by suffix of filename
+type FileSource struct {
+	Filename string
+}
+
+// Load implements Source interface
+func (s *FileSource) Load(ctx context.Context) ([]byte, *Format, error) {
+	suffix := filenameSuffix(s.Filename, "json")
+	format := LookupFormat(suffix)
+	if format == nil {
+		return nil, nil, fmt.Errorf("unsupported format %q", suffix)
+	}
+	data, err := ioutil.ReadFile(s.Filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, format, nil
+}
+
+// EnvSource loads config from environment variables prefixed by Prefix and
+// underscore as a json object. Names are converted to lower case keys, and
+// double underscores separate keys of nested objects, e.g.
+//
+//	APP_ADDR=:8080           {"addr": ":8080"}
+//	APP_DB__MAX_CONNS=10     {"db": {"max_conns": 10}}
+//
+// Values which are json arrays, objects or strings are decoded as json, others
+// are kept as strings and converted by types of fields in decoding, e.g.
+// APP_VERSION=1.10 is "1.10" for a string field and 1.1 for a float field.
+type EnvSource struct {
+	Prefix string
+	// Environ returns environment variables as key=value, default is os.Environ
+	Environ func() []string
+}
+
+// Load implements Source interface
+func (s *EnvSource) Load(ctx context.Context) ([]byte, *Format, error) {
+	environ := s.Environ
+	if environ == nil {
+		environ = os.Environ
+	}
+	prefix := ""
+	if s.Prefix != "" {
+		prefix = strings.ToUpper(s.Prefix) + "_"
+	}
+	root := map[string]interface{}{}
+	env := environ()
+	sort.Strings(env)
+	for _, kv := range env {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 || !strings.HasPrefix(kv[:i], prefix) || i == len(prefix) {
+			continue
+		}
+		keys := strings.Split(strings.ToLower(kv[len(prefix):i]), "__")
+		obj := root
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := obj[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				obj[key] = child
+			}
+			obj = child
+		}
+		var value interface{} = kv[i+1:]
+		if text := strings.TrimSpace(kv[i+1:]); text != "" && strings.IndexByte("[{\"", text[0]) >= 0 && json.Valid([]byte(text)) {
+			value = json.RawMessage(text)
+		}
+		obj[keys[len(keys)-1]] = value
+	}
+	data, err := json.Marshal(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, envFormat(), nil
+}
+
+// envFormat is json format of EnvSource, but strings are converted by types
+// of fields in decoding, e.g. APP_PORT=80 is decoded into int field
+func envFormat() *Format {
+	format := *LookupFormat("json")
+	read := format.Read
+	format.Decode = func(r io.Reader, conf interface{}) error {
+		doc, err := read(r)
+		if err != nil {
+			return err
+		}
+		return decodeValue(doc, conf)
+	}
+	return &format
+}
+
+// KV is a key-value store which holds config documents
+type KV interface {
+	// Get returns value of key, ErrKeyNotFound returned if key not found
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// WatchableKV is a KV which notifies changes of keys
+type WatchableKV interface {
+	KV
+	// Watch calls changed after value of key changed, it blocks until ctx
+	// done or an error occurred
+	Watch(ctx context.Context, key string, changed func()) error
+}
+
+// ErrKeyNotFound is returned by KV if key not found
+var ErrKeyNotFound = errors.New("config: key not found")
+
+var (
+	kvsMu sync.RWMutex
+	kvs   = map[string]KV{}
+)
+
+// RegisterKV registers kv by name which is host of kv:// URLs, so backend of
+// config is switched by registering another kv with same name
+func RegisterKV(name string, kv KV) {
+	kvsMu.Lock()
+	defer kvsMu.Unlock()
+	kvs[name] = kv
+}
+
+// LookupKV finds kv registered by name, nil returned if not found
+func LookupKV(name string) KV {
+	kvsMu.RLock()
+	defer kvsMu.RUnlock()
+	return kvs[name]
+}
+
+// KVSource loads config from value of Key in KV, format is decided by suffix
+// of key, default is json
+type KVSource struct {
+	KV  KV
+	Key string
+}
+
+// Load implements Source interface
+func (s *KVSource) Load(ctx context.Context) ([]byte, *Format, error) {
+	suffix := filenameSuffix(path.Base(s.Key), "json")
+	format := LookupFormat(suffix)
+	if format == nil {
+		return nil, nil, fmt.Errorf("unsupported format %q", suffix)
+	}
+	data, err := s.KV.Get(ctx, s.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, format, nil
+}
+
+// Watch implements WatchableSource interface, ErrWatchNotSupported returned if
+// KV is not a WatchableKV
+func (s *KVSource) Watch(ctx context.Context, changed func()) error {
+	kv, ok := s.KV.(WatchableKV)
+	if !ok {
+		return ErrWatchNotSupported
+	}
+	return kv.Watch(ctx, s.Key, changed)
+}
+
+// MemoryKV is an in-memory WatchableKV, it's useful for tests
+type MemoryKV struct {
+	mu       sync.Mutex
+	values   map[string][]byte
+	watchers map[string][]chan struct{}
+}
+
+// NewMemoryKV creates a MemoryKV
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		values:   make(map[string][]byte),
+		watchers: make(map[string][]chan struct{}),
+	}
+}
+
+// Get implements KV interface
+func (kv *MemoryKV) Get(ctx context.Context, key string) ([]byte, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	value, ok := kv.values[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put sets value of key and notifies watchers of key
+func (kv *MemoryKV) Put(key string, value []byte) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.values[key] = append([]byte(nil), value...)
+	kv.notify(key)
+}
+
+// Delete deletes key and notifies watchers of key
+func (kv *MemoryKV) Delete(key string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	delete(kv.values, key)
+	kv.notify(key)
+}
+
+func (kv *MemoryKV) notify(key string) {
+	for _, ch := range kv.watchers[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a notification is pending already
+		}
+	}
+}
+
+// Watch implements WatchableKV interface
+func (kv *MemoryKV) Watch(ctx context.Context, key string, changed func()) error {
+	ch := make(chan struct{}, 1)
+	kv.mu.Lock()
+	kv.watchers[key] = append(kv.watchers[key], ch)
+	kv.mu.Unlock()
+	defer func() {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		watchers := kv.watchers[key]
+		for i := range watchers {
+			if watchers[i] == ch {
+				kv.watchers[key] = append(watchers[:i:i], watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			changed()
+		}
+	}
+}
+
+// DirKV is a WatchableKV backed by a directory, keys are slash-separated
+// paths of files relative to Dir. Changes are detected by polling
+// modification time and size of files every Interval, default is 1 second.
+type DirKV struct {
+	Dir      string
+	Interval time.Duration
+}
+
+// NewDirKV creates a DirKV of directory dir
+func NewDirKV(dir string) *DirKV {
+	return &DirKV{Dir: dir}
+}
+
+// filename returns name of file of key, keys out of Dir are rejected
+func (kv *DirKV) filename(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("config: invalid key %q", key)
+	}
+	return filepath.Join(kv.Dir, filepath.FromSlash(clean[1:])), nil
+}
+
+// Get implements KV interface
+func (kv *DirKV) Get(ctx context.Context, key string) ([]byte, error) {
+	filename, err := kv.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	return data, err
+}
+
+// Put writes value of key atomically
+func (kv *DirKV) Put(key string, value []byte) error {
+	filename, err := kv.filename(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, value, 0644)
+}
+
+// Watch implements WatchableKV interface
+func (kv *DirKV) Watch(ctx context.Context, key string, changed func()) error {
+	filename, err := kv.filename(key)
+	if err != nil {
+		return err
+	}
+	interval := kv.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	modTime, size := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if t, n := stat(); !t.Equal(modTime) || n != size {
+				modTime, size = t, n
+				changed()
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(filename, []byte("rate: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kv := NewMemoryKV()
+	kv.Put("apps/app.toml", []byte("rate = 2\n"))
+	RegisterKV("test", kv)
+	dirKV := NewDirKV(dir)
+	if err := dirKV.Put("apps/app.json", []byte(`{"rate":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	RegisterKV("testdir", dirKV)
+	os.Setenv("CONFIG_TEST_RATE", "4")
+	defer os.Unsetenv("CONFIG_TEST_RATE")
+
+	for i, ts := range []struct {
+		url    string
+		format string
+		rate   int
+		err    bool
+	}{
+		{filename, "yaml", 1, false},
+		{"file://" + filename, "yaml", 1, false},
+		{"kv://test/apps/app.toml", "toml", 2, false},
+		{"kv://testdir/apps/app.json", "json", 3, false},
+		{"env://CONFIG_TEST", "json", 4, false},
+		{"kv://test/apps/missing.json", "", 0, true},
+		{"kv://unknown/app.json", "", 0, true},
+		{"unknown://app.json", "", 0, true},
+	} {
+		source, err := OpenSource(ts.url)
+		var (
+			data   []byte
+			format *Format
+		)
+		if err == nil {
+			data, format, err = source.Load(context.Background())
+		}
+		if (err != nil) != ts.err {
+			t.Errorf("%dth: want error %v, but got %v", i, ts.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		conf := new(reloadConfig)
+		if format.Name != ts.format {
+			t.Errorf("%dth: want format %s, but got %s", i, ts.format, format.Name)
+		} else if err := format.Decode(bytes.NewReader(data), conf); err != nil || conf.Rate != ts.rate {
+			t.Errorf("%dth: want rate %d, but got %d and error %v", i, ts.rate, conf.Rate, err)
+		}
+	}
+
+	if _, err := dirKV.Get(context.Background(), "../../etc/hosts"); err != ErrKeyNotFound {
+		t.Errorf("want ErrKeyNotFound for key out of dir, but got %v", err)
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	source := &EnvSource{Prefix: "APP", Environ: func() []string {
+		return []string{"APP_ADDR=:8080", "APP_DB__MAX_CONNS=10", "APP_DB__HOSTS=[\"a\",\"b\"]", "APP_PASSWORD=123456", "APP_TIMEOUT=5s", "APP_VERSION=1.10", "APP_TOKEN=12345678901234567890123", "APP_RATIO=0.5", "APP_DEBUG=true", "OTHER=1"}
+	}}
+	data, format, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"addr":":8080","db":{"hosts":["a","b"],"max_conns":"10"},"debug":"true","password":"123456","ratio":"0.5","timeout":"5s","token":"12345678901234567890123","version":"1.10"}`
+	if string(data) != want {
+		t.Errorf("want %s, but got %s", want, data)
+	}
+
+	// strings are converted by types of fields
+	var conf struct {
+		Addr     string        `json:"addr"`
+		Password string        `json:"password"`
+		Timeout  time.Duration `json:"timeout"`
+		Version  string        `json:"version"`
+		Token    string        `json:"token"`
+		Ratio    float64       `json:"ratio"`
+		Debug    bool          `json:"debug"`
+		DB       struct {
+			MaxConns int      `json:"max_conns"`
+			Hosts    []string `json:"hosts"`
+		} `json:"db"`
+	}
+	if err := format.Decode(bytes.NewReader(data), &conf); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if conf.Password != "123456" || conf.Timeout != 5*time.Second || conf.DB.MaxConns != 10 || len(conf.DB.Hosts) != 2 ||
+		conf.Version != "1.10" || conf.Token != "12345678901234567890123" || conf.Ratio != 0.5 || !conf.Debug {
+		t.Errorf("unexpected config %+v", conf)
+	}
+}
+
+func TestReloadKV(t *testing.T) {
+	kv := NewMemoryKV()
+	kv.Put("app.json", []byte(`{"rate":1}`))
+	RegisterKV("reload", kv)
+	r, err := NewReloadable("kv://reload/app.json", newReloadConfig, WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := r.Reload(); changed || err != nil {
+		t.Errorf("want not changed, but got %v and error %v", changed, err)
+	}
+	changes := make(chan int, 1)
+	r.Subscribe(func(old, new interface{}) {
+		changes <- new.(*reloadConfig).Rate
+	})
+	r.Watch()
+	defer r.Close()
+	// wait for watching started
+	time.Sleep(10 * time.Millisecond)
+	kv.Put("app.json", []byte(`{"rate":2}`))
+	select {
+	case rate := <-changes:
+		if rate != 2 {
+			t.Errorf("want rate 2, but got %d", rate)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("config not reloaded after kv changed")
+	}
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mkideal/pkg/errors"
+)
+
+// Validator is implemented by configs which check rules across fields
+type Validator interface {
+	Validate() error
+}
+
+// FieldError represents a violation of validation rule of field
+type FieldError struct {
+	Path string // dotted path of json names, e.g. db.port or servers.0.host
+	Rule string // violated rule, e.g. max=65535
+	Msg  string
+}
+
+func (e *FieldError) Error() string { return e.Path + ": " + e.Msg }
+
+// Validate validates conf by validate tags of fields, then calls Validate of
+// structs which implement Validator. All violations are collected into an
+// *errors.ErrorList, nil returned if no violations.
+//
+// Rules of tag are separated by comma:
+//
+//	required      value must be non-zero
+//	min=N         number must be at least N, or length of string, slice or map
+//	max=N         number must be at most N, or length of string, slice or map
+//	oneof=a b c   value must be one of words separated by space
+//	regexp=expr   string must match regular expression, it must be the last rule
+//	              since expr may contain commas
+//
+// e.g.
+//
+//	Port int    `json:"port" validate:"required,min=1,max=65535"`
+//	Mode string `json:"mode" validate:"oneof=debug release"`
+//	Name string `json:"name" validate:"regexp=^[a-z][a-z0-9_]*$"`
+func Validate(conf interface{}) error {
+	var errs errors.ErrorList
+	validateValue(&errs, "", reflect.ValueOf(conf))
+	return errs.Err()
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// promotedValidator reports whether Validate of struct type t is promoted from
+// an embedded field which is validated as a field already. Methods promoted
+// are wrappers generated by compiler.
+func promotedValidator(t reflect.Type) bool {
+	m, ok := t.MethodByName("Validate")
+	if !ok {
+		if m, ok = reflect.PtrTo(t).MethodByName("Validate"); !ok {
+			return false
+		}
+	}
+	pc := m.Func.Pointer()
+	if file, _ := runtime.FuncForPC(pc).FileLine(pc); file != "<autogenerated>" {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.PkgPath == "" && sf.Tag.Get("json") != "-" &&
+			(sf.Type.Implements(validatorType) || reflect.PtrTo(sf.Type).Implements(validatorType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexps caches patterns of regexp rules, value is nil if pattern is invalid
+var regexps sync.Map
+
+func compileRule(expr string) *regexp.Regexp {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	regexps.Store(expr, re)
+	return re
+}
+
+// validateValue validates fields of structs in v recursively
+func validateValue(errs *errors.ErrorList, path string, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" || (sf.PkgPath != "" && !sf.Anonymous) {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			fpath := path
+			if !sf.Anonymous || name != "" {
+				if name == "" {
+					name = sf.Name
+				}
+				fpath = joinFieldPath(path, name)
+			}
+			fv := v.Field(i)
+			if rules := sf.Tag.Get("validate"); rules != "" {
+				validateField(errs, fpath, fv, rules)
+			}
+			if sf.PkgPath == "" {
+				validateValue(errs, fpath, fv)
+			}
+		}
+		var hook Validator
+		if v.CanAddr() && v.Addr().Type().Implements(validatorType) {
+			hook = v.Addr().Interface().(Validator)
+		} else if v.Type().Implements(validatorType) {
+			hook = v.Interface().(Validator)
+		}
+		if hook != nil && !promotedValidator(t) {
+			if err := hook.Validate(); err != nil {
+				if path != "" {
+					err = fmt.Errorf("%s: %v", path, err)
+				}
+				errs.Add(err)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(errs, joinFieldPath(path, strconv.Itoa(i)), v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			validateValue(errs, joinFieldPath(path, fmt.Sprint(key.Interface())), v.MapIndex(key))
+		}
+	}
+}
+
+// validateField checks rules of field
+func validateField(errs *errors.ErrorList, path string, v reflect.Value, rules string) {
+	for rules != "" {
+		rule := rules
+		if strings.HasPrefix(rules, "regexp=") {
+			rules = ""
+		} else if i := strings.IndexByte(rules, ','); i >= 0 {
+			rule, rules = rules[:i], rules[i+1:]
+		} else {
+			rules = ""
+		}
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		if msg := checkRule(v, name, arg); msg != "" {
+			errs.Add(&FieldError{Path: path, Rule: rule, Msg: msg})
+		}
+	}
+}
+
+// checkRule checks rule name=arg, it returns message of violation
+func checkRule(v reflect.Value, name, arg string) string {
+	if name == "required" {
+		if isZero(v) {
+			return "is required"
+		}
+		return ""
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid rule %s=%s", name, arg)
+		}
+		x, isLen, ok := measure(v)
+		if !ok {
+			return fmt.Sprintf("rule %s is not supported by %v", name, v.Type())
+		}
+		what := "must be"
+		if isLen {
+			what = "length must be"
+		}
+		if name == "min" && x < limit {
+			return fmt.Sprintf("%s at least %s", what, arg)
+		}
+		if name == "max" && x > limit {
+			return fmt.Sprintf("%s at most %s", what, arg)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, word := range strings.Fields(arg) {
+			if s == word {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", strings.Join(strings.Fields(arg), " "))
+	case "regexp":
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("rule %s is not supported by %v", name, v.Type())
+		}
+		re := compileRule(arg)
+		if re == nil {
+			return fmt.Sprintf("invalid rule %s=%s", name, arg)
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Sprintf("must match %s", arg)
+		}
+	default:
+		return fmt.Sprintf("unknown rule %s", name)
+	}
+	return ""
+}
+
+// measure returns value of number, or length of string, slice, array or map
+func measure(v reflect.Value) (x float64, isLen, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/mkideal/pkg/errors"
+)
+
+type validateServer struct {
+	Host string `json:"host" validate:"required"`
+	Port int    `json:"port" validate:"min=1,max=65535"`
+}
+
+type validateConfig struct {
+	Name    string           `json:"name" validate:"required,regexp=^[a-z]{2,}$"`
+	Mode    string           `json:"mode" validate:"oneof=debug release"`
+	Tags    []string         `json:"tags" validate:"max=2"`
+	Rate    *float64         `json:"rate" validate:"min=0,max=1"`
+	Servers []validateServer `json:"servers" validate:"required"`
+	Min     int              `json:"min"`
+	Max     int              `json:"max"`
+}
+
+func (c *validateConfig) Validate() error {
+	if c.Min > c.Max {
+		return errors.New("min must not be greater than max")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	rate := 1.5
+	conf := &validateConfig{
+		Name:    "A",
+		Mode:    "test",
+		Tags:    []string{"a", "b", "c"},
+		Rate:    &rate,
+		Servers: []validateServer{{Host: "a", Port: 80}, {Port: 70000}},
+		Min:     2,
+		Max:     1,
+	}
+	err := Validate(conf)
+	list, ok := err.(*pkgerrors.ErrorList)
+	if !ok {
+		t.Fatalf("want *errors.ErrorList, but got %T", err)
+	}
+	want := []string{
+		"name: must match ^[a-z]{2,}$",
+		"mode: must be one of [debug release]",
+		"tags: length must be at most 2",
+		"rate: must be at most 1",
+		"servers.1.host: is required",
+		"servers.1.port: must be at most 65535",
+		"min must not be greater than max",
+	}
+	var got []string
+	for _, e := range list.Errors() {
+		got = append(got, e.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want errors\n%s\nbut got\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if fe, ok := list.Errors()[5].(*FieldError); !ok || fe.Rule != "max=65535" {
+		t.Errorf("want FieldError of rule max=65535, but got %v", list.Errors()[5])
+	}
+
+	conf = &validateConfig{Name: "app", Mode: "debug", Servers: []validateServer{{Host: "a", Port: 80}}}
+	if err := Validate(conf); err != nil {
+		t.Errorf("want nil, but got %v", err)
+	}
+}
+
+type VBase struct {
+	Version int `json:"version"`
+}
+
+func (b *VBase) Validate() error {
+	if b.Version <= 0 {
+		return errors.New("version must be positive")
+	}
+	return nil
+}
+
+type vOverride struct {
+	VBase
+}
+
+func (c *vOverride) Validate() error { return errors.New("override") }
+
+type vHidden struct {
+	vBase
+}
+
+type vBase struct{ VBase }
+
+func TestValidateEmbedded(t *testing.T) {
+	for i, ts := range []struct {
+		conf interface{}
+		want []string
+	}{
+		{&struct {
+			VBase
+			Port int `json:"port"`
+		}{}, []string{"version must be positive"}},
+		{&struct {
+			*VBase
+			Port int `json:"port"`
+		}{VBase: &VBase{}}, []string{"version must be positive"}},
+		{&vOverride{}, []string{"version must be positive", "override"}},
+		{&vHidden{}, []string{"version must be positive"}},
+	} {
+		var got []string
+		if err := Validate(ts.conf); err != nil {
+			for _, e := range err.(*pkgerrors.ErrorList).Errors() {
+				got = append(got, e.Error())
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(ts.want, "\n") {
+			t.Errorf("%dth: want errors %q, but got %q", i, ts.want, got)
+		}
+	}
+}
+
+func TestInitValidate(t *testing.T) {
+	// config of defaults and flags without source is validated too
+	var conf struct {
+		CommandLineConfig
+		Name string `json:"name" validate:"required,regexp=^[a-z]{2,}$"`
+	}
+	conf.CommandLineConfig = *NewCommandLineConfig("config-source", "config-output")
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := BindFlags(flagSet, &conf); err != nil {
+		t.Fatalf("BindFlags error: %v", err)
+	}
+	conf.SetCommandLineFlags(flagSet)
+	if err := flagSet.Parse([]string{"-name", "A"}); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if err := conf.Config.Init(&conf); err == nil {
+		t.Errorf("want error of invalid name")
+	}
+	if err := flagSet.Parse([]string{"-name", "app"}); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if err := conf.Config.Init(&conf); err != nil {
+		t.Errorf("want nil, but got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"text/scanner"
 
 	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
 )
 
 // cso represents Comma-Separated Objects
@@ -26,15 +27,56 @@ import (
 // "1",2
 // true,false
 // 1,{2,3},["a","b"],{"c"},[1,2,3]
+//
+// comments:
+//
+// // comment lines are doc of next line
+// 1,{2 /* comment of 2 */,3} // line comment
 
 type lineReader struct {
-	reader  io.Reader
-	eof     bool
-	lineeof bool
+	reader   io.Reader
+	filename string
+	eof      bool
+	lineeof  bool
+	line     int    // number of current line
+	offset   int    // offset of beginning of current line
+	size     int    // number of bytes readed in current line
+	text     []byte // bytes readed in current line
 }
 
+// reset moves reader to next line
 func (r *lineReader) reset() {
 	r.lineeof = false
+	r.line++
+	r.offset += r.size
+	r.size = 0
+	r.text = r.text[:0]
+}
+
+// base returns position of beginning of current line
+func (r *lineReader) base() scanner.Position {
+	return scanner.Position{Filename: r.filename, Line: r.line, Offset: r.offset, Column: 1}
+}
+
+// skipLine skips remaining bytes of current line
+func (r *lineReader) skipLine() error {
+	var b [1]byte
+	for !r.lineeof && !r.eof {
+		if _, err := r.Read(b[:]); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillSource sets source line of syntax error err, remaining bytes of current
+// line are skipped
+func (r *lineReader) fillSource(err error) error {
+	if e, ok := err.(*encoding.SyntaxError); ok && e.Source == "" {
+		r.skipLine()
+		e.Source = encoding.SourceLine(r.text, e.Pos.Offset-r.offset)
+	}
+	return err
 }
 
 func (r *lineReader) Read(p []byte) (int, error) {
@@ -47,6 +89,8 @@ func (r *lineReader) Read(p []byte) (int, error) {
 	for i := 0; i < size; i++ {
 		n, err := r.reader.Read(p[i : i+1])
 		readedNum += n
+		r.size += n
+		r.text = append(r.text, p[i:i+n]...)
 		r.eof = r.eof || err == io.EOF
 		if err != nil {
 			return readedNum, err
@@ -59,58 +103,116 @@ func (r *lineReader) Read(p []byte) (int, error) {
 	return readedNum, nil
 }
 
-func newScanner() *scanner.Scanner {
-	s := new(scanner.Scanner)
-	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanChars | scanner.ScanStrings
+// initScanner initializes s to read from r, comments are scanned as tokens
+func initScanner(s *scanner.Scanner, r io.Reader) *scanner.Scanner {
+	s.Init(r)
+	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanChars |
+		scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanComments
 	return s
 }
 
 func readLine(p *parser, s *scanner.Scanner, r *lineReader) (Node, error) {
-	s = s.Init(r)
+	initScanner(s, r)
+	s.Filename = r.filename
+	p.SetBase(r.base())
 	if err := p.init(s); err != nil {
-		return nil, err
+		return nil, r.fillSource(err)
 	}
-	return p.parseListNode(encoding.ObjectNode, '{', '}', false)
+	n, err := p.parseListNode(encoding.ObjectNode, '{', '}', false)
+	if err != nil {
+		return nil, r.fillSource(err)
+	}
+	return n, nil
 }
 
 // Read reads one node
 func Read(r io.Reader) (Node, error) {
-	s := newScanner()
+	s := new(scanner.Scanner)
 	p := new(parser)
-	lr := &lineReader{reader: r}
+	lr := &lineReader{reader: r, line: 1}
 	return readLine(p, s, lr)
 }
 
+// ReadOption represents a function for setting options of ReadAll
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	// bad lines skipped and all errors reported if allErrors is true
+	allErrors bool
+}
+
+// WithAllErrors returns an option which makes ReadAll skip bad lines and report
+// all syntax errors as an *errors.ErrorList instead of stopping at the first one
+func WithAllErrors() ReadOption {
+	return func(opt *readOptions) {
+		opt.allErrors = true
+	}
+}
+
 // ReadAll reads all nodes
-func ReadAll(r io.Reader) ([]Node, error) {
-	s := newScanner()
+func ReadAll(r io.Reader, opts ...ReadOption) ([]Node, error) {
+	return readAll(&lineReader{reader: r}, opts)
+}
+
+func readAll(lr *lineReader, opts []ReadOption) ([]Node, error) {
+	var opt readOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+	s := new(scanner.Scanner)
 	p := new(parser)
-	lr := &lineReader{reader: r}
-	var nodes []Node
+	var (
+		nodes []Node
+		doc   *encoding.CommentGroup
+		errs  errors.ErrorList
+	)
 	for !lr.eof {
 		lr.reset()
 		n, err := readLine(p, s, lr)
 		if err != nil {
-			return nil, err
+			if !opt.allErrors {
+				return nil, err
+			}
+			errs.Add(err)
+			doc = nil
+			continue
 		}
+		if isCommentLine(n) {
+			doc = joinComments(doc, n.Comment())
+			continue
+		}
+		n.SetDoc(doc)
+		doc = nil
 		nodes = append(nodes, n)
 	}
-	return nodes, nil
+	if doc != nil {
+		// comment lines at end of file
+		n := newListNode(lr.base(), encoding.ObjectNode)
+		n.unbound = true
+		n.SetDoc(doc)
+		nodes = append(nodes, n)
+	}
+	return nodes, errs.Err()
+}
+
+// isCommentLine reports whether line node contains comments only
+func isCommentLine(n Node) bool {
+	return n.NumChild() == 0 && n.Comment() != nil
 }
 
 // ReadBytes reads nodes from bytes
-func ReadBytes(data []byte) ([]Node, error) {
-	return ReadAll(bytes.NewBuffer(data))
+func ReadBytes(data []byte, opts ...ReadOption) ([]Node, error) {
+	return ReadAll(bytes.NewBuffer(data), opts...)
 }
 
 // ReadFile reads nodes from file
-func ReadFile(filename string) ([]Node, error) {
+func ReadFile(filename string, opts ...ReadOption) ([]Node, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	return ReadAll(file)
+	return readAll(&lineReader{reader: file, filename: filename}, opts)
 }
 
 // Write writes node to writer
@@ -118,6 +220,24 @@ func Write(w io.Writer, node Node) error {
 	return node.output(w)
 }
 
+// WriteAll writes nodes to writer line by line. Comment lines are written before
+// the line which they belong to. The last node, if it's an empty line, is treated
+// as end of file, so nodes read by ReadAll are written back unchanged.
+func WriteAll(w io.Writer, nodes []Node) error {
+	for i, node := range nodes {
+		if err := node.output(w); err != nil {
+			return err
+		}
+		if i+1 == len(nodes) && node.NumChild() == 0 && node.Comment() == nil {
+			break
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // WriteFile writes node to file
 func WriteFile(filename string, node Node, perm os.FileMode) error {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, perm)
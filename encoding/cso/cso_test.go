@@ -5,6 +5,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
 )
 
 func TestRead(t *testing.T) {
@@ -37,3 +40,86 @@ func TestReadAll(t *testing.T) {
 		}
 	}
 }
+
+func TestComment(t *testing.T) {
+	src := `// items
+// id,name,pos
+1,"sword",{1.5 /* x */, 2} // the sword
+
+/* shield */ 2,"shield",{},[ /* empty */ ]
+// end
+`
+	nodes, err := ReadBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("want 4 nodes, but got %d", len(nodes))
+	}
+	if got, want := nodes[0].Doc().Text(), "// items\n// id,name,pos"; got != want {
+		t.Errorf("want doc %q, but got %q", want, got)
+	}
+	if got, want := nodes[0].Comment().Text(), "// the sword"; got != want {
+		t.Errorf("want comment %q, but got %q", want, got)
+	}
+	if got, want := nodes[0].ByIndex(2).ByIndex(0).Comment().Text(), "/* x */"; got != want {
+		t.Errorf("want comment %q, but got %q", want, got)
+	}
+	if pos := nodes[0].ByIndex(1).Pos(); pos.Line != 3 || pos.Column != 3 || pos.Offset != 26 {
+		t.Errorf("want position 3:3 at offset 26, but got %v at offset %d", pos, pos.Offset)
+	}
+	if got, want := nodes[2].ByIndex(0).Doc().Text(), "/* shield */"; got != want {
+		t.Errorf("want doc %q, but got %q", want, got)
+	}
+
+	var buf strings.Builder
+	if err := WriteAll(&buf, nodes); err != nil {
+		t.Fatalf("WriteAll error: %v", err)
+	}
+	want := `// items
+// id,name,pos
+1,"sword",{1.5 /* x */,2} // the sword
+
+/* shield */ 2,"shield",{},[ /* empty */ ]
+// end
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	src := "1,2\n3,{4 5}\n5,6\n7,[8}\n"
+	_, err := ReadAll(strings.NewReader(src))
+	e, ok := err.(*encoding.SyntaxError)
+	if !ok {
+		t.Fatalf("want *encoding.SyntaxError, but got %T", err)
+	}
+	if e.Pos.Line != 2 || e.Pos.Column != 6 || e.Pos.Offset != 9 {
+		t.Errorf("unexpected position %v(offset %d)", e.Pos, e.Pos.Offset)
+	}
+	if want := "3,{4 5}\n     ^"; e.Excerpt() != want {
+		t.Errorf("want excerpt\n%s\nbut got\n%s", want, e.Excerpt())
+	}
+
+	nodes, err := ReadAll(strings.NewReader(src), WithAllErrors())
+	list, ok := err.(*errors.ErrorList)
+	if !ok {
+		t.Fatalf("want *errors.ErrorList, but got %T", err)
+	}
+	want := []string{
+		"expect `,`, but got `5` at <input>:2:6",
+		"expect `,`, but got `}` at <input>:4:5",
+	}
+	if list.Len() != len(want) {
+		t.Errorf("want %d errors, but got %d", len(want), list.Len())
+	}
+	for i, err := range list.Errors() {
+		if i >= len(want) || err.Error() != want[i] {
+			t.Errorf("%dth: unexpected error %v", i, err)
+		}
+	}
+	if len(nodes) != 3 {
+		t.Errorf("want 3 nodes, but got %d", len(nodes))
+	}
+}
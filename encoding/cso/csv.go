@@ -0,0 +1,171 @@
+package cso
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+type csvOptions struct {
+	quoteStrings bool
+	inferIdent   bool
+	header       bool
+}
+
+// CSVOption is option for converting between CSV records and CSO nodes
+type CSVOption func(*csvOptions)
+
+// WithQuoteStrings returns an option which makes ToCSV write strings quoted
+// always, by default strings are quoted only if they would be read as other values
+func WithQuoteStrings() CSVOption {
+	return func(opt *csvOptions) {
+		opt.quoteStrings = true
+	}
+}
+
+// WithInferIdent returns an option which keeps cells which are valid identifiers as
+// idents, by default they are converted to strings except true and false
+func WithInferIdent() CSVOption {
+	return func(opt *csvOptions) {
+		opt.inferIdent = true
+	}
+}
+
+// WithHeader returns an option which keeps cells of first record verbatim,
+// e.g. header of table `id:int,name:string`
+func WithHeader() CSVOption {
+	return func(opt *csvOptions) {
+		opt.header = true
+	}
+}
+
+func applyCSVOptions(opts []CSVOption) csvOptions {
+	var opt csvOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+	return opt
+}
+
+// FromCSV converts CSV records to CSO nodes, one node per record.
+//
+// Each cell is converted as following:
+//
+//	empty             empty value
+//	1, -2.5, 'c'      number or char
+//	"abc"             string
+//	{1,2}, [a,b]      object or array, must be valid CSO
+//	true, false       ident
+//	name              string, or ident if WithInferIdent used
+//	other text        string
+func FromCSV(records [][]string, opts ...CSVOption) ([]Node, error) {
+	opt := applyCSVOptions(opts)
+	nodes := make([]Node, 0, len(records))
+	for i, record := range records {
+		line := newListNode(nopos, encoding.ObjectNode)
+		line.unbound = true
+		for j, cell := range record {
+			var (
+				child Node
+				err   error
+			)
+			if opt.header && i == 0 {
+				child = newLiteral(encoding.IdentNode, cell)
+			} else if child, err = parseCell(cell, opt); err != nil {
+				return nil, fmt.Errorf("cso: record %d field %d: %v", i+1, j+1, err)
+			}
+			line.addChild(child)
+		}
+		nodes = append(nodes, line)
+	}
+	return nodes, nil
+}
+
+// parseCell parses text of a CSV cell as a CSO value
+func parseCell(cell string, opt csvOptions) (Node, error) {
+	text := strings.TrimSpace(cell)
+	if text == "" {
+		return newLiteral(encoding.IdentNode, ""), nil
+	}
+	node, err := parseValue(text)
+	if err != nil {
+		if text[0] == '{' || text[0] == '[' || text[0] == '"' || text[0] == '\'' {
+			return nil, err
+		}
+		// plain text
+		return newLiteral(encoding.StringNode, strconv.Quote(cell)), nil
+	}
+	if node.Kind() == encoding.IdentNode && !opt.inferIdent && text != "true" && text != "false" {
+		return newLiteral(encoding.StringNode, strconv.Quote(cell)), nil
+	}
+	return node, nil
+}
+
+// parseValue parses text which should contain exactly one CSO value
+func parseValue(text string) (Node, error) {
+	s := initScanner(new(scanner.Scanner), strings.NewReader(text))
+	p := new(parser)
+	if err := p.init(s); err != nil {
+		return nil, err
+	}
+	if p.Tok == scanner.EOF {
+		return nil, fmt.Errorf("empty value")
+	}
+	node, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if p.Tok != scanner.EOF {
+		return nil, fmt.Errorf("unexpected `%s` at %v", p.Lit, p.TokPos)
+	}
+	if _, ok := node.(*literalNode); ok && len(p.Comments) > 0 {
+		return nil, fmt.Errorf("unexpected comment at %v", p.Comments[0].Pos())
+	}
+	return node, nil
+}
+
+// ToCSV converts CSO nodes to CSV records, one record per node.
+// Children of each node are written as cells: strings and chars are unquoted,
+// objects and arrays are written in CSO syntax.
+func ToCSV(nodes []Node, opts ...CSVOption) ([][]string, error) {
+	opt := applyCSVOptions(opts)
+	records := make([][]string, 0, len(nodes))
+	for i, node := range nodes {
+		record := make([]string, 0, node.NumChild())
+		for j := 0; j < node.NumChild(); j++ {
+			cell, err := formatCell(node.ByIndex(j), opt)
+			if err != nil {
+				return nil, fmt.Errorf("cso: record %d field %d: %v", i+1, j+1, err)
+			}
+			record = append(record, cell)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// formatCell formats node as text of a CSV cell, strings are quoted if
+// they would not be read back as the same string by FromCSV
+func formatCell(node Node, opt csvOptions) (string, error) {
+	lit, ok := node.(*literalNode)
+	if !ok {
+		var buf strings.Builder
+		err := node.output(&buf)
+		return buf.String(), err
+	}
+	if lit.Kind() != encoding.StringNode {
+		return lit.LiteralNode.Value, nil
+	}
+	text := lit.Value().(string)
+	if opt.quoteStrings {
+		return lit.LiteralNode.Value, nil
+	}
+	back, err := parseCell(text, opt)
+	if err != nil || back.Kind() != encoding.StringNode || back.Value().(string) != text {
+		return lit.LiteralNode.Value, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,62 @@
+package cso
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	for i, ts := range []struct {
+		record []string
+		cso    string
+		back   []string // records converted back, nil if same as record
+		opts   []CSVOption
+	}{
+		{[]string{"1", "-2.5", "'c'", ""}, `1,-2.5,'c',`, nil, nil},
+		{[]string{"sword", "hello world", `"quoted"`, "true"}, `"sword","hello world","quoted",true`,
+			[]string{"sword", "hello world", "quoted", "true"}, nil},
+		{[]string{"sword", "123", "{1,[a,b]}"}, `sword,123,{1,[a,b]}`, nil, []CSVOption{WithInferIdent()}},
+		{[]string{"id:int", "name"}, `id:int,name`, nil, []CSVOption{WithHeader()}},
+	} {
+		nodes, err := FromCSV([][]string{ts.record}, ts.opts...)
+		if err != nil {
+			t.Errorf("%dth: FromCSV error: %v", i, err)
+			continue
+		}
+		var buf bytes.Buffer
+		Write(&buf, nodes[0])
+		if got := buf.String(); got != ts.cso {
+			t.Errorf("%dth: want %s, but got %s", i, ts.cso, got)
+		}
+		records, err := ToCSV(nodes, ts.opts...)
+		if err != nil {
+			t.Errorf("%dth: ToCSV error: %v", i, err)
+			continue
+		}
+		want := ts.back
+		if want == nil {
+			want = ts.record
+		}
+		if !reflect.DeepEqual(records[0], want) {
+			t.Errorf("%dth: want %q, but got %q", i, want, records[0])
+		}
+	}
+
+	// strings which look like other values are quoted
+	nodes, _ := ReadBytes([]byte(`"123","true","a",""`))
+	records, _ := ToCSV(nodes)
+	if want := []string{`"123"`, `"true"`, "a", `""`}; !reflect.DeepEqual(records[0], want) {
+		t.Errorf("want %q, but got %q", want, records[0])
+	}
+	records, _ = ToCSV(nodes, WithQuoteStrings())
+	if want := []string{`"123"`, `"true"`, `"a"`, `""`}; !reflect.DeepEqual(records[0], want) {
+		t.Errorf("want %q, but got %q", want, records[0])
+	}
+
+	if _, err := FromCSV([][]string{{"1", "{1,2"}}); err == nil {
+		t.Errorf("want error for bad object, but got nil")
+	} else if want := "cso: record 1 field 2: expect `,`, but got EOF at <input>:1:5"; err.Error() != want {
+		t.Errorf("want error %q, but got %q", want, err)
+	}
+}
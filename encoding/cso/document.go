@@ -0,0 +1,147 @@
+package cso
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// ToValue converts node to format-neutral document value. Both objects and
+// arrays of CSO are converted to arrays since members of objects have no keys.
+func ToValue(node Node) *encoding.Value {
+	var v *encoding.Value
+	if lit, ok := node.(*literalNode); ok {
+		v = literalValue(lit)
+	} else {
+		v = encoding.NewArray()
+		for i := 0; i < node.NumChild(); i++ {
+			v.Elems = append(v.Elems, ToValue(node.ByIndex(i)))
+		}
+	}
+	v.Pos = node.Pos()
+	v.Doc = encoding.CommentLines(node.Doc())
+	v.Comment = strings.Join(encoding.CommentLines(node.Comment()), " ")
+	return v
+}
+
+func literalValue(lit *literalNode) *encoding.Value {
+	text := lit.LiteralNode.Value
+	switch lit.Kind() {
+	case encoding.IdentNode:
+		switch text {
+		case "":
+			return encoding.NewNull()
+		case "true", "false":
+			return encoding.NewBool(text == "true")
+		}
+		return encoding.NewString(text)
+	case encoding.IntNode:
+		if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return encoding.NewInt(i)
+		}
+		f, _ := strconv.ParseFloat(text, 64)
+		return encoding.NewFloat(f)
+	case encoding.FloatNode:
+		f, _ := strconv.ParseFloat(text, 64)
+		return encoding.NewFloat(f)
+	case encoding.StringNode:
+		return encoding.NewString(lit.Value().(string))
+	case encoding.CharNode:
+		return encoding.NewString(string(lit.Value().(rune)))
+	}
+	return encoding.NewNull()
+}
+
+// ToDocument converts lines to a document value which is an array of lines
+func ToDocument(nodes []Node) *encoding.Value {
+	doc := encoding.NewArray()
+	for _, node := range nodes {
+		doc.Elems = append(doc.Elems, ToValue(node))
+	}
+	return doc
+}
+
+// FromValue converts format-neutral document value to node, keys of objects are dropped,
+// infinities and NaN are converted to strings.
+// Comments are written as block comments since a line comment would end the line.
+func FromValue(v *encoding.Value) Node {
+	var node Node
+	switch v.Kind {
+	case encoding.ObjectValue:
+		list := newListNode(nopos, encoding.ObjectNode)
+		for _, f := range v.Fields {
+			list.addChild(FromValue(f.Value))
+		}
+		node = list
+	case encoding.ArrayValue:
+		list := newListNode(nopos, encoding.ArrayNode)
+		for _, elem := range v.Elems {
+			list.addChild(FromValue(elem))
+		}
+		node = list
+	case encoding.BoolValue:
+		node = newLiteral(encoding.IdentNode, strconv.FormatBool(v.Bool))
+	case encoding.IntValue:
+		node = newLiteral(encoding.IntNode, strconv.FormatInt(v.Int, 10))
+	case encoding.FloatValue:
+		if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+			node = newLiteral(encoding.StringNode, strconv.Quote(encoding.FormatFloat(v.Float)))
+		} else {
+			node = newLiteral(encoding.FloatNode, encoding.FormatFloat(v.Float))
+		}
+	case encoding.StringValue:
+		node = newLiteral(encoding.StringNode, strconv.Quote(v.String))
+	default:
+		node = newLiteral(encoding.IdentNode, "")
+	}
+	node.SetDoc(blockComment(v.Doc))
+	if v.Comment != "" {
+		node.SetComment(blockComment([]string{v.Comment}))
+	}
+	return node
+}
+
+func blockComment(lines []string) *encoding.CommentGroup {
+	if len(lines) == 0 {
+		return nil
+	}
+	text := "/* " + strings.Replace(strings.Join(lines, " "), "*/", "* /", -1) + " */"
+	return &encoding.CommentGroup{List: []*encoding.Comment{{Text: text}}}
+}
+
+// FromDocument converts document value to lines, each element of array is a line.
+// Objects and arrays are written as lines without braces, other values as lines
+// with single value.
+func FromDocument(doc *encoding.Value) []Node {
+	var elems []*encoding.Value
+	switch doc.Kind {
+	case encoding.ArrayValue:
+		elems = doc.Elems
+	case encoding.ObjectValue:
+		for _, f := range doc.Fields {
+			elems = append(elems, f.Value)
+		}
+	default:
+		elems = []*encoding.Value{doc}
+	}
+	nodes := make([]Node, 0, len(elems))
+	for _, elem := range elems {
+		line, ok := FromValue(elem).(*listNode)
+		if !ok {
+			line = newListNode(nopos, encoding.ObjectNode)
+			value := *elem
+			value.Doc, value.Comment = nil, ""
+			line.addChild(FromValue(&value))
+		}
+		line.kind = encoding.ObjectNode
+		line.unbound = true
+		line.SetDoc(encoding.NewCommentGroup(elem.Doc))
+		if elem.Comment != "" {
+			line.SetComment(encoding.NewCommentGroup([]string{elem.Comment}))
+		}
+		nodes = append(nodes, line)
+	}
+	return nodes
+}
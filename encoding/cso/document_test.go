@@ -0,0 +1,56 @@
+package cso
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+func TestDocument(t *testing.T) {
+	nodes, err := ReadBytes([]byte("// first\n1,abc,true,,{1.5,'c'} // line\n[x]"))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	doc := ToDocument(nodes)
+	line := doc.Elems[0]
+	if len(line.Doc) != 1 || line.Doc[0] != "first" || line.Comment != "line" {
+		t.Errorf("unexpected comments of line: %q, %q", line.Doc, line.Comment)
+	}
+	for i, ts := range []struct {
+		path []string
+		kind encoding.ValueKind
+		want interface{}
+	}{
+		{[]string{"0", "0"}, encoding.IntValue, int64(1)},
+		{[]string{"0", "1"}, encoding.StringValue, "abc"},
+		{[]string{"0", "2"}, encoding.BoolValue, true},
+		{[]string{"0", "3"}, encoding.NullValue, nil},
+		{[]string{"0", "4", "1"}, encoding.StringValue, "c"},
+		{[]string{"1", "0", "0"}, encoding.StringValue, "x"},
+	} {
+		got := doc.Lookup(ts.path...)
+		if got == nil || got.Kind != ts.kind || got.Interface() != ts.want {
+			t.Errorf("%dth: want %v %v, but got %+v", i, ts.kind, ts.want, got)
+		}
+	}
+
+	obj := encoding.NewObject()
+	obj.Set("a", encoding.NewInt(1))
+	b := encoding.NewString("x")
+	b.Doc = []string{"doc of b"}
+	obj.Set("b", b)
+	doc.Elems = append(doc.Elems, obj)
+	var buf strings.Builder
+	if err := WriteAll(&buf, FromDocument(doc)); err != nil {
+		t.Fatalf("WriteAll error: %v", err)
+	}
+	want := `// first
+1,"abc",true,,[1.5,"c"] // line
+["x"]
+1,/* doc of b */ "x"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
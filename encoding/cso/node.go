@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"text/scanner"
 
 	"github.com/mkideal/pkg/encoding"
@@ -18,14 +19,64 @@ type Node interface {
 	ByIndex(i int) Node
 	// Value returns value of node as an interface
 	Value() interface{}
+	// Doc returns comments before node, for a line they are comment lines
+	// before the line
+	Doc() *encoding.CommentGroup
+	// Comment returns comments after node, for a line it's the line comment
+	Comment() *encoding.CommentGroup
+	// SetDoc sets doc comments
+	SetDoc(doc *encoding.CommentGroup)
+	// SetComment sets comments after node
+	SetComment(comment *encoding.CommentGroup)
 
 	// output writes Node to writer
 	output(w io.Writer) error
 }
 
+// commentbase holds comments of node
+type commentbase struct {
+	doc     *encoding.CommentGroup
+	comment *encoding.CommentGroup
+}
+
+func (n commentbase) Doc() *encoding.CommentGroup                { return n.doc }
+func (n commentbase) Comment() *encoding.CommentGroup            { return n.comment }
+func (n *commentbase) SetDoc(doc *encoding.CommentGroup)         { n.doc = doc }
+func (n *commentbase) SetComment(comment *encoding.CommentGroup) { n.comment = comment }
+
+// outputDoc writes doc comments before an inline node
+func (n commentbase) outputDoc(w io.Writer) error {
+	if n.doc == nil || len(n.doc.List) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprint(w, n.doc.Text(), " ")
+	return err
+}
+
+// outputComment writes comments after node
+func (n commentbase) outputComment(w io.Writer) error {
+	if n.comment == nil || len(n.comment.List) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprint(w, " ", n.comment.Text())
+	return err
+}
+
+// joinComments joins two comment groups
+func joinComments(x, y *encoding.CommentGroup) *encoding.CommentGroup {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	return &encoding.CommentGroup{List: append(append([]*encoding.Comment(nil), x.List...), y.List...)}
+}
+
 // literalNode implements Node interface
 type literalNode struct {
 	encoding.LiteralNode
+	commentbase
 }
 
 func newLiteralNode(pos scanner.Position, tok rune, value string) (*literalNode, error) {
@@ -55,7 +106,7 @@ func (n literalNode) ByIndex(i int) Node { panic("no child") }
 func (n literalNode) Value() interface{} {
 	switch n.Kind() {
 	case encoding.CharNode:
-		value, _, _, _ := strconv.UnquoteChar(n.LiteralNode.Value, '\'')
+		value, _, _, _ := strconv.UnquoteChar(strings.TrimPrefix(n.LiteralNode.Value, "'"), '\'')
 		return value
 	case encoding.StringNode:
 		value, _ := strconv.Unquote(n.LiteralNode.Value)
@@ -74,15 +125,23 @@ func (n literalNode) Value() interface{} {
 }
 
 func (n *literalNode) output(w io.Writer) error {
-	_, err := fmt.Fprint(w, n.LiteralNode.Value)
-	return err
+	if err := n.outputDoc(w); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, n.LiteralNode.Value); err != nil {
+		return err
+	}
+	return n.outputComment(w)
 }
 
 // listNode represents object or array
 type listNode struct {
 	encoding.Nodebase
+	commentbase
 	kind     encoding.NodeKind // ObjectNode or ArrayNode
 	children []Node
+	unbound  bool                   // top-level list of a line which has no braces
+	inner    *encoding.CommentGroup // comments in empty list, e.g. [ /* empty */ ]
 }
 
 func newListNode(pos scanner.Position, kind encoding.NodeKind) *listNode {
@@ -117,8 +176,27 @@ func (n *listNode) output(w io.Writer) error {
 	if n.kind == encoding.ObjectNode {
 		openTok, closeTok = opLBrace, opRBrace
 	}
-	if _, err := fmt.Fprint(w, string(openTok)); err != nil {
-		return err
+	if n.unbound {
+		// comment lines before the line
+		if n.doc != nil {
+			for _, c := range n.doc.List {
+				if _, err := fmt.Fprintln(w, c.Text); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		if err := n.outputDoc(w); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprint(w, string(openTok)); err != nil {
+			return err
+		}
+		if len(n.children) == 0 && n.inner != nil && len(n.inner.List) > 0 {
+			if _, err := fmt.Fprint(w, " ", n.inner.Text(), " "); err != nil {
+				return err
+			}
+		}
 	}
 	for i, child := range n.children {
 		if i > 0 {
@@ -130,6 +208,14 @@ func (n *listNode) output(w io.Writer) error {
 			return err
 		}
 	}
-	_, err := fmt.Fprint(w, string(closeTok))
-	return err
+	if !n.unbound {
+		if _, err := fmt.Fprint(w, string(closeTok)); err != nil {
+			return err
+		}
+	} else if len(n.children) == 0 && n.comment != nil {
+		// comment-only line
+		_, err := fmt.Fprint(w, n.comment.Text())
+		return err
+	}
+	return n.outputComment(w)
 }
@@ -1,7 +1,6 @@
 package cso
 
 import (
-	"fmt"
 	"text/scanner"
 
 	"github.com/mkideal/pkg/encoding"
@@ -20,23 +19,31 @@ const (
 // parser parses json
 type parser struct {
 	encoding.Parser
+	comments *encoding.CommentGroup // comments before current token
 }
 
 func (p *parser) init(s *scanner.Scanner) error {
 	p.Init(s)
+	p.Comments = nil
 	return p.Next()
 }
 
+// Next moves to next token and saves comments before the token
+func (p *parser) Next() error {
+	n := len(p.Comments)
+	err := p.Parser.Next()
+	p.comments = nil
+	for _, g := range p.Comments[n:] {
+		p.comments = joinComments(p.comments, g)
+	}
+	return err
+}
+
 func (p *parser) expect(tok rune) error {
 	if p.Tok == tok {
 		return p.Next() // make progress
 	}
-	lit := "`" + p.Lit + "`"
-	if p.Tok == scanner.EOF {
-		lit = "EOF"
-	}
-	err := fmt.Errorf("expect `%s`, but got %s at %s", string(tok), lit, p.Pos)
-	return err
+	return p.ErrorExpected(p.TokPos, "`"+string(tok)+"`")
 }
 
 func (p *parser) parseNode() (Node, error) {
@@ -50,9 +57,9 @@ func (p *parser) parseNode() (Node, error) {
 	case opSub:
 		return p.parseSignNode(opSub)
 	default:
-		n, err := newLiteralNode(p.Pos, p.Tok, p.Lit)
+		n, err := newLiteralNode(p.TokPos, p.Tok, p.Lit)
 		if err != nil {
-			return nil, err
+			return nil, p.Errorf(p.TokPos, "unexpected begin of json node %v", p.Lit)
 		}
 		err = p.Next()
 		return n, err
@@ -60,17 +67,14 @@ func (p *parser) parseNode() (Node, error) {
 }
 
 func (p *parser) parseSignNode(pfxTok rune) (Node, error) {
+	pos := p.TokPos
 	if err := p.Next(); err != nil {
 		return nil, err
 	}
-	lit := "`" + p.Lit + "`"
-	if p.Tok == scanner.EOF {
-		lit = "EOF"
-	}
 	if p.Tok != scanner.Float && p.Tok != scanner.Int {
-		return nil, fmt.Errorf("expect float or integer, but got %v at %v", lit, p.Pos)
+		return nil, p.ErrorExpected(p.TokPos, "float or integer")
 	}
-	node, err := newLiteralNode(p.Pos, p.Tok, p.Lit)
+	node, err := newLiteralNode(pos, p.Tok, p.Lit)
 	if err != nil {
 		return nil, err
 	}
@@ -88,36 +92,47 @@ func (p *parser) parseArrayNode() (Node, error) {
 }
 
 func (p *parser) parseListNode(kind encoding.NodeKind, openTok, closeTok rune, bound bool) (Node, error) {
-	pos := p.Pos
+	pos := p.TokPos
 	if bound {
 		if err := p.expect(openTok); err != nil {
 			return nil, err
 		}
 	}
 	list := newListNode(pos, kind)
+	list.unbound = !bound
 	for p.Tok != scanner.EOF && p.Tok != closeTok {
 		// add empty node
 		// e.g. {,,,}
 		for p.Tok == opComma {
-			child, err := newLiteralNode(p.Pos, scanner.Ident, "")
+			child, err := newLiteralNode(p.TokPos, scanner.Ident, "")
 			if err != nil {
 				return nil, err
 			}
+			child.SetDoc(p.comments)
 			list.addChild(child)
 			p.Next()
 		}
-		if p.Tok == closeTok {
-			child, err := newLiteralNode(p.Pos, scanner.Ident, "")
+		if p.Tok == closeTok || (!bound && p.Tok == scanner.EOF) {
+			child, err := newLiteralNode(p.TokPos, scanner.Ident, "")
 			if err != nil {
 				return nil, err
 			}
+			if p.Tok == closeTok {
+				child.SetDoc(p.comments)
+			}
 			list.addChild(child)
 			break
 		}
+		doc := p.comments
 		child, err := p.parseNode()
 		if err != nil {
 			return nil, err
 		}
+		child.SetDoc(doc)
+		if bound || p.Tok != scanner.EOF {
+			// comments between child and comma or close token
+			child.SetComment(joinComments(child.Comment(), p.comments))
+		}
 		if p.Tok != closeTok {
 			if err := p.expect(opComma); err != nil {
 				if bound || p.Tok != scanner.EOF {
@@ -128,9 +143,16 @@ func (p *parser) parseListNode(kind encoding.NodeKind, openTok, closeTok rune, b
 		list.addChild(child)
 	}
 	if bound {
+		if list.NumChild() == 0 {
+			// comments in empty list
+			list.inner = p.comments
+		}
 		if err := p.expect(closeTok); err != nil {
 			return nil, err
 		}
+	} else {
+		// line comment
+		list.SetComment(p.comments)
 	}
 	return list, nil
 }
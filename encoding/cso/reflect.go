@@ -0,0 +1,410 @@
+package cso
+
+import (
+	"bytes"
+	stdencoding "encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"time"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// Unmarshal parses a line of CSO and stores values into v which should be a pointer
+// to struct, slice or array.
+//
+// Values of line are mapped onto fields of struct in declaration order, or by
+// index specified by tag `cso:"index"` or `cso:"name,index"`. Fields tagged `cso:"-"` are ignored.
+// Objects `{...}` are decoded into nested structs, arrays `[...]` into slices or arrays.
+// Empty values leave fields unchanged.
+//
+// e.g.
+//
+//	type Item struct {
+//		Id    int
+//		Name  string
+//		Pos   struct{ X, Y float64 }
+//		Tags  []string
+//		Price int `cso:"5"`
+//	}
+//
+//	var item Item
+//	cso.Unmarshal([]byte(`1,"sword",{1.5,2},[a,b],,100`), &item)
+func Unmarshal(data []byte, v interface{}) error {
+	node, err := Read(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return UnmarshalNode(node, v)
+}
+
+// UnmarshalNode stores values of node into v, see Unmarshal
+func UnmarshalNode(node Node, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cso: Unmarshal(non-pointer %v)", reflect.TypeOf(v))
+	}
+	return decodeValue(node, rv.Elem(), "")
+}
+
+// Marshal encodes v as a line of CSO, v should be a struct, slice or array
+func Marshal(v interface{}) ([]byte, error) {
+	node, err := MarshalNode(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalNode encodes v as a node of line, see Marshal
+func MarshalNode(v interface{}) (Node, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+	default:
+		return nil, fmt.Errorf("cso: Marshal(unsupported type %v)", reflect.TypeOf(v))
+	}
+	node, err := encodeValue(rv)
+	if err != nil {
+		return nil, err
+	}
+	list := node.(*listNode)
+	list.kind = encoding.ObjectNode
+	list.unbound = true
+	return list, nil
+}
+
+// UnmarshalTypeError describes a CSO value that was not appropriate for a value of a specific Go type
+type UnmarshalTypeError struct {
+	Value string       // description of CSO value
+	Type  reflect.Type // type of Go value it could not be assigned to
+	Field string       // full path of field
+	Pos   scanner.Position
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	s := "cso: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Field != "" {
+		s += " (field " + e.Field + ")"
+	}
+	return s + " at " + e.Pos.String()
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*stdencoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*stdencoding.TextMarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// field represents a field of struct mapped to an index of list
+type field struct {
+	index int   // index in list
+	path  []int // index of field in struct
+	name  string
+	key   string // column name specified by tag
+}
+
+// parseTag parses tag `cso:"[name][,index]"`, index defaults to next
+func parseTag(tag string, next int) (index int, key string, err error) {
+	index = next
+	for i, part := range strings.Split(tag, ",") {
+		if part == "" {
+			continue
+		}
+		if n, e := strconv.Atoi(part); e == nil && n >= 0 {
+			index = n
+		} else if i == 0 && !strings.ContainsAny(part[:1], "+-0123456789") {
+			key = part
+		} else {
+			return 0, "", fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	return
+}
+
+// structFields returns fields of struct type t ordered by index
+func structFields(t reflect.Type) ([]field, error) {
+	var (
+		fields []field
+		used   = make(map[int]string)
+		next   = 0
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag := f.Tag.Get("cso")
+		if tag == "-" {
+			continue
+		}
+		index, key, err := parseTag(tag, next)
+		if err != nil {
+			return nil, fmt.Errorf("cso: invalid tag %q of field %s.%s", tag, t, f.Name)
+		}
+		if name, dup := used[index]; dup {
+			return nil, fmt.Errorf("cso: fields %s and %s of %s have the same index %d", name, f.Name, t, index)
+		}
+		used[index] = f.Name
+		next = index + 1
+		fields = append(fields, field{index: index, path: f.Index, name: f.Name, key: key})
+	}
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && fields[j].index < fields[j-1].index; j-- {
+			fields[j], fields[j-1] = fields[j-1], fields[j]
+		}
+	}
+	return fields, nil
+}
+
+func isEmptyNode(node Node) bool {
+	lit, ok := node.(*literalNode)
+	return ok && lit.Kind() == encoding.IdentNode && lit.LiteralNode.Value == ""
+}
+
+func describeNode(node Node) string {
+	switch node.Kind() {
+	case encoding.ObjectNode:
+		return "object"
+	case encoding.ArrayNode:
+		return "array"
+	}
+	return strings.TrimSuffix(strings.ToLower(node.Kind().String()), "node") + " " + node.(*literalNode).LiteralNode.Value
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func decodeValue(node Node, v reflect.Value, path string) error {
+	if isEmptyNode(node) {
+		return nil
+	}
+	typeError := func() error {
+		return &UnmarshalTypeError{Value: describeNode(node), Type: v.Type(), Field: path, Pos: node.Pos()}
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(node, v.Elem(), path)
+	}
+	if v.CanAddr() && v.Type() != durationType && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		text, ok := literalText(node)
+		if !ok {
+			return typeError()
+		}
+		if err := v.Addr().Interface().(stdencoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return fmt.Errorf("cso: %v (field %s) at %v", err, path, node.Pos())
+		}
+		return nil
+	}
+
+	lit, _ := node.(*literalNode)
+	switch v.Kind() {
+	case reflect.Struct:
+		if lit != nil {
+			return typeError()
+		}
+		fields, err := structFields(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if f.index >= node.NumChild() {
+				break
+			}
+			if err := decodeValue(node.ByIndex(f.index), v.FieldByIndex(f.path), joinField(path, f.name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if lit != nil {
+			return typeError()
+		}
+		n := node.NumChild()
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := decodeValue(node.ByIndex(i), s.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		if lit != nil {
+			return typeError()
+		}
+		for i := 0; i < v.Len() && i < node.NumChild(); i++ {
+			if err := decodeValue(node.ByIndex(i), v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return typeError()
+		}
+		v.Set(reflect.ValueOf(node.Value()))
+	case reflect.Bool:
+		if lit == nil {
+			return typeError()
+		}
+		switch lit.LiteralNode.Value {
+		case "true", "1":
+			v.SetBool(true)
+		case "false", "0":
+			v.SetBool(false)
+		default:
+			return typeError()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if lit == nil {
+			return typeError()
+		}
+		if v.Type() == durationType && lit.Kind() == encoding.StringNode {
+			d, err := time.ParseDuration(lit.Value().(string))
+			if err != nil {
+				return fmt.Errorf("cso: %v (field %s) at %v", err, path, node.Pos())
+			}
+			v.SetInt(int64(d))
+			break
+		}
+		if lit.Kind() != encoding.IntNode {
+			return typeError()
+		}
+		i, err := strconv.ParseInt(lit.LiteralNode.Value, 0, 64)
+		if err != nil || v.OverflowInt(i) {
+			return typeError()
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if lit == nil || lit.Kind() != encoding.IntNode {
+			return typeError()
+		}
+		u, err := strconv.ParseUint(strings.TrimPrefix(lit.LiteralNode.Value, "+"), 0, 64)
+		if err != nil || v.OverflowUint(u) {
+			return typeError()
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if lit == nil || (lit.Kind() != encoding.IntNode && lit.Kind() != encoding.FloatNode) {
+			return typeError()
+		}
+		f, err := strconv.ParseFloat(lit.LiteralNode.Value, v.Type().Bits())
+		if err != nil || v.OverflowFloat(f) {
+			return typeError()
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		text, ok := literalText(node)
+		if !ok {
+			return typeError()
+		}
+		v.SetString(text)
+	default:
+		return typeError()
+	}
+	return nil
+}
+
+// literalText returns text of literal node, strings and chars are unquoted
+func literalText(node Node) (string, bool) {
+	lit, ok := node.(*literalNode)
+	if !ok {
+		return "", false
+	}
+	switch lit.Kind() {
+	case encoding.StringNode:
+		return lit.Value().(string), true
+	case encoding.CharNode:
+		return string(lit.Value().(rune)), true
+	default:
+		return lit.LiteralNode.Value, true
+	}
+}
+
+var nopos scanner.Position
+
+func newLiteral(kind encoding.NodeKind, value string) *literalNode {
+	n := &literalNode{LiteralNode: encoding.NewLiteralNode(nopos, kind)}
+	n.LiteralNode.Value = value
+	return n
+}
+
+func encodeValue(v reflect.Value) (Node, error) {
+	if !v.IsValid() {
+		return newLiteral(encoding.IdentNode, ""), nil
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return newLiteral(encoding.IdentNode, ""), nil
+		}
+		return encodeValue(v.Elem())
+	}
+	if v.Type() == durationType {
+		return newLiteral(encoding.StringNode, strconv.Quote(time.Duration(v.Int()).String())), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(stdencoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return newLiteral(encoding.StringNode, strconv.Quote(string(text))), nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		fields, err := structFields(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		list := newListNode(nopos, encoding.ObjectNode)
+		for _, f := range fields {
+			for len(list.children) < f.index {
+				list.addChild(newLiteral(encoding.IdentNode, ""))
+			}
+			child, err := encodeValue(v.FieldByIndex(f.path))
+			if err != nil {
+				return nil, err
+			}
+			list.addChild(child)
+		}
+		return list, nil
+	case reflect.Slice, reflect.Array:
+		list := newListNode(nopos, encoding.ArrayNode)
+		for i := 0; i < v.Len(); i++ {
+			child, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list.addChild(child)
+		}
+		return list, nil
+	case reflect.Bool:
+		return newLiteral(encoding.IdentNode, strconv.FormatBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return newLiteral(encoding.IntNode, strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return newLiteral(encoding.IntNode, strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+		if strings.ContainsAny(s, "IN") {
+			// Inf or NaN
+			return nil, fmt.Errorf("cso: unsupported value %s", s)
+		}
+		return newLiteral(encoding.FloatNode, s), nil
+	case reflect.String:
+		return newLiteral(encoding.StringNode, strconv.Quote(v.String())), nil
+	default:
+		return nil, fmt.Errorf("cso: unsupported type %v", v.Type())
+	}
+}
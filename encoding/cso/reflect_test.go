@@ -0,0 +1,71 @@
+package cso
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testPos struct {
+	X, Y float64
+}
+
+type testItem struct {
+	Id      int
+	Name    string
+	Pos     testPos
+	Tags    []string
+	Hidden  string `cso:"-"`
+	Price   uint32 `cso:"5"`
+	Enabled bool
+	Cooling time.Duration
+	Owner   *testPos
+}
+
+func TestUnmarshal(t *testing.T) {
+	var item testItem
+	err := Unmarshal([]byte(`1,"sword",{1.5,-2},[a,"b c"],,100,true,"1.5s",{3,4}`), &item)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	want := testItem{
+		Id:      1,
+		Name:    "sword",
+		Pos:     testPos{1.5, -2},
+		Tags:    []string{"a", "b c"},
+		Price:   100,
+		Enabled: true,
+		Cooling: 1500 * time.Millisecond,
+		Owner:   &testPos{3, 4},
+	}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("want %+v, but got %+v", want, item)
+	}
+
+	data, err := Marshal(&item)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if got, want := string(data), `1,"sword",{1.5,-2},["a","b c"],,100,true,"1.5s",{3,4}`; got != want {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+
+	for i, ts := range []struct {
+		src string
+		err string
+	}{
+		{`x`, "cso: cannot unmarshal ident x into Go value of type int (field Id) at <input>:1:1"},
+		{`1,{}`, "cso: cannot unmarshal object into Go value of type string (field Name) at <input>:1:3"},
+		{`1,"a",{1,x}`, "cso: cannot unmarshal ident x into Go value of type float64 (field Pos.Y) at <input>:1:10"},
+		{`1,"a",{},[1,{}]`, "cso: cannot unmarshal object into Go value of type string (field Tags[1]) at <input>:1:13"},
+		{`1,"a",{},[],,-1`, "cso: cannot unmarshal int -1 into Go value of type uint32 (field Price) at <input>:1:14"},
+	} {
+		var item testItem
+		err := Unmarshal([]byte(ts.src), &item)
+		if err == nil {
+			t.Errorf("%dth: want error, but got nil", i)
+		} else if err.Error() != ts.err {
+			t.Errorf("%dth: want error %q, but got %q", i, ts.err, err)
+		}
+	}
+}
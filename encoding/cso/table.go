@@ -0,0 +1,449 @@
+package cso
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
+)
+
+// Table file format
+//
+// The first line of table declares columns, each column has a name and an optional type.
+// Each subsequent non-empty line is a row.
+//
+//	id:int,name:string,pos:{float,float},tags:[string],extra
+//	1,"sword",{1.5,2},[a,b],
+//	2,"shield",{0,0},[],{1,2}
+//
+// types:
+//	int, uint, float, string, bool, char, any
+//	[T]        array of T
+//	{T1,T2...} object with fields T1,T2...
+//
+// type of column defaults to any.
+
+// Type represents type of column
+type Type struct {
+	Name   string  // name of basic type, empty for array and object
+	Elem   *Type   // element type of array
+	Fields []*Type // field types of object
+}
+
+var basicTypes = map[string]bool{
+	"int":    true,
+	"uint":   true,
+	"float":  true,
+	"string": true,
+	"bool":   true,
+	"char":   true,
+	"any":    true,
+}
+
+var anyType = &Type{Name: "any"}
+
+// IsArray reports whether t is an array type
+func (t *Type) IsArray() bool { return t.Elem != nil }
+
+// IsObject reports whether t is an object type
+func (t *Type) IsObject() bool { return t.Name == "" && t.Elem == nil }
+
+func (t *Type) String() string {
+	if t.IsArray() {
+		return "[" + t.Elem.String() + "]"
+	}
+	if t.IsObject() {
+		fields := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			fields[i] = f.String()
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	}
+	return t.Name
+}
+
+// check checks whether node matches type t
+func (t *Type) check(node Node) error {
+	if isEmptyNode(node) || t.Name == "any" {
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("expect %v, but got %s at %v", t, describeNode(node), node.Pos())
+	}
+	if t.IsArray() {
+		if node.Kind() != encoding.ArrayNode {
+			return mismatch()
+		}
+		for i := 0; i < node.NumChild(); i++ {
+			if err := t.Elem.check(node.ByIndex(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if t.IsObject() {
+		if node.Kind() != encoding.ObjectNode {
+			return mismatch()
+		}
+		if node.NumChild() > len(t.Fields) {
+			child := node.ByIndex(len(t.Fields))
+			return fmt.Errorf("too many values for %v at %v", t, child.Pos())
+		}
+		for i := 0; i < node.NumChild(); i++ {
+			if err := t.Fields[i].check(node.ByIndex(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	lit, ok := node.(*literalNode)
+	if !ok {
+		return mismatch()
+	}
+	var valid bool
+	switch t.Name {
+	case "int":
+		valid = lit.Kind() == encoding.IntNode
+	case "uint":
+		valid = lit.Kind() == encoding.IntNode && !strings.HasPrefix(lit.LiteralNode.Value, "-")
+	case "float":
+		valid = lit.Kind() == encoding.IntNode || lit.Kind() == encoding.FloatNode
+	case "string":
+		valid = lit.Kind() == encoding.StringNode || lit.Kind() == encoding.IdentNode
+	case "bool":
+		valid = lit.Kind() == encoding.IdentNode && (lit.LiteralNode.Value == "true" || lit.LiteralNode.Value == "false")
+	case "char":
+		valid = lit.Kind() == encoding.CharNode
+	}
+	if !valid {
+		return mismatch()
+	}
+	return nil
+}
+
+// Column represents a column of table
+type Column struct {
+	Name string
+	Type *Type
+	Pos  scanner.Position
+}
+
+// String returns column declaration, e.g. `id:int`
+func (c Column) String() string {
+	name := c.Name
+	if node, err := parseValue(name); err != nil || node.Kind() != encoding.IdentNode {
+		name = strconv.Quote(name)
+	}
+	return name + ":" + c.Type.String()
+}
+
+// parseColumns parses header line of table
+func (p *parser) parseColumns() ([]Column, error) {
+	var (
+		columns []Column
+		names   = make(map[string]bool)
+	)
+	for p.Tok != scanner.EOF {
+		pos := p.TokPos
+		name := p.Lit
+		switch p.Tok {
+		case scanner.Ident:
+		case scanner.String:
+			name, _ = strconv.Unquote(p.Lit)
+		default:
+			return nil, p.ErrorExpected(p.TokPos, "column name")
+		}
+		if name == "" || names[name] {
+			return nil, p.Errorf(pos, "invalid or duplicated column name %q", name)
+		}
+		names[name] = true
+		if err := p.Next(); err != nil {
+			return nil, err
+		}
+		typ := anyType
+		if p.Tok == ':' {
+			if err := p.Next(); err != nil {
+				return nil, err
+			}
+			var err error
+			if typ, err = p.parseType(); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, Column{Name: name, Type: typ, Pos: pos})
+		if p.Tok != scanner.EOF {
+			if err := p.expect(opComma); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, p.Errorf(p.TokPos, "missing table header")
+	}
+	return columns, nil
+}
+
+func (p *parser) parseType() (*Type, error) {
+	switch p.Tok {
+	case scanner.Ident:
+		if !basicTypes[p.Lit] {
+			return nil, p.Errorf(p.TokPos, "unknown type %s", p.Lit)
+		}
+		t := &Type{Name: p.Lit}
+		return t, p.Next()
+	case opLBrack:
+		if err := p.Next(); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Elem: elem}, p.expect(opRBrack)
+	case opLBrace:
+		if err := p.Next(); err != nil {
+			return nil, err
+		}
+		t := &Type{}
+		for p.Tok != opRBrace {
+			field, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			t.Fields = append(t.Fields, field)
+			if p.Tok != opRBrace {
+				if err := p.expect(opComma); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return t, p.expect(opRBrace)
+	}
+	return nil, p.ErrorExpected(p.TokPos, "type")
+}
+
+// TableReader reads rows of table one by one
+//
+//	t, err := cso.NewTableReader(r)
+//	if err != nil {
+//		return err
+//	}
+//	for t.Next() {
+//		var item Item
+//		if err := t.Decode(&item); err != nil {
+//			return err
+//		}
+//	}
+//	// t.Err() returns an *errors.ErrorList containing bad rows
+//	return t.Err()
+type TableReader struct {
+	lr      *lineReader
+	s       *scanner.Scanner
+	p       *parser
+	columns []Column
+	row     Node
+	line    int
+	errs    errors.ErrorList
+	fields  map[reflect.Type][][]int // cache of column to field mapping
+}
+
+// NewTableReader creates a TableReader and reads header of table from r
+func NewTableReader(r io.Reader) (*TableReader, error) {
+	return newTableReader(&lineReader{reader: r})
+}
+
+func newTableReader(lr *lineReader) (*TableReader, error) {
+	t := &TableReader{
+		lr:     lr,
+		s:      new(scanner.Scanner),
+		p:      new(parser),
+		fields: make(map[reflect.Type][][]int),
+	}
+	// skip empty and comment lines before header
+	for {
+		lr.reset()
+		initScanner(t.s, lr)
+		t.s.Filename = lr.filename
+		t.p.SetBase(lr.base())
+		if err := t.p.init(t.s); err != nil {
+			return nil, err
+		}
+		if t.p.Tok != scanner.EOF || lr.eof {
+			break
+		}
+	}
+	columns, err := t.p.parseColumns()
+	if err != nil {
+		return nil, lr.fillSource(err)
+	}
+	t.columns = columns
+	return t, lr.skipLine()
+}
+
+// Columns returns columns declared by header
+func (t *TableReader) Columns() []Column { return t.columns }
+
+// Next reads next valid row, bad rows are skipped and recorded.
+// It returns false if no more rows.
+func (t *TableReader) Next() bool {
+	t.row = nil
+	var doc *encoding.CommentGroup
+	for !t.lr.eof {
+		t.lr.reset()
+		row, err := readLine(t.p, t.s, t.lr)
+		if err != nil {
+			t.errs.Add(err)
+			if err := t.lr.skipLine(); err != nil {
+				t.errs.Add(err)
+				return false
+			}
+			doc = nil
+			continue
+		}
+		if isCommentLine(row) {
+			doc = joinComments(doc, row.Comment())
+			continue
+		}
+		if row.NumChild() == 0 {
+			// empty line
+			continue
+		}
+		if err := t.check(row); err != nil {
+			t.errs.Add(err)
+			doc = nil
+			continue
+		}
+		row.SetDoc(doc)
+		t.row = row
+		t.line = t.lr.line
+		return true
+	}
+	return false
+}
+
+func (t *TableReader) check(row Node) error {
+	if row.NumChild() > len(t.columns) {
+		child := row.ByIndex(len(t.columns))
+		return fmt.Errorf("row has %d values, but table has %d columns at %v", row.NumChild(), len(t.columns), child.Pos())
+	}
+	for i := 0; i < row.NumChild(); i++ {
+		if err := t.columns[i].Type.check(row.ByIndex(i)); err != nil {
+			return fmt.Errorf("column %s: %v", t.columns[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Row returns current row
+func (t *TableReader) Row() Node { return t.row }
+
+// Line returns line number of current row
+func (t *TableReader) Line() int { return t.line }
+
+// Err returns errors of bad rows as an *errors.ErrorList, nil if no error
+func (t *TableReader) Err() error { return t.errs.Err() }
+
+// Decode stores values of current row into v which should be a pointer to struct.
+// Columns are mapped onto fields by name specified by tag `cso:"name"`
+// or by field name case-insensitively. Columns without field are ignored.
+func (t *TableReader) Decode(v interface{}) error {
+	if t.row == nil {
+		return fmt.Errorf("cso: Decode called without row")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cso: Decode(non-pointer %v)", reflect.TypeOf(v))
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cso: Decode(non-struct %v)", rv.Type())
+	}
+	paths, err := t.columnFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for i := 0; i < t.row.NumChild(); i++ {
+		if paths[i] == nil {
+			continue
+		}
+		if err := decodeValue(t.row.ByIndex(i), rv.FieldByIndex(paths[i]), t.columns[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnFields returns index path of field for each column
+func (t *TableReader) columnFields(typ reflect.Type) ([][]int, error) {
+	if paths, ok := t.fields[typ]; ok {
+		return paths, nil
+	}
+	fields, err := structFields(typ)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([][]int, len(t.columns))
+	for i, c := range t.columns {
+		for _, f := range fields {
+			if f.key == c.Name || (f.key == "" && strings.EqualFold(f.name, c.Name)) {
+				paths[i] = f.path
+				break
+			}
+		}
+	}
+	t.fields[typ] = paths
+	return paths, nil
+}
+
+// ReadTable reads all rows of table from r into v which should be a pointer to slice of struct.
+// Valid rows are stored even if some rows are bad, errors of bad rows are returned as an *errors.ErrorList.
+func ReadTable(r io.Reader, v interface{}) error {
+	t, err := NewTableReader(r)
+	if err != nil {
+		return err
+	}
+	return t.readAll(v)
+}
+
+// ReadTableFile reads table from file, see ReadTable
+func ReadTableFile(filename string, v interface{}) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	t, err := newTableReader(&lineReader{reader: file, filename: filename})
+	if err != nil {
+		return err
+	}
+	return t.readAll(v)
+}
+
+func (t *TableReader) readAll(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cso: ReadTable(non-pointer to slice %v)", reflect.TypeOf(v))
+	}
+	slice := rv.Elem()
+	for t.Next() {
+		elem := reflect.New(slice.Type().Elem())
+		if err := t.Decode(elem.Interface()); err != nil {
+			t.errs.Add(err)
+			continue
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return t.Err()
+}
@@ -0,0 +1,92 @@
+package cso
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/errors"
+)
+
+type testRow struct {
+	Id    int
+	Name  string `cso:"title"`
+	Pos   testPos
+	Tags  []string
+	Extra interface{}
+}
+
+func TestReadTable(t *testing.T) {
+	src := `id:int,title:string,pos:{float,float},tags:[string],extra
+1,"sword",{1.5,2},[a,b],
+
+2,"shield",{0,0},[],x
+x,"bad id"
+3,"bad pos",{1,2,3}
+4,"too many",,,,5
+5,"unterminated
+6,"bow",,[c]
+`
+	var rows []testRow
+	err := ReadTable(strings.NewReader(src), &rows)
+	want := []testRow{
+		{Id: 1, Name: "sword", Pos: testPos{1.5, 2}, Tags: []string{"a", "b"}},
+		{Id: 2, Name: "shield", Tags: []string{}, Extra: "x"},
+		{Id: 6, Name: "bow", Tags: []string{"c"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("want %+v, but got %+v", want, rows)
+	}
+	list, ok := err.(*errors.ErrorList)
+	if !ok {
+		t.Fatalf("want *errors.ErrorList, but got %v", err)
+	}
+	wantErrs := []string{
+		"column id: expect int, but got ident x at <input>:5:1",
+		"column pos: too many values for {float,float} at <input>:6:18",
+		"row has 6 values, but table has 5 columns at <input>:7:17",
+		"literal not terminated at <input>:8:16",
+	}
+	if list.Len() != len(wantErrs) {
+		t.Fatalf("want %d errors, but got %d: %v", len(wantErrs), list.Len(), list)
+	}
+	for i, err := range list.Errors() {
+		if !strings.Contains(err.Error(), wantErrs[i]) {
+			t.Errorf("%dth: want error %q, but got %q", i, wantErrs[i], err)
+		}
+	}
+}
+
+func TestTableHeader(t *testing.T) {
+	for i, ts := range []struct {
+		src  string
+		want string
+		err  string
+	}{
+		{"a,b:int,c:[{string,[float]}]", "a:any,b:int,c:[{string,[float]}]", ""},
+		{`"x y":bool`, `"x y":bool`, ""},
+		{"a:integer", "", "unknown type integer at <input>:1:3"},
+		{"a,a", "", `invalid or duplicated column name "a" at <input>:1:3`},
+		{"a:[int", "", "expect `]`, but got EOF at <input>:1:7"},
+		{"", "", "missing table header at <input>:1:1"},
+	} {
+		tr, err := NewTableReader(strings.NewReader(ts.src))
+		if ts.err != "" {
+			if err == nil || err.Error() != ts.err {
+				t.Errorf("%dth: want error %q, but got %v", i, ts.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%dth: unexpected error %v", i, err)
+			continue
+		}
+		var columns []string
+		for _, c := range tr.Columns() {
+			columns = append(columns, c.String())
+		}
+		if got := strings.Join(columns, ","); got != ts.want {
+			t.Errorf("%dth: want %s, but got %s", i, ts.want, got)
+		}
+	}
+}
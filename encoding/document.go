@@ -0,0 +1,295 @@
+package encoding
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// ValueKind represents kind of Value
+type ValueKind int
+
+const (
+	NullValue ValueKind = iota
+	BoolValue
+	IntValue
+	FloatValue
+	StringValue
+	ObjectValue
+	ArrayValue
+)
+
+func (kind ValueKind) String() string {
+	if kind >= 0 && kind < ValueKind(len(valueKinds)) {
+		return valueKinds[kind]
+	}
+	return "Unknown kind(" + strconv.Itoa(int(kind)) + ")"
+}
+
+var valueKinds = [...]string{
+	NullValue:   "null",
+	BoolValue:   "bool",
+	IntValue:    "int",
+	FloatValue:  "float",
+	StringValue: "string",
+	ObjectValue: "object",
+	ArrayValue:  "array",
+}
+
+// Value is a node of format-neutral document. Readers of each format convert
+// their own nodes into Value and writers convert it back, so a document can be
+// converted from one format to another.
+//
+// Comments are stored as lines of text without comment markers, writers render
+// them in syntax of target format if it supports comments.
+type Value struct {
+	Kind ValueKind
+	Pos  scanner.Position
+
+	Bool   bool
+	Int    int64
+	Float  float64
+	String string
+	Fields []*Field // ordered members of object
+	Elems  []*Value // elements of array
+
+	Doc     []string // comment lines before value
+	Comment string   // comment after value on the same line
+}
+
+// Field represents a member of object
+type Field struct {
+	Key   string
+	Value *Value
+}
+
+// NewNull creates a null value
+func NewNull() *Value { return &Value{Kind: NullValue} }
+
+// NewBool creates a bool value
+func NewBool(b bool) *Value { return &Value{Kind: BoolValue, Bool: b} }
+
+// NewInt creates an int value
+func NewInt(i int64) *Value { return &Value{Kind: IntValue, Int: i} }
+
+// NewFloat creates a float value
+func NewFloat(f float64) *Value { return &Value{Kind: FloatValue, Float: f} }
+
+// NewString creates a string value
+func NewString(s string) *Value { return &Value{Kind: StringValue, String: s} }
+
+// NewObject creates an empty object
+func NewObject() *Value { return &Value{Kind: ObjectValue} }
+
+// NewArray creates an array with elements
+func NewArray(elems ...*Value) *Value { return &Value{Kind: ArrayValue, Elems: elems} }
+
+// Get returns value of field key, nil returned if v is not an object or key not found
+func (v *Value) Get(key string) *Value {
+	if v == nil || v.Kind != ObjectValue {
+		return nil
+	}
+	for _, f := range v.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// Set sets value of field key, the field is appended if not found
+func (v *Value) Set(key string, value *Value) {
+	for _, f := range v.Fields {
+		if f.Key == key {
+			f.Value = value
+			return
+		}
+	}
+	v.Fields = append(v.Fields, &Field{Key: key, Value: value})
+}
+
+// Lookup finds value by path of keys and indices, e.g. Lookup("db", "hosts", "0")
+func (v *Value) Lookup(path ...string) *Value {
+	for _, key := range path {
+		if v == nil {
+			return nil
+		}
+		switch v.Kind {
+		case ObjectValue:
+			v = v.Get(key)
+		case ArrayValue:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v.Elems) {
+				return nil
+			}
+			v = v.Elems[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// Text returns text of scalar value
+func (v *Value) Text() string {
+	switch v.Kind {
+	case BoolValue:
+		return strconv.FormatBool(v.Bool)
+	case IntValue:
+		return strconv.FormatInt(v.Int, 10)
+	case FloatValue:
+		return FormatFloat(v.Float)
+	case StringValue:
+		return v.String
+	}
+	return ""
+}
+
+// Interface converts v to a Go value: nil, bool, int64, float64, string,
+// map[string]interface{} or []interface{}
+func (v *Value) Interface() interface{} {
+	switch v.Kind {
+	case BoolValue:
+		return v.Bool
+	case IntValue:
+		return v.Int
+	case FloatValue:
+		return v.Float
+	case StringValue:
+		return v.String
+	case ObjectValue:
+		m := make(map[string]interface{}, len(v.Fields))
+		for _, f := range v.Fields {
+			m[f.Key] = f.Value.Interface()
+		}
+		return m
+	case ArrayValue:
+		s := make([]interface{}, len(v.Elems))
+		for i, elem := range v.Elems {
+			s[i] = elem.Interface()
+		}
+		return s
+	}
+	return nil
+}
+
+// ValueOf converts a Go value built of nil, bools, numbers, strings, maps with
+// string keys and slices into Value, keys of maps are sorted
+func ValueOf(x interface{}) (*Value, error) {
+	switch x := x.(type) {
+	case nil:
+		return NewNull(), nil
+	case *Value:
+		return x, nil
+	case bool:
+		return NewBool(x), nil
+	case int:
+		return NewInt(int64(x)), nil
+	case int8:
+		return NewInt(int64(x)), nil
+	case int16:
+		return NewInt(int64(x)), nil
+	case int32:
+		return NewInt(int64(x)), nil
+	case int64:
+		return NewInt(x), nil
+	case uint:
+		return NewInt(int64(x)), nil
+	case uint8:
+		return NewInt(int64(x)), nil
+	case uint16:
+		return NewInt(int64(x)), nil
+	case uint32:
+		return NewInt(int64(x)), nil
+	case uint64:
+		if x > math.MaxInt64 {
+			return NewFloat(float64(x)), nil
+		}
+		return NewInt(int64(x)), nil
+	case float32:
+		return NewFloat(float64(x)), nil
+	case float64:
+		return NewFloat(x), nil
+	case string:
+		return NewString(x), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		obj := NewObject()
+		for _, key := range keys {
+			value, err := ValueOf(x[key])
+			if err != nil {
+				return nil, err
+			}
+			obj.Fields = append(obj.Fields, &Field{Key: key, Value: value})
+		}
+		return obj, nil
+	case []interface{}:
+		arr := NewArray()
+		for _, elem := range x {
+			value, err := ValueOf(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr.Elems = append(arr.Elems, value)
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", x)
+}
+
+// FormatFloat formats f in shortest form which is read back as a float, e.g. 1.0
+func FormatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// CommentLines returns lines of comment group without comment markers
+// `//`, `/*` and `*/`, leading space of each line is trimmed
+func CommentLines(g *CommentGroup) []string {
+	if g == nil {
+		return nil
+	}
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		if strings.HasPrefix(text, "//") {
+			lines = append(lines, strings.TrimSpace(text[2:]))
+			continue
+		}
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "*") {
+				line = strings.TrimSpace(line[1:])
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// NewCommentGroup creates a comment group with a `//` comment per line
+func NewCommentGroup(lines []string) *CommentGroup {
+	if len(lines) == 0 {
+		return nil
+	}
+	g := &CommentGroup{List: make([]*Comment, len(lines))}
+	for i, line := range lines {
+		text := "//"
+		if line != "" {
+			text += " " + line
+		}
+		g.List[i] = &Comment{Text: text}
+	}
+	return g
+}
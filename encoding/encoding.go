@@ -2,7 +2,7 @@ package encoding
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
 	"text/scanner"
 )
 
@@ -36,10 +36,13 @@ func (g *CommentGroup) Text() string {
 type Parser struct {
 	scanner *scanner.Scanner
 
-	Pos scanner.Position
-	Tok rune
-	Lit string
-	err error
+	Pos    scanner.Position // position immediately after current token
+	TokPos scanner.Position // position of beginning of current token
+	Tok    rune
+	Lit    string
+	err    error
+	base   scanner.Position
+	src    []byte
 
 	Comments    []*CommentGroup
 	LeadComment *CommentGroup
@@ -49,10 +52,58 @@ type Parser struct {
 func (p *Parser) Init(s *scanner.Scanner) {
 	p.scanner = s
 	p.scanner.Error = p.errorHandler
+	p.err = nil
+}
+
+// SetBase sets position of beginning of source, line and offset of
+// positions are relative to base. It's useful for parsing line by line.
+func (p *Parser) SetBase(base scanner.Position) {
+	p.base = base
+}
+
+func (p *Parser) rebase(pos scanner.Position) scanner.Position {
+	if p.base.Line > 0 && pos.Line > 0 {
+		pos.Line += p.base.Line - 1
+		pos.Offset += p.base.Offset
+	}
+	return pos
+}
+
+// SetSource sets source text which begins at base position, it's used to
+// fill source line of syntax errors
+func (p *Parser) SetSource(src []byte) {
+	p.src = src
+}
+
+// Errorf creates a syntax error at pos, pos is usually TokPos, and the end of
+// source is used if pos is invalid, e.g. TokPos of EOF
+func (p *Parser) Errorf(pos scanner.Position, format string, args ...interface{}) *SyntaxError {
+	if !pos.IsValid() {
+		pos = p.Pos
+	}
+	err := &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	if p.src != nil {
+		offset := pos.Offset
+		if p.base.Line > 0 {
+			offset -= p.base.Offset
+		}
+		err.Source = SourceLine(p.src, offset)
+	}
+	return err
+}
+
+// ErrorExpected creates a syntax error at pos which reports that expected
+// is wanted but current token found
+func (p *Parser) ErrorExpected(pos scanner.Position, expected string) *SyntaxError {
+	found := TokenText(p.Tok, p.Lit)
+	err := p.Errorf(pos, "expect %s, but got %s", expected, found)
+	err.Expected = expected
+	err.Found = found
+	return err
 }
 
 func (p *Parser) errorHandler(s *scanner.Scanner, msg string) {
-	p.err = errors.New(msg + " at " + s.Pos().String())
+	p.err = p.Errorf(p.rebase(s.Pos()), "%s", msg)
 }
 
 func (p Parser) Err() error { return p.err }
@@ -69,9 +120,9 @@ func (p *Parser) Next() error {
 		var comment *CommentGroup
 		var endline int
 
-		if p.Pos.Line == prev.Line {
+		if p.TokPos.Line == prev.Line {
 			comment, endline = p.consumeCommentGroup(0)
-			if p.Pos.Line != endline {
+			if p.TokPos.Line != endline {
 				p.LineComment = comment
 			}
 		}
@@ -81,7 +132,7 @@ func (p *Parser) Next() error {
 			comment, endline = p.consumeCommentGroup(1)
 		}
 
-		if endline+1 == p.Pos.Line {
+		if endline+1 == p.TokPos.Line {
 			p.LeadComment = comment
 		}
 	}
@@ -90,14 +141,15 @@ func (p *Parser) Next() error {
 
 func (p *Parser) next0() error {
 	p.Tok = p.scanner.Scan()
-	p.Pos = p.scanner.Pos()
+	p.Pos = p.rebase(p.scanner.Pos())
+	p.TokPos = p.rebase(p.scanner.Position)
 	p.Lit = p.scanner.TokenText()
 	return p.err
 }
 
 func (p *Parser) consumeComment() (comment *Comment, endline int) {
-	endline = p.Pos.Line
-	if len(p.Lit) > 0 && p.Lit[1] == '*' {
+	endline = p.TokPos.Line
+	if len(p.Lit) > 1 && p.Lit[1] == '*' {
 		for i := 0; i < len(p.Lit); i++ {
 			if p.Lit[i] == '\n' {
 				endline++
@@ -105,7 +157,7 @@ func (p *Parser) consumeComment() (comment *Comment, endline int) {
 		}
 	}
 
-	comment = &Comment{Slash: p.Pos, Text: p.Lit}
+	comment = &Comment{Slash: p.TokPos, Text: p.Lit}
 	p.next0()
 
 	return
@@ -113,8 +165,8 @@ func (p *Parser) consumeComment() (comment *Comment, endline int) {
 
 func (p *Parser) consumeCommentGroup(n int) (comments *CommentGroup, endline int) {
 	var list []*Comment
-	endline = p.Pos.Line
-	for p.Tok == scanner.Comment && p.Pos.Line <= endline+n {
+	endline = p.TokPos.Line
+	for p.Tok == scanner.Comment && p.TokPos.Line <= endline+n {
 		var comment *Comment
 		comment, endline = p.consumeComment()
 		list = append(list, comment)
@@ -0,0 +1,76 @@
+package encoding
+
+import (
+	"bytes"
+	"strings"
+	"text/scanner"
+)
+
+// SyntaxError represents a syntax error found by parsers
+type SyntaxError struct {
+	Pos      scanner.Position // filename, line, column and offset of error
+	Msg      string
+	Expected string // expected token, empty if unknown
+	Found    string // found token, empty if unknown
+	Source   string // source line where error found, empty if unknown
+}
+
+// Error returns message and position of error, e.g.
+//
+//	expect `,`, but got `"b"` at config.json:1:9
+func (e *SyntaxError) Error() string {
+	return e.Msg + " at " + e.Pos.String()
+}
+
+// Excerpt returns source line and a caret which points to column of error,
+// empty string returned if source unknown, e.g.
+//
+//	{"a": 1 "b": 2}
+//	        ^
+func (e *SyntaxError) Excerpt() string {
+	if e.Source == "" {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString(e.Source)
+	buf.WriteByte('\n')
+	column := 1
+	for _, r := range e.Source {
+		if column >= e.Pos.Column {
+			break
+		}
+		// keep tabs so that caret is aligned
+		if r == '\t' {
+			buf.WriteByte('\t')
+		} else {
+			buf.WriteByte(' ')
+		}
+		column++
+	}
+	buf.WriteByte('^')
+	return buf.String()
+}
+
+// SourceLine returns the line of src which contains offset, the trailing
+// newline is excluded
+func SourceLine(src []byte, offset int) string {
+	if offset < 0 || offset > len(src) {
+		return ""
+	}
+	begin := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := bytes.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += offset
+	}
+	return strings.TrimSuffix(string(src[begin:end]), "\r")
+}
+
+// TokenText returns text of token for error messages, e.g. `x` or EOF
+func TokenText(tok rune, lit string) string {
+	if tok == scanner.EOF {
+		return "EOF"
+	}
+	return "`" + lit + "`"
+}
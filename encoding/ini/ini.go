@@ -0,0 +1,374 @@
+// Package ini reads and writes INI documents as format-neutral encoding.Value,
+// comments are kept.
+//
+// Sections are read as objects, dotted section names as nested objects and
+// keys suffixed with [] as arrays:
+//
+//	; comment of name
+//	name = app
+//
+//	[db.master]
+//	host = localhost ; line comment
+//	port = 3306
+//	hosts[] = a
+//	hosts[] = b
+//
+// Values true and false are read as bools, numbers as ints or floats, values
+// quoted by " are unquoted and other values are read as strings.
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// Read reads an INI document from r
+func Read(r io.Reader) (*encoding.Value, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, "")
+}
+
+// ReadBytes reads an INI document from bytes
+func ReadBytes(data []byte) (*encoding.Value, error) {
+	return parse(data, "")
+}
+
+// ReadFile reads an INI document from file
+func ReadFile(filename string) (*encoding.Value, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, filename)
+}
+
+const arraySuffix = "[]"
+
+func parse(data []byte, filename string) (*encoding.Value, error) {
+	var (
+		root    = encoding.NewObject()
+		section = root
+		doc     []string
+		offset  int
+		entries bool // whether any section or key read
+		s       = bufio.NewScanner(bytes.NewReader(data))
+	)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		pos := scanner.Position{Filename: filename, Line: line, Column: 1, Offset: offset}
+		offset += len(text) + 1
+		errorf := func(column int, format string, args ...interface{}) error {
+			pos.Column += column
+			pos.Offset += column
+			return &encoding.SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...), Source: strings.TrimSuffix(text, "\r")}
+		}
+		trimmed := strings.TrimSpace(text)
+		indent := strings.Index(text, trimmed)
+		switch {
+		case trimmed == "":
+			if !entries && len(doc) > 0 {
+				// comments separated from first entry are doc of document
+				root.Doc = append(root.Doc, doc...)
+				doc = nil
+			}
+		case trimmed[0] == ';' || trimmed[0] == '#':
+			doc = append(doc, strings.TrimSpace(trimmed[1:]))
+		case trimmed[0] == '[':
+			end := strings.IndexByte(trimmed, ']')
+			if end < 0 {
+				return nil, errorf(len(text), "expect `]`")
+			}
+			name := strings.TrimSpace(trimmed[1:end])
+			if name == "" {
+				return nil, errorf(indent, "empty section name")
+			}
+			comment, ok := parseComment(trimmed[end+1:])
+			if !ok {
+				return nil, errorf(indent+end+1, "unexpected %q after section", strings.TrimSpace(trimmed[end+1:]))
+			}
+			section = root
+			for _, key := range strings.Split(name, ".") {
+				key = strings.TrimSpace(key)
+				next := section.Get(key)
+				if next == nil {
+					next = encoding.NewObject()
+					next.Pos = pos
+					section.Set(key, next)
+				} else if next.Kind != encoding.ObjectValue {
+					return nil, errorf(indent, "key %s is not a section", key)
+				}
+				section = next
+			}
+			section.Doc = append(section.Doc, doc...)
+			section.Comment = comment
+			doc = nil
+			entries = true
+		default:
+			eq := strings.IndexByte(trimmed, '=')
+			if eq < 0 {
+				return nil, errorf(indent, "expect `=` after key")
+			}
+			key := strings.TrimSpace(trimmed[:eq])
+			if key == "" {
+				return nil, errorf(indent, "empty key")
+			}
+			value, err := parseValue(trimmed[eq+1:])
+			if err != nil {
+				return nil, errorf(indent+eq+1, "%v", err)
+			}
+			value.Pos = pos
+			value.Doc, doc = doc, nil
+			if strings.HasSuffix(key, arraySuffix) {
+				key = strings.TrimSpace(strings.TrimSuffix(key, arraySuffix))
+				arr := section.Get(key)
+				if arr == nil {
+					arr = encoding.NewArray()
+					arr.Pos = pos
+					section.Set(key, arr)
+				} else if arr.Kind != encoding.ArrayValue {
+					return nil, errorf(indent, "key %s is not an array", key)
+				}
+				arr.Elems = append(arr.Elems, value)
+			} else if section.Get(key) != nil {
+				return nil, errorf(indent, "key %s defined twice", key)
+			} else {
+				section.Set(key, value)
+			}
+			entries = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(doc) > 0 {
+		// comments at end of file
+		root.Doc = append(root.Doc, doc...)
+	}
+	return root, nil
+}
+
+// parseComment parses trailing comment of line, it returns false if s is
+// neither empty nor a comment
+func parseComment(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", true
+	}
+	if s[0] == ';' || s[0] == '#' {
+		return strings.TrimSpace(s[1:]), true
+	}
+	return "", false
+}
+
+// parseValue parses value and trailing comment of a key-value line
+func parseValue(s string) (*encoding.Value, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		str, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		comment, ok := parseComment(s[end+1:])
+		if !ok {
+			return nil, fmt.Errorf("unexpected %q after string", strings.TrimSpace(s[end+1:]))
+		}
+		v := encoding.NewString(str)
+		v.Comment = comment
+		return v, nil
+	}
+	var comment string
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			comment = strings.TrimSpace(s[i+1:])
+			s = strings.TrimSpace(s[:i])
+			break
+		}
+	}
+	if s != "" && (s[0] == ';' || s[0] == '#') {
+		comment, s = strings.TrimSpace(s[1:]), ""
+	}
+	v := scalar(s)
+	v.Comment = comment
+	return v, nil
+}
+
+// scalar converts unquoted text to bool, int, float or string
+func scalar(s string) *encoding.Value {
+	switch s {
+	case "true":
+		return encoding.NewBool(true)
+	case "false":
+		return encoding.NewBool(false)
+	}
+	// numbers are inferred only if they are written back as same text, so
+	// text like 08080 or 1.50 is kept as string
+	if isNumber(s) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			if strconv.FormatInt(i, 10) == strings.TrimPrefix(s, "+") {
+				return encoding.NewInt(i)
+			}
+		} else if f, err := strconv.ParseFloat(s, 64); err == nil && encoding.FormatFloat(f) == s {
+			return encoding.NewFloat(f)
+		}
+	}
+	return encoding.NewString(s)
+}
+
+// isNumber reports whether s looks like a decimal number, i.e. begins with
+// a digit after optional sign, so that inf and nan are read as strings
+func isNumber(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if s != "" && s[0] == '.' {
+		s = s[1:]
+	}
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// Write writes v to w as an INI document, v must be an object.
+// Null values are omitted.
+func Write(w io.Writer, v *encoding.Value) error {
+	if v.Kind != encoding.ObjectValue {
+		return fmt.Errorf("ini: top-level value must be an object, but got %v", v.Kind)
+	}
+	var buf bytes.Buffer
+	for _, line := range v.Doc {
+		writeDoc(&buf, line)
+	}
+	if len(v.Doc) > 0 {
+		buf.WriteByte('\n')
+	}
+	if err := writeSection(&buf, nil, v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile writes v to file as an INI document
+func WriteFile(filename string, v *encoding.Value, perm os.FileMode) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, v); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), perm)
+}
+
+func writeDoc(buf *bytes.Buffer, line string) {
+	buf.WriteString(";")
+	if line != "" {
+		buf.WriteString(" " + line)
+	}
+	buf.WriteByte('\n')
+}
+
+func writeComment(buf *bytes.Buffer, comment string) {
+	if comment != "" {
+		buf.WriteString(" ; " + comment)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeSection writes key-value pairs of section, then sub-sections
+func writeSection(buf *bytes.Buffer, path []string, section *encoding.Value) error {
+	for _, f := range section.Fields {
+		if err := checkKey(f.Key); err != nil {
+			return err
+		}
+		switch f.Value.Kind {
+		case encoding.NullValue, encoding.ObjectValue:
+		case encoding.ArrayValue:
+			for _, line := range f.Value.Doc {
+				writeDoc(buf, line)
+			}
+			for _, elem := range f.Value.Elems {
+				if elem.Kind == encoding.ArrayValue || elem.Kind == encoding.ObjectValue {
+					return fmt.Errorf("ini: %v in array %s is not supported", elem.Kind, f.Key)
+				}
+				for _, line := range elem.Doc {
+					writeDoc(buf, line)
+				}
+				buf.WriteString(f.Key + arraySuffix + " = " + formatValue(elem))
+				writeComment(buf, elem.Comment)
+			}
+		default:
+			for _, line := range f.Value.Doc {
+				writeDoc(buf, line)
+			}
+			buf.WriteString(f.Key + " = " + formatValue(f.Value))
+			writeComment(buf, f.Value.Comment)
+		}
+	}
+	for _, f := range section.Fields {
+		if f.Value.Kind != encoding.ObjectValue {
+			continue
+		}
+		subpath := append(path[:len(path):len(path)], f.Key)
+		if hasValues(f.Value) || len(f.Value.Fields) == 0 || len(f.Value.Doc) > 0 || f.Value.Comment != "" {
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			for _, line := range f.Value.Doc {
+				writeDoc(buf, line)
+			}
+			buf.WriteString("[" + strings.Join(subpath, ".") + "]")
+			writeComment(buf, f.Value.Comment)
+		}
+		if err := writeSection(buf, subpath, f.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasValues reports whether section has key-value pairs
+func hasValues(section *encoding.Value) bool {
+	for _, f := range section.Fields {
+		if f.Value.Kind != encoding.NullValue && f.Value.Kind != encoding.ObjectValue {
+			return true
+		}
+	}
+	return false
+}
+
+func checkKey(key string) error {
+	if key == "" || strings.TrimSpace(key) != key || strings.ContainsAny(key, "=[].;#\n") {
+		return fmt.Errorf("ini: invalid key %q", key)
+	}
+	return nil
+}
+
+// formatValue formats scalar value, strings are quoted only if they can't be
+// read back unquoted
+func formatValue(v *encoding.Value) string {
+	if v.Kind != encoding.StringValue {
+		return v.Text()
+	}
+	if parsed, err := parseValue(v.String); err == nil && parsed.Kind == encoding.StringValue &&
+		parsed.String == v.String && parsed.Comment == "" && !strings.ContainsAny(v.String, "\"\n\r") {
+		return v.String
+	}
+	return strconv.Quote(v.String)
+}
@@ -0,0 +1,98 @@
+package ini
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+func TestRead(t *testing.T) {
+	src := `; config
+
+; name of app
+name = app ; line
+debug = true
+ratio = 0.5
+code = "007"
+
+[db.master]
+host = localhost
+port = 3306
+hosts[] = a
+hosts[] = b
+`
+	v, err := ReadBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	for i, ts := range []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"name"}, "app"},
+		{[]string{"debug"}, true},
+		{[]string{"ratio"}, 0.5},
+		{[]string{"code"}, "007"},
+		{[]string{"db", "master", "port"}, int64(3306)},
+		{[]string{"db", "master", "hosts", "1"}, "b"},
+	} {
+		got := v.Lookup(ts.path...)
+		if got == nil || got.Interface() != ts.want {
+			t.Errorf("%dth: want %v, but got %v", i, ts.want, got)
+		}
+	}
+	if got := v.Doc; len(got) != 1 || got[0] != "config" {
+		t.Errorf("want document comment config, but got %q", got)
+	}
+	if name := v.Get("name"); len(name.Doc) != 1 || name.Doc[0] != "name of app" || name.Comment != "line" {
+		t.Errorf("want comments of name, but got %q and %q", name.Doc, name.Comment)
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, v); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	want := `; config
+
+; name of app
+name = app ; line
+debug = true
+ratio = 0.5
+code = 007
+
+[db.master]
+host = localhost
+port = 3306
+hosts[] = a
+hosts[] = b
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	for i, ts := range []struct {
+		src string
+		err string
+	}{
+		{"[db", "expect `]` at <input>:1:4"},
+		{"a = 1\na = 2", "key a defined twice at <input>:2:1"},
+		{"a = 1\n[a]", "key a is not a section at <input>:2:1"},
+		{"a = \"x", "unterminated string at <input>:1:4"},
+		{"abc", "expect `=` after key at <input>:1:1"},
+	} {
+		_, err := ReadBytes([]byte(ts.src))
+		if err == nil {
+			t.Errorf("%dth: want error, but got nil", i)
+			continue
+		}
+		if err.Error() != ts.err {
+			t.Errorf("%dth: want error %s, but got %v", i, ts.err, err)
+		}
+		if _, ok := err.(*encoding.SyntaxError); !ok {
+			t.Errorf("%dth: want *encoding.SyntaxError, but got %T", i, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package jsonx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// ToValue converts node to format-neutral document value, comments are kept
+func ToValue(node Node) *encoding.Value {
+	var v *encoding.Value
+	switch n := node.(type) {
+	case *objectNode:
+		v = encoding.NewObject()
+		for _, child := range n.children {
+			v.Fields = append(v.Fields, &encoding.Field{Key: unquoteKey(child.key), Value: ToValue(child.value)})
+		}
+	case *arrayNode:
+		v = encoding.NewArray()
+		for _, child := range n.children {
+			v.Elems = append(v.Elems, ToValue(child))
+		}
+	default:
+		v = literalValue(node)
+	}
+	v.Pos = node.Pos()
+	v.Doc = encoding.CommentLines(node.Doc())
+	v.Comment = strings.Join(encoding.CommentLines(node.Comment()), " ")
+	return v
+}
+
+func literalValue(node Node) *encoding.Value {
+	switch node.Kind() {
+	case encoding.IdentNode:
+		switch ident := node.Value().(string); ident {
+		case "true", "false":
+			return encoding.NewBool(ident == "true")
+		case "null":
+			return encoding.NewNull()
+		default:
+			return encoding.NewString(ident)
+		}
+	case encoding.IntNode:
+		lit := node.(*literalNode).value
+		if i, err := strconv.ParseInt(lit, 0, 64); err == nil {
+			return encoding.NewInt(i)
+		}
+		f, _ := strconv.ParseFloat(lit, 64)
+		return encoding.NewFloat(f)
+	case encoding.FloatNode:
+		return encoding.NewFloat(node.Value().(float64))
+	case encoding.StringNode:
+		return encoding.NewString(node.Value().(string))
+	case encoding.CharNode:
+		return encoding.NewString(string(node.Value().(rune)))
+	}
+	return encoding.NewNull()
+}
+
+// FromValue converts format-neutral document value to node, infinities and NaN
+// are converted to strings
+func FromValue(v *encoding.Value) Node {
+	var node Node
+	switch v.Kind {
+	case encoding.ObjectValue:
+		obj := newObjectNode()
+		for _, f := range v.Fields {
+			obj.addChild(strconv.Quote(f.Key), FromValue(f.Value))
+		}
+		node = obj
+	case encoding.ArrayValue:
+		arr := newArrayNode()
+		for _, elem := range v.Elems {
+			arr.addChild(FromValue(elem))
+		}
+		node = arr
+	default:
+		lit := &literalNode{kind: encoding.IdentNode}
+		switch v.Kind {
+		case encoding.NullValue:
+			lit.value = "null"
+		case encoding.BoolValue:
+			lit.value = strconv.FormatBool(v.Bool)
+		case encoding.IntValue:
+			lit.kind, lit.value = encoding.IntNode, strconv.FormatInt(v.Int, 10)
+		case encoding.FloatValue:
+			lit.kind, lit.value = encoding.FloatNode, encoding.FormatFloat(v.Float)
+			if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+				// not supported by json
+				lit.kind, lit.value = encoding.StringNode, strconv.Quote(lit.value)
+			}
+		case encoding.StringValue:
+			lit.kind, lit.value = encoding.StringNode, strconv.Quote(v.String)
+		}
+		node = lit
+	}
+	node.setDoc(encoding.NewCommentGroup(v.Doc))
+	if v.Comment != "" {
+		node.setComment(encoding.NewCommentGroup([]string{v.Comment}))
+	}
+	return node
+}
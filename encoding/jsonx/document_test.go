@@ -0,0 +1,60 @@
+package jsonx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+func TestValue(t *testing.T) {
+	node, err := ReadBytes([]byte(`{
+		// doc of a
+		"a": 1, // line a
+		"b": [true, null, 1.5, "x"],
+		"c": {"d": 12345678901234567890},
+		"e": 2, /* first
+		second */
+	}`), WithComment(), WithExtraComma())
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	v := ToValue(node)
+	a := v.Get("a")
+	if a.Kind != encoding.IntValue || a.Int != 1 || len(a.Doc) != 1 || a.Doc[0] != "doc of a" || a.Comment != "line a" {
+		t.Errorf("unexpected value of a: %+v", a)
+	}
+	if b := v.Get("b"); b.Kind != encoding.ArrayValue || b.Elems[1].Kind != encoding.NullValue {
+		t.Errorf("unexpected value of b: %+v", b)
+	}
+	if d := v.Lookup("c", "d"); d.Kind != encoding.FloatValue {
+		t.Errorf("integer overflowed should be float, but got %v", d.Kind)
+	}
+
+	if e := v.Get("e"); e.Comment != "first second" {
+		t.Errorf("want all lines of comment of e, but got %q", e.Comment)
+	}
+	// e is not written
+	v.Fields = v.Fields[:3]
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FromValue(v), WithComment(), WithIndent("  ")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	want := `{
+  // doc of a
+  "a": 1,// line a
+  "b": [
+    true,
+    null,
+    1.5,
+    "x"
+  ],
+  "c": {
+    "d": 1.2345678901234567e+19
+  }
+}`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
@@ -0,0 +1,379 @@
+package jsonx
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// Format formats json source src in canonical style:
+//
+//   - one member per line, indented by indent(tab by default, see WithIndent)
+//   - keys quoted unless WithUnquotedKey specified
+//   - keys sorted if WithSortKeys specified
+//   - extra comma appended to last member if WithExtraComma specified
+//   - all comments kept, trailing line comments of consecutive lines aligned
+//   - at most one blank line kept between members
+//
+// Comments, extra comma, quoted and unquoted keys are always accepted in src.
+// Format is idempotent, i.e. Format(Format(src)) equals to Format(src)
+func Format(src []byte, opts ...Option) ([]byte, error) {
+	opt := applyOptions(opts)
+	if opt.indent == "" {
+		opt.indent = "\t"
+	}
+	readOpt := opt
+	readOpt.supportComment = true
+	readOpt.extraComma = true
+	readOpt.anyKey = true
+	node, p, err := read(bytes.NewReader(src), readOpt)
+	if err != nil {
+		return nil, err
+	}
+	if p.Tok != scanner.EOF {
+		return nil, p.Errorf(p.TokPos, "unexpected `%s` after top-level value", p.Lit)
+	}
+	f := &formatter{opt: opt}
+	for _, g := range p.Comments {
+		f.comments = append(f.comments, g.List...)
+	}
+	f.format(node)
+	return f.bytes(), nil
+}
+
+// fmtLine represents an output line of formatter
+type fmtLine struct {
+	indent  int
+	code    string
+	comment string // trailing comment
+}
+
+// formatter formats json nodes and comments as lines
+type formatter struct {
+	opt      options
+	comments []*encoding.Comment // comments not printed yet, ordered by offset
+	lines    []fmtLine
+	blank    bool // a blank line required before next line
+}
+
+// take takes comments at offset range [from, to)
+func (f *formatter) take(from, to int) []*encoding.Comment {
+	var taken []*encoding.Comment
+	remain := f.comments[:0]
+	for _, c := range f.comments {
+		if c.Slash.Offset >= from && c.Slash.Offset < to {
+			taken = append(taken, c)
+		} else {
+			remain = append(remain, c)
+		}
+	}
+	f.comments = remain
+	return taken
+}
+
+// takeLine takes comments at offset range [from, to) located in line
+func (f *formatter) takeLine(from, to, line int) []*encoding.Comment {
+	var taken []*encoding.Comment
+	remain := f.comments[:0]
+	for _, c := range f.comments {
+		if c.Slash.Offset >= from && c.Slash.Offset < to && c.Slash.Line == line {
+			taken = append(taken, c)
+		} else {
+			remain = append(remain, c)
+		}
+	}
+	f.comments = remain
+	return taken
+}
+
+func (f *formatter) addLine(indent int, code string) {
+	if f.blank && len(f.lines) > 0 {
+		f.lines = append(f.lines, fmtLine{})
+	}
+	f.blank = false
+	f.lines = append(f.lines, fmtLine{indent: indent, code: code})
+}
+
+func (f *formatter) last() *fmtLine { return &f.lines[len(f.lines)-1] }
+
+// addTrailing appends comments to last line as trailing comment
+func (f *formatter) addTrailing(comments []*encoding.Comment) {
+	if len(comments) == 0 {
+		return
+	}
+	texts := make([]string, 0, len(comments))
+	for _, c := range comments {
+		texts = append(texts, strings.TrimRightFunc(c.Text, unicode.IsSpace))
+	}
+	last := f.last()
+	if last.comment != "" {
+		texts = append([]string{last.comment}, texts...)
+	}
+	last.comment = strings.Join(texts, " ")
+}
+
+// addComments adds comments as standalone lines, prevLine is the last source line printed
+func (f *formatter) addComments(indent int, comments []*encoding.Comment, prevLine int) int {
+	for _, c := range comments {
+		if prevLine > 0 && c.Slash.Line > prevLine+1 {
+			f.blank = true
+		}
+		for _, line := range normalizeComment(c.Text) {
+			f.addLine(indent, line)
+		}
+		prevLine = c.Slash.Line + strings.Count(c.Text, "\n")
+	}
+	return prevLine
+}
+
+func (f *formatter) format(node Node) {
+	start, end := node.Pos(), nodeEnd(node)
+	prevLine := f.addComments(0, f.take(0, start.Offset), 0)
+	if prevLine > 0 && start.Line > prevLine+1 {
+		f.blank = true
+	}
+	f.node(node, 0, "")
+	f.addTrailing(f.takeLine(end.Offset, maxOffset, end.Line))
+	f.addComments(0, f.take(0, maxOffset), end.Line)
+}
+
+const maxOffset = int(^uint(0) >> 1)
+
+func nodeEnd(node Node) scanner.Position {
+	switch n := node.(type) {
+	case *objectNode:
+		return n.end
+	case *arrayNode:
+		return n.end
+	case *literalNode:
+		return n.end
+	}
+	return node.Pos()
+}
+
+// entry represents a member of object or an element of array
+type entry struct {
+	key      string
+	value    Node
+	start    scanner.Position // position of key or value
+	lead     []*encoding.Comment
+	trailing []*encoding.Comment
+	blank    bool // blank line before entry
+}
+
+// node formats node with indent, head written before node in the same line
+func (f *formatter) node(node Node, indent int, head string) {
+	var (
+		open, close string
+		entries     []entry
+	)
+	switch n := node.(type) {
+	case *objectNode:
+		open, close = "{", "}"
+		for _, child := range n.children {
+			entries = append(entries, entry{key: child.key, value: child.value, start: child.pos})
+		}
+	case *arrayNode:
+		open, close = "[", "]"
+		for _, child := range n.children {
+			entries = append(entries, entry{value: child, start: child.Pos()})
+		}
+	default:
+		f.addLine(indent, head+node.(*literalNode).value)
+		return
+	}
+	start, end := node.Pos(), nodeEnd(node)
+	// offset of closing token
+	closeOffset := end.Offset - 1
+	if len(entries) == 0 && len(f.peek(start.Offset, closeOffset)) == 0 {
+		f.addLine(indent, head+open+close)
+		return
+	}
+	f.addLine(indent, head+open)
+	from := start.Offset + 1
+	prevLine := start.Line
+	if len(entries) > 0 {
+		f.addTrailing(f.takeLine(from, entries[0].start.Offset, start.Line))
+	} else {
+		f.addTrailing(f.takeLine(from, closeOffset, start.Line))
+	}
+
+	// attach comments to entries
+	for i := range entries {
+		e := &entries[i]
+		e.lead = f.take(from, e.start.Offset)
+		firstLine := e.start.Line
+		if len(e.lead) > 0 {
+			firstLine = e.lead[0].Slash.Line
+		}
+		e.blank = i > 0 && firstLine > prevLine+1
+		valueEnd := nodeEnd(e.value)
+		next := closeOffset
+		if i+1 < len(entries) {
+			next = entries[i+1].start.Offset
+		}
+		e.trailing = f.takeLine(valueEnd.Offset, next, valueEnd.Line)
+		// comments inside value are not taken yet
+		from = valueEnd.Offset
+		prevLine = valueEnd.Line
+		if len(e.trailing) > 0 {
+			last := e.trailing[len(e.trailing)-1]
+			prevLine = last.Slash.Line + strings.Count(last.Text, "\n")
+		}
+	}
+	tail := f.take(from, closeOffset)
+	if f.opt.sortKeys && open == "{" {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return unquoteKey(entries[i].key) < unquoteKey(entries[j].key)
+		})
+		for i := range entries {
+			entries[i].blank = false
+		}
+	}
+
+	for i, e := range entries {
+		if e.blank {
+			f.blank = true
+		}
+		if leadEnd := f.addComments(indent+1, e.lead, 0); leadEnd > 0 && e.start.Line > leadEnd+1 {
+			f.blank = true
+		}
+		head := ""
+		if open == "{" {
+			head = f.formatKey(e.key) + ": "
+		}
+		f.node(e.value, indent+1, head)
+		if i+1 < len(entries) || f.opt.extraComma {
+			f.last().code += ","
+		}
+		f.addTrailing(e.trailing)
+	}
+	if len(tail) > 0 {
+		f.addComments(indent+1, tail, prevLine)
+	}
+	f.addLine(indent, close)
+}
+
+// peek returns comments at offset range [from, to) without taking them
+func (f *formatter) peek(from, to int) []*encoding.Comment {
+	var found []*encoding.Comment
+	for _, c := range f.comments {
+		if c.Slash.Offset >= from && c.Slash.Offset < to {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func (f *formatter) formatKey(key string) string {
+	name := unquoteKey(key)
+	if f.opt.unquotedKey && isIdent(name) {
+		return name
+	}
+	if len(key) > 0 && key[0] == '"' {
+		// keep escapes of quoted key
+		return key
+	}
+	return strconv.Quote(name)
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeComment trims trailing spaces of comment and re-indents lines of
+// multi-line block comment, returned lines are unindented
+func normalizeComment(text string) []string {
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRightFunc(lines[i], unicode.IsSpace)
+	}
+	if len(lines) == 1 {
+		return lines
+	}
+	// common indent of non-star lines
+	common := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if trimmed == "" || trimmed[0] == '*' {
+			continue
+		}
+		if n := len(line) - len(trimmed); common < 0 || n < common {
+			common = n
+		}
+	}
+	for i, line := range lines[1:] {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		switch {
+		case trimmed == "":
+			lines[i+1] = ""
+		case trimmed[0] == '*':
+			lines[i+1] = " " + trimmed
+		default:
+			lines[i+1] = line[common:]
+		}
+	}
+	return lines
+}
+
+// bytes returns formatted result, trailing comments of consecutive lines aligned
+func (f *formatter) bytes() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(f.lines); {
+		// find block of lines which should be aligned
+		j := i
+		width := 0
+		for j < len(f.lines) && f.lines[j].comment != "" && f.lines[j].indent == f.lines[i].indent {
+			if w := utf8.RuneCountInString(f.lines[j].code); w > width {
+				width = w
+			}
+			j++
+			if isClosingLine(f.lines[j-1]) {
+				// end of a multi-line object or array not aligned with following lines
+				break
+			}
+			if j < len(f.lines) && isClosingLine(f.lines[j]) {
+				break
+			}
+		}
+		if j == i {
+			f.writeLine(&buf, f.lines[i], 0)
+			i++
+			continue
+		}
+		for ; i < j; i++ {
+			f.writeLine(&buf, f.lines[i], width)
+		}
+	}
+	return buf.Bytes()
+}
+
+func isClosingLine(line fmtLine) bool {
+	return strings.HasPrefix(line.code, "}") || strings.HasPrefix(line.code, "]")
+}
+
+func (f *formatter) writeLine(buf *bytes.Buffer, line fmtLine, width int) {
+	if line.code != "" || line.comment != "" {
+		buf.WriteString(strings.Repeat(f.opt.indent, line.indent))
+	}
+	buf.WriteString(line.code)
+	if line.comment != "" {
+		buf.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(line.code)+1))
+		buf.WriteString(line.comment)
+	}
+	buf.WriteByte('\n')
+}
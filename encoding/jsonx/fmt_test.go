@@ -0,0 +1,97 @@
+package jsonx
+
+import (
+	"os"
+	"testing"
+)
+
+func ExampleFormat() {
+	src := `{
+	b: [1,2], // line b
+	// doc a
+	"a":{"x":1.2,"yy":"z",}, // line a
+
+
+	"c": {} // line c
+}`
+	out, err := Format([]byte(src), WithIndent("  "))
+	if err != nil {
+		return
+	}
+	os.Stdout.Write(out)
+	out, err = Format([]byte(src), WithIndent("  "), WithSortKeys(), WithUnquotedKey(), WithExtraComma())
+	if err != nil {
+		return
+	}
+	os.Stdout.Write(out)
+	// Output:
+	// {
+	//   "b": [
+	//     1,
+	//     2
+	//   ], // line b
+	//   // doc a
+	//   "a": {
+	//     "x": 1.2,
+	//     "yy": "z"
+	//   }, // line a
+	//
+	//   "c": {} // line c
+	// }
+	// {
+	//   // doc a
+	//   a: {
+	//     x: 1.2,
+	//     yy: "z",
+	//   }, // line a
+	//   b: [
+	//     1,
+	//     2,
+	//   ], // line b
+	//   c: {}, // line c
+	// }
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	for i, src := range []string{
+		`1`,
+		`// doc
+"x" // line`,
+		`{}`,
+		`{/* inner */}`,
+		`[1, /* one */ 2, // two
+		3]`,
+		`{
+	/* block
+	   comment */
+	"a": 1, "bb": 2, // bb
+
+
+	// floating
+
+	"c": [{}, [], {"d": null}],
+	// tail
+}
+// eof`,
+	} {
+		for _, opts := range [][]Option{
+			nil,
+			{WithSortKeys()},
+			{WithUnquotedKey(), WithExtraComma(), WithIndent("    ")},
+		} {
+			out1, err := Format([]byte(src), opts...)
+			if err != nil {
+				t.Errorf("%dth: format error: %v", i, err)
+				continue
+			}
+			out2, err := Format(out1, opts...)
+			if err != nil {
+				t.Errorf("%dth: format formatted error: %v", i, err)
+				continue
+			}
+			if string(out1) != string(out2) {
+				t.Errorf("%dth: format not idempotent:\n%s\nvs\n%s", i, out1, out2)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package jsonx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// includeKey is the key of include directive
+const includeKey = "$include"
+
+// expand replaces include directives and expands environment variables in node
+func expand(node Node, opt options) (Node, error) {
+	switch n := node.(type) {
+	case *objectNode:
+		if opt.include {
+			if child := n.ByKey(includeKey); child != nil {
+				return expandInclude(n, child, opt)
+			}
+		}
+		for i := range n.children {
+			child, err := expand(n.children[i].value, opt)
+			if err != nil {
+				return nil, err
+			}
+			n.children[i].value = child
+		}
+	case *arrayNode:
+		for i := range n.children {
+			child, err := expand(n.children[i], opt)
+			if err != nil {
+				return nil, err
+			}
+			n.children[i] = child
+		}
+	case *literalNode:
+		if opt.lookupEnv != nil && n.kind == encoding.StringNode {
+			s, err := strconv.Unquote(n.value)
+			if err != nil {
+				return nil, fmt.Errorf("%v at %v", err, n.pos)
+			}
+			expanded, err := ExpandEnv(s, opt.lookupEnv)
+			if err != nil {
+				return nil, fmt.Errorf("%v at %v", err, n.pos)
+			}
+			if expanded != s {
+				n.value = strconv.Quote(expanded)
+			}
+		}
+	}
+	return node, nil
+}
+
+func expandInclude(n *objectNode, child Node, opt options) (Node, error) {
+	if child.Kind() != encoding.StringNode {
+		return nil, fmt.Errorf("value of %q must be a string at %v", includeKey, child.Pos())
+	}
+	name := child.Value().(string)
+	if opt.lookupEnv != nil {
+		var err error
+		if name, err = ExpandEnv(name, opt.lookupEnv); err != nil {
+			return nil, fmt.Errorf("%v at %v", err, child.Pos())
+		}
+	}
+	if !filepath.IsAbs(name) && opt.filename != "" {
+		name = filepath.Join(filepath.Dir(opt.filename), name)
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, fmt.Errorf("%v at %v", err, child.Pos())
+	}
+	stack := opt.includeStack
+	if len(stack) == 0 && opt.filename != "" {
+		if self, err := filepath.Abs(opt.filename); err == nil {
+			stack = []string{self}
+		}
+	}
+	for i, s := range stack {
+		if s == abs {
+			cycle := append(append([]string(nil), stack[i:]...), abs)
+			return nil, fmt.Errorf("include cycle %s at %v", strings.Join(cycle, " -> "), child.Pos())
+		}
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("include: %v at %v", err, child.Pos())
+	}
+	defer file.Close()
+	subOpt := opt
+	subOpt.filename = name
+	subOpt.includeStack = append(append([]string(nil), stack...), abs)
+	included, _, err := read(file, subOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	// other members override members of included object
+	if n.NumChild() > 1 {
+		obj, ok := included.(*objectNode)
+		if !ok {
+			return nil, fmt.Errorf("included %s is not an object, but other members found at %v", name, child.Pos())
+		}
+		for _, kv := range n.children {
+			if unquoteKey(kv.key) == includeKey {
+				continue
+			}
+			value, err := expand(kv.value, opt)
+			if err != nil {
+				return nil, err
+			}
+			obj.addChildAt(kv.key, value, kv.pos)
+		}
+	}
+	if included.Doc() == nil {
+		included.setDoc(n.Doc())
+	}
+	if included.Comment() == nil {
+		included.setComment(n.Comment())
+	}
+	return included, nil
+}
+
+// ExpandEnv replaces ${VAR} in s by value of variable VAR looked up by function lookup.
+// Supported forms:
+//
+//	${VAR}          value of VAR, empty if VAR not set
+//	${VAR:-default} default if VAR not set or empty
+//	${VAR-default}  default if VAR not set
+//	${VAR:?message} error with message if VAR not set or empty
+//	$${VAR}         literal ${VAR}
+//
+// default may contain ${...} too.
+func ExpandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			buf.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		// find matched }
+		depth, end := 0, -1
+		for j := i + 2; j < len(s); j++ {
+			if strings.HasPrefix(s[j:], "${") {
+				depth++
+				j++
+			} else if s[j] == '}' {
+				if depth == 0 {
+					end = j
+					break
+				}
+				depth--
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference %q", s[i:])
+		}
+		value, err := expandVar(s[i+2:end], lookup)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+		i = end + 1
+	}
+	return buf.String(), nil
+}
+
+func expandVar(expr string, lookup func(string) (string, bool)) (string, error) {
+	name, op, arg := expr, "", ""
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		name, op = expr[:i], expr[i:]
+		switch {
+		case strings.HasPrefix(op, ":-"), strings.HasPrefix(op, ":?"):
+			op, arg = op[:2], op[2:]
+		case strings.HasPrefix(op, "-"):
+			op, arg = op[:1], op[1:]
+		default:
+			return "", fmt.Errorf("bad variable reference ${%s}", expr)
+		}
+		break
+	}
+	if name == "" {
+		return "", fmt.Errorf("bad variable reference ${%s}", expr)
+	}
+	value, ok := lookup(name)
+	switch op {
+	case ":-":
+		if !ok || value == "" {
+			return ExpandEnv(arg, lookup)
+		}
+	case "-":
+		if !ok {
+			return ExpandEnv(arg, lookup)
+		}
+	case ":?":
+		if !ok || value == "" {
+			if arg == "" {
+				arg = "not set"
+			}
+			return "", fmt.Errorf("variable %s: %s", name, arg)
+		}
+	}
+	return value, nil
+}
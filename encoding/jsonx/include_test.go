@@ -0,0 +1,110 @@
+package jsonx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{
+		"HOST":  "example.com",
+		"EMPTY": "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	for i, ts := range []struct {
+		src, want, err string
+	}{
+		{"abc", "abc", ""},
+		{"$HOST", "$HOST", ""},
+		{"${HOST}:80", "example.com:80", ""},
+		{"${PORT}", "", ""},
+		{"${PORT:-8080}", "8080", ""},
+		{"${EMPTY:-x}", "x", ""},
+		{"${EMPTY-x}", "", ""},
+		{"${PORT-x}", "x", ""},
+		{"${PORT:-${HOST}}", "example.com", ""},
+		{"$${HOST}", "${HOST}", ""},
+		{"${HOST:?required}", "example.com", ""},
+		{"${PORT:?required}", "", "variable PORT: required"},
+		{"${HOST", "", `unterminated variable reference "${HOST"`},
+		{"${1X}", "", "bad variable reference ${1X}"},
+	} {
+		got, err := ExpandEnv(ts.src, lookup)
+		if ts.err != "" {
+			if err == nil || err.Error() != ts.err {
+				t.Errorf("%dth: want error %q, but got %v", i, ts.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%dth: unexpected error %v", i, err)
+		} else if got != ts.want {
+			t.Errorf("%dth: want %q, but got %q", i, ts.want, got)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"app.json": `{
+			"db": {"$include": "common/db.json", "name": "app"},
+			"cycle": {"$include": "cycle1.json"},
+		}`,
+		"common/db.json": `{
+			// comment
+			"host": "${DB_HOST:-localhost}",
+			"name": "default",
+			"port": oops
+		}`,
+		"cycle1.json": `{"$include": "cycle2.json"}`,
+		"cycle2.json": `[{"$include": "cycle1.json"}]`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := []Option{WithComment(), WithExtraComma(), WithInclude(), WithEnv()}
+
+	// include cycle
+	_, err = ReadFile(filepath.Join(dir, "app.json"), opts...)
+	want := "include cycle " + filepath.Join(dir, "cycle1.json") + " -> " + filepath.Join(dir, "cycle2.json") +
+		" -> " + filepath.Join(dir, "cycle1.json") + " at " + filepath.Join(dir, "cycle2.json") + ":1:15"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, but got %v", want, err)
+	}
+
+	node, err := ReadBytes([]byte(`{"db": {"$include": "common/db.json", "name": "app", "port": 3306}}`),
+		append(opts, WithFilename(filepath.Join(dir, "main.json")))...)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	db := node.ByKey("db")
+	if pos := db.ByKey("host").Pos(); pos.Filename != filepath.Join(dir, "common/db.json") || pos.Line != 3 {
+		t.Errorf("position of included node should point into included file, but got %v", pos)
+	}
+	var buf bytes.Buffer
+	Write(&buf, node)
+	if got, want := buf.String(), `{"db":{"host":"localhost","name":"app","port":3306}}`; got != want {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+
+	_, err = ReadBytes([]byte(`{"$include": "missing.json"}`), WithInclude())
+	if err == nil || !strings.HasPrefix(err.Error(), "include: open missing.json:") {
+		t.Errorf("want include error, but got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"text/scanner"
 )
@@ -20,6 +21,20 @@ type options struct {
 	unquotedKey bool
 	// extra comma could be insert to end of last node of object or array if extraComma is true
 	extraComma bool
+	// filename used in positions of nodes
+	filename string
+	// both quoted and unquoted keys accepted if anyKey is true
+	anyKey bool
+	// keys of object sorted while formatting if sortKeys is true
+	sortKeys bool
+	// object {"$include": "filename"} replaced by content of the file if include is true
+	include bool
+	// ${VAR} in strings expanded by lookupEnv if lookupEnv is not nil
+	lookupEnv func(string) (string, bool)
+	// absolute filenames of including files, used to detect include cycle
+	includeStack []string
+	// bad members skipped and all syntax errors reported if allErrors is true
+	allErrors bool
 }
 
 func (opt options) clone(dst *options) {
@@ -28,6 +43,13 @@ func (opt options) clone(dst *options) {
 	dst.supportComment = opt.supportComment
 	dst.unquotedKey = opt.unquotedKey
 	dst.extraComma = opt.extraComma
+	dst.filename = opt.filename
+	dst.anyKey = opt.anyKey
+	dst.sortKeys = opt.sortKeys
+	dst.include = opt.include
+	dst.lookupEnv = opt.lookupEnv
+	dst.includeStack = opt.includeStack
+	dst.allErrors = opt.allErrors
 }
 
 // WithComment returns an option which sets supportComment true
@@ -65,6 +87,59 @@ func WithExtraComma() Option {
 	}
 }
 
+// WithSortKeys returns an option which sorts keys of objects while formatting
+func WithSortKeys() Option {
+	return func(opt *options) {
+		opt.sortKeys = true
+	}
+}
+
+// WithFilename returns an option which sets filename of source, the filename used
+// in positions of nodes and as base of relative include paths
+func WithFilename(filename string) Option {
+	return func(opt *options) {
+		opt.filename = filename
+	}
+}
+
+// WithInclude returns an option which enables include directive, i.e. value
+//
+//	{"$include": "common.json"}
+//
+// replaced by content of file common.json located relative to the including file.
+// Other members of the including object override members of included object.
+func WithInclude() Option {
+	return func(opt *options) {
+		opt.include = true
+	}
+}
+
+// WithEnv returns an option which expands environment variables in strings, e.g.
+//
+//	"${HOME}/data"
+//	"${HOST:-localhost}:${PORT:-8080}"
+//
+// See ExpandEnv for supported forms
+func WithEnv() Option {
+	return WithLookupEnv(os.LookupEnv)
+}
+
+// WithLookupEnv likes WithEnv but looks up variables by function lookup
+func WithLookupEnv(lookup func(string) (string, bool)) Option {
+	return func(opt *options) {
+		opt.lookupEnv = lookup
+	}
+}
+
+// WithAllErrors returns an option which makes reader skip bad members of
+// objects and arrays and report all syntax errors as an *errors.ErrorList
+// instead of stopping at the first one
+func WithAllErrors() Option {
+	return func(opt *options) {
+		opt.allErrors = true
+	}
+}
+
 func applyOptions(opts []Option) options {
 	opt := options{}
 	for _, o := range opts {
@@ -75,18 +150,36 @@ func applyOptions(opts []Option) options {
 
 // Read reads a json node from reader r
 func Read(r io.Reader, opts ...Option) (Node, error) {
-	opt := applyOptions(opts)
+	node, _, err := read(r, applyOptions(opts))
+	return node, err
+}
+
+func read(r io.Reader, opt options) (Node, *parser, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
 	s := new(scanner.Scanner)
-	s = s.Init(r)
+	s = s.Init(bytes.NewReader(src))
+	s.Filename = opt.filename
 	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanChars | scanner.ScanStrings
 	if opt.supportComment {
 		s.Mode |= scanner.ScanComments
 	}
 	p := new(parser)
+	p.SetSource(src)
 	if err := p.init(s, opt); err != nil {
-		return nil, err
+		return nil, p, err
+	}
+	node, err := p.parseNode()
+	if p.errs.Len() > 0 {
+		p.errs.Add(err)
+		return node, p, p.errs.Err()
+	}
+	if err == nil && (opt.include || opt.lookupEnv != nil) {
+		node, err = expand(node, opt)
 	}
-	return p.parseNode()
+	return node, p, err
 }
 
 // ReadBytes reads a json node from bytes
@@ -101,7 +194,7 @@ func ReadFile(filename string, opts ...Option) (Node, error) {
 		return nil, err
 	}
 	defer file.Close()
-	return Read(file, opts...)
+	return Read(file, append(opts, WithFilename(filename))...)
 }
 
 // Write writes a json node to writer w
@@ -4,9 +4,12 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
 )
 
-func ExampleDecode() {
+func ExampleRead() {
 	r := strings.NewReader(`{"a":1,"b":true,"c":[{"x":1.2},{"y":2.3}],"d":{},"e":-1,"f":+1}`)
 	node, err := Read(r)
 	if err != nil {
@@ -31,7 +34,7 @@ func ExampleDecode() {
 	// }
 }
 
-func ExampleDecodeExtraComma() {
+func ExampleRead_extraComma() {
 	r := strings.NewReader(`{"a":1,"b":true,"c":[{"x":1.2},{"y":2.3},],"d":{},}`)
 	node, err := Read(r, WithExtraComma())
 	if err != nil {
@@ -67,7 +70,7 @@ func ExampleDecodeExtraComma() {
 	// }
 }
 
-func ExampleDecodeWithUnquotedKey() {
+func ExampleRead_unquotedKey() {
 	r := strings.NewReader(`{a:1,b:true,c:[{x:1.2},{y:2.3}],d:{}}`)
 	node, err := Read(r, WithUnquotedKey())
 	if err != nil {
@@ -103,7 +106,7 @@ func ExampleDecodeWithUnquotedKey() {
 	// }
 }
 
-func ExampleDecodeWithComment() {
+func ExampleRead_comment() {
 	r := strings.NewReader(`{
 	// doc a
 	"a":1, // line a
@@ -163,45 +166,45 @@ func TestParser(t *testing.T) {
 	type argt struct {
 		src  string
 		err  string
-		kind NodeKind
+		kind encoding.NodeKind
 		opt  options
 	}
 	for i, ts := range []argt{
-		{``, "unexpected begin of json node  at <input>:1:1", InvalidNode, options{}},
-		{`%`, "unexpected begin of json node % at <input>:1:2", InvalidNode, options{}},
-		{`(`, "unexpected begin of json node ( at <input>:1:2", InvalidNode, options{}},
-		{`{]`, "expect a string or `}`, but got `]` at <input>:1:3", InvalidNode, options{}},
-		{`//comment`, "unexpected begin of json node / at <input>:1:2", InvalidNode, options{}},
-		{`/*comment*/`, "unexpected begin of json node / at <input>:1:2", InvalidNode, options{}},
-		{`1`, "", IntNode, options{}},
-		{`1.2`, "", FloatNode, options{}},
-		{`/*comment*/1.2`, "", FloatNode, options{supportComment: true}},
-		{`abc`, "", IdentNode, options{}},
-		{`abc//comment`, "", IdentNode, options{supportComment: true}},
-		{`'a'`, "", CharNode, options{}},
-		{`''`, "illegal char literal at <input>:1:2", InvalidNode, options{}},
-		{`'xxx'`, "illegal char literal at <input>:1:5", InvalidNode, options{}},
-		{`""`, "", StringNode, options{}},
-		{`"abcd"`, "", StringNode, options{}},
-		{`'abcd"`, "illegal char literal at <input>:1:7", InvalidNode, options{}},
+		{``, "unexpected begin of json node  at <input>:1:1", encoding.InvalidNode, options{}},
+		{`%`, "unexpected begin of json node % at <input>:1:1", encoding.InvalidNode, options{}},
+		{`(`, "unexpected begin of json node ( at <input>:1:1", encoding.InvalidNode, options{}},
+		{`{]`, "expect a string or `}`, but got `]` at <input>:1:2", encoding.InvalidNode, options{}},
+		{`//comment`, "unexpected begin of json node / at <input>:1:1", encoding.InvalidNode, options{}},
+		{`/*comment*/`, "unexpected begin of json node / at <input>:1:1", encoding.InvalidNode, options{}},
+		{`1`, "", encoding.IntNode, options{}},
+		{`1.2`, "", encoding.FloatNode, options{}},
+		{`/*comment*/1.2`, "", encoding.FloatNode, options{supportComment: true}},
+		{`abc`, "", encoding.IdentNode, options{}},
+		{`abc//comment`, "", encoding.IdentNode, options{supportComment: true}},
+		{`'a'`, "", encoding.CharNode, options{}},
+		{`''`, "invalid char literal at <input>:1:2", encoding.InvalidNode, options{}},
+		{`'xxx'`, "invalid char literal at <input>:1:5", encoding.InvalidNode, options{}},
+		{`""`, "", encoding.StringNode, options{}},
+		{`"abcd"`, "", encoding.StringNode, options{}},
+		{`'abcd"`, "invalid char literal at <input>:1:7", encoding.InvalidNode, options{}},
 		{`// doc
-		"abcd"`, "", StringNode, options{supportComment: true}},
-		{`{"x":1}`, "", ObjectNode, options{}},
-		{`{"x":1,}`, "extra comma found at <input>:1:8", InvalidNode, options{}},
-		{`{"x":1,}`, "", ObjectNode, options{extraComma: true}},
-		{`{"x":1,"y":{}}`, "", ObjectNode, options{}},
-		{`{"x":1,"y":{]}`, "expect a string or `}`, but got `]` at <input>:1:14", InvalidNode, options{}},
-		{`{"x":1,"y":{/**/}}`, "", ObjectNode, options{supportComment: true}},
-		{`{"x":1,"y":{//}}`, "expect `}`, but got EOF at <input>:1:17", InvalidNode, options{supportComment: true}},
-		{`[]`, "", ArrayNode, options{}},
-		{`[x]`, "", ArrayNode, options{}},
-		{`[x, y, z]`, "", ArrayNode, options{}},
-		{`["x", "y", z]`, "", ArrayNode, options{}},
-		{`[{}]`, "", ArrayNode, options{}},
-		{`[1,{}]`, "", ArrayNode, options{}},
-		{`[-1,{}]`, "", ArrayNode, options{}},
-		{`{x:1}`, "expect a string or `}`, but got `x` at <input>:1:3", InvalidNode, options{}},
-		{`{x:1}`, "", ObjectNode, options{unquotedKey: true}},
+		"abcd"`, "", encoding.StringNode, options{supportComment: true}},
+		{`{"x":1}`, "", encoding.ObjectNode, options{}},
+		{`{"x":1,}`, "extra comma found at <input>:1:7", encoding.InvalidNode, options{}},
+		{`{"x":1,}`, "", encoding.ObjectNode, options{extraComma: true}},
+		{`{"x":1,"y":{}}`, "", encoding.ObjectNode, options{}},
+		{`{"x":1,"y":{]}`, "expect a string or `}`, but got `]` at <input>:1:13", encoding.InvalidNode, options{}},
+		{`{"x":1,"y":{/**/}}`, "", encoding.ObjectNode, options{supportComment: true}},
+		{`{"x":1,"y":{//}}`, "expect `}`, but got EOF at <input>:1:17", encoding.InvalidNode, options{supportComment: true}},
+		{`[]`, "", encoding.ArrayNode, options{}},
+		{`[x]`, "", encoding.ArrayNode, options{}},
+		{`[x, y, z]`, "", encoding.ArrayNode, options{}},
+		{`["x", "y", z]`, "", encoding.ArrayNode, options{}},
+		{`[{}]`, "", encoding.ArrayNode, options{}},
+		{`[1,{}]`, "", encoding.ArrayNode, options{}},
+		{`[-1,{}]`, "", encoding.ArrayNode, options{}},
+		{`{x:1}`, "expect a string or `}`, but got `x` at <input>:1:2", encoding.InvalidNode, options{}},
+		{`{x:1}`, "", encoding.ObjectNode, options{unquotedKey: true}},
 	} {
 		r := strings.NewReader(ts.src)
 		node, err := Read(r, ts.opt.clone)
@@ -333,3 +336,59 @@ func TestUnmarshal(t *testing.T) {
 		return
 	}
 }
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Read(strings.NewReader("{\n\t\"a\": 1 \"b\": 2\n}"), WithFilename("a.json"))
+	e, ok := err.(*encoding.SyntaxError)
+	if !ok {
+		t.Fatalf("want *encoding.SyntaxError, but got %T", err)
+	}
+	if e.Pos.Filename != "a.json" || e.Pos.Line != 2 || e.Pos.Column != 9 || e.Pos.Offset != 10 {
+		t.Errorf("unexpected position %v(offset %d)", e.Pos, e.Pos.Offset)
+	}
+	if e.Expected != "`,`" || e.Found != "`\"b\"`" {
+		t.Errorf("unexpected expected %s and found %s", e.Expected, e.Found)
+	}
+	if want := "\t\"a\": 1 \"b\": 2\n\t       ^"; e.Excerpt() != want {
+		t.Errorf("want excerpt\n%s\nbut got\n%s", want, e.Excerpt())
+	}
+
+	for i, ts := range []struct {
+		src  string
+		errs []string
+		size int
+	}{
+		{`{"a":1,"b":2}`, nil, 2},
+		{`{"a":1 "b":2,"c":3}`, []string{"expect `,`, but got `\"b\"` at <input>:1:8"}, 2},
+		{`{"a":x-,"b":{]},"c":[1,,2,]}`, []string{
+			"expect `,`, but got `-` at <input>:1:7",
+			"expect a string or `}`, but got `]` at <input>:1:14",
+			"unexpected begin of json node , at <input>:1:24",
+			"extra comma found at <input>:1:26",
+		}, 3},
+		{`{"a":1,"b":`, []string{
+			"unexpected begin of json node  at <input>:1:12",
+			"expect `}`, but got EOF at <input>:1:12",
+		}, 0},
+	} {
+		node, err := Read(strings.NewReader(ts.src), WithAllErrors())
+		var got []string
+		if err != nil {
+			list, ok := err.(*errors.ErrorList)
+			if !ok {
+				t.Errorf("%dth: want *errors.ErrorList, but got %T", i, err)
+				continue
+			}
+			for _, e := range list.Errors() {
+				got = append(got, e.Error())
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(ts.errs, "\n") {
+			t.Errorf("%dth: want errors\n%s\nbut got\n%s", i, strings.Join(ts.errs, "\n"), strings.Join(got, "\n"))
+			continue
+		}
+		if ts.size > 0 && (node == nil || node.NumChild() != ts.size) {
+			t.Errorf("%dth: want %d members, but got %v", i, ts.size, node)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"text/scanner"
 
 	"github.com/mkideal/pkg/encoding"
@@ -76,11 +77,13 @@ func outputNodeTail(w io.Writer, n Node, topNode, lastNode bool, opt options) er
 type kv struct {
 	key   string
 	value Node
+	pos   scanner.Position // position of key
 }
 
 // nodebase represents base of any json node
 type nodebase struct {
 	pos     scanner.Position
+	end     scanner.Position // position immediately after the node
 	doc     *encoding.CommentGroup
 	comment *encoding.CommentGroup
 }
@@ -103,21 +106,38 @@ func newObjectNode() *objectNode {
 }
 
 func (n *objectNode) addChild(key string, value Node) {
+	n.addChildAt(key, value, scanner.Position{})
+}
+
+func (n *objectNode) addChildAt(key string, value Node, pos scanner.Position) {
 	if n.indexMap == nil {
 		n.indexMap = make(map[string]int)
 	}
-	index, ok := n.indexMap[key]
+	name := unquoteKey(key)
+	index, ok := n.indexMap[name]
 	if !ok {
-		n.children = append(n.children, kv{key, value})
+		n.indexMap[name] = len(n.children)
+		n.children = append(n.children, kv{key, value, pos})
 	} else {
 		n.children[index].value = value
+		n.children[index].pos = pos
+	}
+}
+
+// unquoteKey returns name of key, key may be quoted with "
+func unquoteKey(key string) string {
+	if len(key) > 0 && key[0] == '"' {
+		if name, err := strconv.Unquote(key); err == nil {
+			return name
+		}
 	}
+	return key
 }
 
 func (n objectNode) Value() interface{} {
 	m := make(map[string]interface{})
 	for _, kv := range n.children {
-		m[kv.key] = kv.value.Value()
+		m[unquoteKey(kv.key)] = kv.value.Value()
 	}
 	return m
 }
@@ -130,7 +150,7 @@ func (n objectNode) ByKey(key string) Node {
 	if n.indexMap == nil {
 		return nil
 	}
-	index, ok := n.indexMap[key]
+	index, ok := n.indexMap[unquoteKey(key)]
 	if !ok {
 		return nil
 	}
@@ -283,7 +303,7 @@ func newLiteralNode(pos scanner.Position, tok rune, value string) (*literalNode,
 func (n literalNode) Value() interface{} {
 	switch n.kind {
 	case encoding.CharNode:
-		value, _, _, _ := strconv.UnquoteChar(n.value, '\'')
+		value, _, _, _ := strconv.UnquoteChar(strings.TrimPrefix(n.value, "'"), '\'')
 		return value
 	case encoding.StringNode:
 		value, _ := strconv.Unquote(n.value)
@@ -1,10 +1,10 @@
 package jsonx
 
 import (
-	"fmt"
 	"text/scanner"
 
 	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
 )
 
 const (
@@ -21,7 +21,8 @@ const (
 // parser parses json
 type parser struct {
 	encoding.Parser
-	opt options
+	opt  options
+	errs errors.ErrorList // errors of skipped members if opt.allErrors is true
 }
 
 func (p *parser) init(s *scanner.Scanner, opt options) error {
@@ -34,12 +35,39 @@ func (p *parser) expect(tok rune) error {
 	if p.Tok == tok {
 		return p.Next() // make progress
 	}
-	lit := "`" + p.Lit + "`"
-	if p.Tok == scanner.EOF {
-		lit = "EOF"
+	return p.ErrorExpected(p.TokPos, "`"+string(tok)+"`")
+}
+
+// recover records err and skips tokens until next member of current object or
+// array which is closed by closeTok. It returns false if err should be returned,
+// i.e. opt.allErrors is false or err is reported by scanner.
+func (p *parser) recover(err error, closeTok rune) bool {
+	if !p.opt.allErrors || p.Err() != nil {
+		return false
+	}
+	p.errs.Add(err)
+	depth := 0
+	for p.Tok != scanner.EOF {
+		switch p.Tok {
+		case opLBrace, opLBrack:
+			depth++
+		case opRBrace, opRBrack:
+			if depth == 0 && p.Tok == closeTok {
+				return true
+			}
+			if depth > 0 {
+				depth--
+			}
+		case opComma:
+			if depth == 0 {
+				return p.Next() == nil
+			}
+		}
+		if p.Next() != nil {
+			return false
+		}
 	}
-	err := fmt.Errorf("expect `%s`, but got %s at %s", string(tok), lit, p.Pos)
-	return err
+	return true
 }
 
 func (p *parser) parseNode() (Node, error) {
@@ -55,45 +83,46 @@ func (p *parser) parseNode() (Node, error) {
 	default:
 		n, err := newLiteralNode(p.Pos, p.Tok, p.Lit)
 		if err != nil {
-			return nil, err
+			return nil, p.Errorf(p.TokPos, "unexpected begin of json node %v", p.Lit)
 		}
+		n.pos = p.TokPos
+		n.end = p.Pos
 		err = p.Next()
 		return n, err
 	}
 }
 
 func (p *parser) parseSignNode(pfxTok rune) (Node, error) {
+	pos := p.TokPos
 	if err := p.Next(); err != nil {
 		return nil, err
 	}
-	lit := "`" + p.Lit + "`"
-	if p.Tok == scanner.EOF {
-		lit = "EOF"
-	}
 	if p.Tok != scanner.Float && p.Tok != scanner.Int {
-		return nil, fmt.Errorf("expect float or integer, but got %v at %v", lit, p.Pos)
+		return nil, p.ErrorExpected(p.TokPos, "float or integer")
 	}
 	node, err := newLiteralNode(p.Pos, p.Tok, p.Lit)
 	if err != nil {
 		return nil, err
 	}
+	node.pos = pos
+	node.end = p.Pos
 	err = p.Next()
 	node.value = string(pfxTok) + node.value
 	return node, err
 }
 
 func (p *parser) parseKey() (key string, err error) {
-	lit := "`" + p.Lit + "`"
-	if p.Tok == scanner.EOF {
-		lit = "EOF"
-	}
-	if p.opt.unquotedKey {
+	if p.opt.anyKey {
+		if p.Tok != scanner.String && p.Tok != scanner.Ident {
+			err = p.ErrorExpected(p.TokPos, "a string, identifier or `}`")
+		}
+	} else if p.opt.unquotedKey {
 		if p.Tok != scanner.Ident {
-			err = fmt.Errorf("expect a identifier or `}`, but got %s at %v", lit, p.Pos)
+			err = p.ErrorExpected(p.TokPos, "a identifier or `}`")
 		}
 	} else {
 		if p.Tok != scanner.String {
-			err = fmt.Errorf("expect a string or `}`, but got %s at %v", lit, p.Pos)
+			err = p.ErrorExpected(p.TokPos, "a string or `}`")
 		}
 	}
 	if err == nil {
@@ -105,7 +134,7 @@ func (p *parser) parseKey() (key string, err error) {
 
 func (p *parser) parseObjectNode() (Node, error) {
 	doc := p.LeadComment
-	pos := p.Pos
+	pos := p.TokPos
 	if err := p.expect(opLBrace); err != nil {
 		return nil, err
 	}
@@ -114,33 +143,47 @@ func (p *parser) parseObjectNode() (Node, error) {
 	obj.pos = pos
 	for p.Tok != scanner.EOF && p.Tok != opRBrace {
 		doc := p.LeadComment
+		keyPos := p.TokPos
 		key, err := p.parseKey()
-		if err != nil {
-			return nil, err
+		if err == nil {
+			err = p.expect(opColon)
 		}
-		if err := p.expect(opColon); err != nil {
-			return nil, err
+		var value Node
+		if err == nil {
+			value, err = p.parseNode()
 		}
-		value, err := p.parseNode()
 		if err != nil {
+			if p.recover(err, opRBrace) {
+				continue
+			}
 			return nil, err
 		}
 		value.setDoc(doc)
 		comment := p.LineComment
 		if p.Tok != opRBrace {
-			pos := p.Pos
+			pos := p.TokPos
 			if err := p.expect(opComma); err != nil {
+				if p.recover(err, opRBrace) {
+					// member is valid but comma missing
+					value.setComment(comment)
+					obj.addChildAt(key, value, keyPos)
+					continue
+				}
 				return nil, err
 			}
 			comment = p.LineComment
 			// extra comma not allowed at last node of object but found
 			if !p.opt.extraComma && p.Tok == opRBrace {
-				return nil, fmt.Errorf("extra comma found at %v", pos)
+				err := p.Errorf(pos, "extra comma found")
+				if !p.recover(err, opRBrace) {
+					return nil, err
+				}
 			}
 		}
 		value.setComment(comment)
-		obj.addChild(key, value)
+		obj.addChildAt(key, value, keyPos)
 	}
+	obj.end = p.Pos
 	if err := p.expect(opRBrace); err != nil {
 		return nil, err
 	}
@@ -150,7 +193,7 @@ func (p *parser) parseObjectNode() (Node, error) {
 
 func (p *parser) parseArrayNode() (Node, error) {
 	doc := p.LeadComment
-	pos := p.Pos
+	pos := p.TokPos
 	if err := p.expect(opLBrack); err != nil {
 		return nil, err
 	}
@@ -161,21 +204,31 @@ func (p *parser) parseArrayNode() (Node, error) {
 		doc := p.LeadComment
 		value, err := p.parseNode()
 		if err != nil {
+			if p.recover(err, opRBrack) {
+				continue
+			}
 			return nil, err
 		}
 		value.setDoc(doc)
 		arr.addChild(value)
 		if p.Tok != opRBrack {
-			pos := p.Pos
+			pos := p.TokPos
 			if err := p.expect(opComma); err != nil {
+				if p.recover(err, opRBrack) {
+					continue
+				}
 				return nil, err
 			}
 			// extra comma not allowed at last node of array but found
 			if !p.opt.extraComma && p.Tok == opRBrack {
-				return nil, fmt.Errorf("extra comma found at %v", pos)
+				err := p.Errorf(pos, "extra comma found")
+				if !p.recover(err, opRBrack) {
+					return nil, err
+				}
 			}
 		}
 	}
+	arr.end = p.Pos
 	if err := p.expect(opRBrack); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,641 @@
+package jsonx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/mkideal/pkg/encoding"
+	"github.com/mkideal/pkg/errors"
+)
+
+// Schema represents a JSON Schema, only a subset of draft-07 supported:
+//
+//	type, required, properties, items, enum,
+//	minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+//	minLength, maxLength, minItems, maxItems, pattern
+//
+// title, description and default are kept as annotations
+type Schema struct {
+	Title       string
+	Description string
+	Default     interface{}
+
+	Type             []string
+	Required         []string
+	Properties       map[string]*Schema
+	Items            *Schema
+	Enum             []interface{}
+	Minimum          *float64
+	Maximum          *float64
+	ExclusiveMinimum *float64
+	ExclusiveMaximum *float64
+	MinLength        *int
+	MaxLength        *int
+	MinItems         *int
+	MaxItems         *int
+	Pattern          string
+
+	pattern *regexp.Regexp
+}
+
+// ReadSchema reads a schema from reader r, comments and extra comma are always allowed
+func ReadSchema(r io.Reader, opts ...Option) (*Schema, error) {
+	opts = append([]Option{WithComment(), WithExtraComma()}, opts...)
+	node, err := Read(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewSchema(node)
+}
+
+// ReadSchemaFile reads a schema from file
+func ReadSchemaFile(filename string, opts ...Option) (*Schema, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSchema(file, append(opts, WithFilename(filename))...)
+}
+
+// NewSchema creates a schema from json node
+func NewSchema(node Node) (*Schema, error) {
+	if node.Kind() != encoding.ObjectNode {
+		return nil, fmt.Errorf("schema must be an object at %v", node.Pos())
+	}
+	s := new(Schema)
+	for i, n := 0, node.NumChild(); i < n; i++ {
+		key, child := node.ByIndex(i)
+		if err := s.set(unquoteKey(key), child); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) set(key string, node Node) (err error) {
+	switch key {
+	case "title":
+		s.Title, err = schemaString(key, node)
+	case "description":
+		s.Description, err = schemaString(key, node)
+	case "default":
+		s.Default = nodeValue(node)
+	case "type":
+		if node.Kind() == encoding.ArrayNode {
+			s.Type, err = schemaStrings(key, node)
+		} else {
+			var typ string
+			if typ, err = schemaString(key, node); err == nil {
+				s.Type = []string{typ}
+			}
+		}
+		if err == nil {
+			for _, typ := range s.Type {
+				if !isSchemaType(typ) {
+					return fmt.Errorf("unknown schema type %q at %v", typ, node.Pos())
+				}
+			}
+		}
+	case "required":
+		s.Required, err = schemaStrings(key, node)
+	case "properties":
+		if node.Kind() != encoding.ObjectNode {
+			return fmt.Errorf("schema keyword %q must be an object at %v", key, node.Pos())
+		}
+		s.Properties = make(map[string]*Schema)
+		for i, n := 0, node.NumChild(); i < n; i++ {
+			name, child := node.ByIndex(i)
+			prop, err := NewSchema(child)
+			if err != nil {
+				return err
+			}
+			s.Properties[unquoteKey(name)] = prop
+		}
+	case "items":
+		s.Items, err = NewSchema(node)
+	case "enum":
+		if node.Kind() != encoding.ArrayNode {
+			return fmt.Errorf("schema keyword %q must be an array at %v", key, node.Pos())
+		}
+		s.Enum = nodeValue(node).([]interface{})
+	case "minimum":
+		s.Minimum, err = schemaNumber(key, node)
+	case "maximum":
+		s.Maximum, err = schemaNumber(key, node)
+	case "exclusiveMinimum":
+		s.ExclusiveMinimum, err = schemaNumber(key, node)
+	case "exclusiveMaximum":
+		s.ExclusiveMaximum, err = schemaNumber(key, node)
+	case "minLength":
+		s.MinLength, err = schemaInt(key, node)
+	case "maxLength":
+		s.MaxLength, err = schemaInt(key, node)
+	case "minItems":
+		s.MinItems, err = schemaInt(key, node)
+	case "maxItems":
+		s.MaxItems, err = schemaInt(key, node)
+	case "pattern":
+		if s.Pattern, err = schemaString(key, node); err == nil {
+			if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+				err = fmt.Errorf("invalid pattern %q: %v at %v", s.Pattern, err, node.Pos())
+			}
+		}
+	}
+	// unsupported keywords are ignored
+	return
+}
+
+func schemaString(key string, node Node) (string, error) {
+	if node.Kind() != encoding.StringNode {
+		return "", fmt.Errorf("schema keyword %q must be a string at %v", key, node.Pos())
+	}
+	return node.Value().(string), nil
+}
+
+func schemaStrings(key string, node Node) ([]string, error) {
+	if node.Kind() != encoding.ArrayNode {
+		return nil, fmt.Errorf("schema keyword %q must be an array of strings at %v", key, node.Pos())
+	}
+	s := make([]string, 0, node.NumChild())
+	for i, n := 0, node.NumChild(); i < n; i++ {
+		_, child := node.ByIndex(i)
+		str, err := schemaString(key, child)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, str)
+	}
+	return s, nil
+}
+
+func schemaNumber(key string, node Node) (*float64, error) {
+	f, ok := nodeValue(node).(float64)
+	if !ok {
+		return nil, fmt.Errorf("schema keyword %q must be a number at %v", key, node.Pos())
+	}
+	return &f, nil
+}
+
+func schemaInt(key string, node Node) (*int, error) {
+	f, ok := nodeValue(node).(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("schema keyword %q must be a non-negative integer at %v", key, node.Pos())
+	}
+	i := int(f)
+	return &i, nil
+}
+
+func isSchemaType(typ string) bool {
+	switch typ {
+	case "null", "boolean", "object", "array", "number", "integer", "string":
+		return true
+	}
+	return false
+}
+
+// nodeValue returns value of node as a generic json value,
+// i.e. nil, bool, float64, string, []interface{} or map[string]interface{}
+func nodeValue(node Node) interface{} {
+	switch node.Kind() {
+	case encoding.ObjectNode:
+		m := make(map[string]interface{})
+		for i, n := 0, node.NumChild(); i < n; i++ {
+			key, child := node.ByIndex(i)
+			m[unquoteKey(key)] = nodeValue(child)
+		}
+		return m
+	case encoding.ArrayNode:
+		s := make([]interface{}, 0, node.NumChild())
+		for i, n := 0, node.NumChild(); i < n; i++ {
+			_, child := node.ByIndex(i)
+			s = append(s, nodeValue(child))
+		}
+		return s
+	case encoding.IntNode:
+		return float64(node.Value().(int64))
+	case encoding.CharNode:
+		return string(node.Value().(rune))
+	case encoding.IdentNode:
+		switch node.Value().(string) {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+	}
+	return node.Value()
+}
+
+// nodeType returns json schema type of node
+func nodeType(node Node) string {
+	switch node.Kind() {
+	case encoding.ObjectNode:
+		return "object"
+	case encoding.ArrayNode:
+		return "array"
+	case encoding.IntNode:
+		return "integer"
+	case encoding.FloatNode:
+		return "number"
+	case encoding.StringNode, encoding.CharNode:
+		return "string"
+	case encoding.IdentNode:
+		switch node.Value().(string) {
+		case "true", "false":
+			return "boolean"
+		case "null":
+			return "null"
+		}
+	}
+	return "unknown"
+}
+
+// SchemaError represents a violation of schema
+type SchemaError struct {
+	Pos  scanner.Position
+	Path string
+	Msg  string
+}
+
+func (e *SchemaError) Error() string {
+	return e.Path + ": " + e.Msg + " at " + e.Pos.String()
+}
+
+// Compile compiles patterns of s and its subschemas. Schemas created by
+// NewSchema are compiled already, schemas built otherwise, e.g. by struct
+// literals, should be compiled before validating, or patterns are compiled
+// in every Validate.
+func (s *Schema) Compile() error {
+	if s.Pattern != "" && (s.pattern == nil || s.pattern.String() != s.Pattern) {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+	for _, prop := range s.Properties {
+		if err := prop.Compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.Compile()
+	}
+	return nil
+}
+
+// Validate validates node by schema, all violations returned as an *errors.ErrorList
+func (s *Schema) Validate(node Node) error {
+	var list errors.ErrorList
+	s.validate(&list, "$", node)
+	return list.Err()
+}
+
+func (s *Schema) validate(list *errors.ErrorList, path string, node Node) {
+	report := func(format string, args ...interface{}) {
+		list.Add(&SchemaError{Pos: node.Pos(), Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+	typ := nodeType(node)
+	if len(s.Type) > 0 && !s.matchType(typ, node) {
+		report("expect type %s, but got %s", strings.Join(s.Type, " or "), typ)
+		return
+	}
+	if len(s.Enum) > 0 {
+		value := nodeValue(node)
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value must be one of %s", formatEnum(s.Enum))
+		}
+	}
+	switch typ {
+	case "integer", "number":
+		f := nodeValue(node).(float64)
+		if s.Minimum != nil && f < *s.Minimum {
+			report("value %v less than minimum %v", f, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			report("value %v greater than maximum %v", f, *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			report("value %v must be greater than %v", f, *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+			report("value %v must be less than %v", f, *s.ExclusiveMaximum)
+		}
+	case "string":
+		str := nodeValue(node).(string)
+		length := len([]rune(str))
+		if s.MinLength != nil && length < *s.MinLength {
+			report("length %d less than minLength %d", length, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			report("length %d greater than maxLength %d", length, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			// uncompiled schemas are not modified, so they can be shared
+			pattern := s.pattern
+			if pattern == nil || pattern.String() != s.Pattern {
+				var err error
+				if pattern, err = regexp.Compile(s.Pattern); err != nil {
+					report("invalid pattern %q: %v", s.Pattern, err)
+				}
+			}
+			if pattern != nil && !pattern.MatchString(str) {
+				report("value %q does not match pattern %q", str, s.Pattern)
+			}
+		}
+	case "array":
+		length := node.NumChild()
+		if s.MinItems != nil && length < *s.MinItems {
+			report("number of items %d less than minItems %d", length, *s.MinItems)
+		}
+		if s.MaxItems != nil && length > *s.MaxItems {
+			report("number of items %d greater than maxItems %d", length, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i := 0; i < length; i++ {
+				_, child := node.ByIndex(i)
+				s.Items.validate(list, path+"["+strconv.Itoa(i)+"]", child)
+			}
+		}
+	case "object":
+		for _, name := range s.Required {
+			if node.ByKey(name) == nil {
+				report("missing required property %q", name)
+			}
+		}
+		for i, n := 0, node.NumChild(); i < n; i++ {
+			key, child := node.ByIndex(i)
+			name := unquoteKey(key)
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(list, path+"."+name, child)
+			}
+		}
+	}
+}
+
+func (s *Schema) matchType(typ string, node Node) bool {
+	for _, t := range s.Type {
+		if t == typ {
+			return true
+		}
+		switch {
+		case t == "number" && typ == "integer":
+			return true
+		case t == "integer" && typ == "number":
+			// 1.0 is an integer too
+			if f := nodeValue(node).(float64); f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatEnum(values []interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(data)
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schemaJSON struct {
+		Title            string             `json:"title,omitempty"`
+		Description      string             `json:"description,omitempty"`
+		Default          interface{}        `json:"default,omitempty"`
+		Type             interface{}        `json:"type,omitempty"`
+		Required         []string           `json:"required,omitempty"`
+		Properties       map[string]*Schema `json:"properties,omitempty"`
+		Items            *Schema            `json:"items,omitempty"`
+		Enum             []interface{}      `json:"enum,omitempty"`
+		Minimum          *float64           `json:"minimum,omitempty"`
+		Maximum          *float64           `json:"maximum,omitempty"`
+		ExclusiveMinimum *float64           `json:"exclusiveMinimum,omitempty"`
+		ExclusiveMaximum *float64           `json:"exclusiveMaximum,omitempty"`
+		MinLength        *int               `json:"minLength,omitempty"`
+		MaxLength        *int               `json:"maxLength,omitempty"`
+		MinItems         *int               `json:"minItems,omitempty"`
+		MaxItems         *int               `json:"maxItems,omitempty"`
+		Pattern          string             `json:"pattern,omitempty"`
+	}
+	v := schemaJSON{
+		Title:            s.Title,
+		Description:      s.Description,
+		Default:          s.Default,
+		Required:         s.Required,
+		Properties:       s.Properties,
+		Items:            s.Items,
+		Enum:             s.Enum,
+		Minimum:          s.Minimum,
+		Maximum:          s.Maximum,
+		ExclusiveMinimum: s.ExclusiveMinimum,
+		ExclusiveMaximum: s.ExclusiveMaximum,
+		MinLength:        s.MinLength,
+		MaxLength:        s.MaxLength,
+		MinItems:         s.MinItems,
+		MaxItems:         s.MaxItems,
+		Pattern:          s.Pattern,
+	}
+	if len(s.Type) == 1 {
+		v.Type = s.Type[0]
+	} else if len(s.Type) > 1 {
+		v.Type = s.Type
+	}
+	return json.Marshal(v)
+}
+
+// SchemaOf generates a schema from value v which should be a struct or pointer to struct.
+//
+// Properties are named by `json` tag, fields without `omitempty` are required,
+// `usage` tag used as description and non-zero field values used as defaults,
+// so a config struct filled with default values can be passed directly.
+func SchemaOf(v interface{}) (*Schema, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("jsonx: SchemaOf(nil)")
+	}
+	return schemaOfValue(rv.Type(), rv, make(map[reflect.Type]bool))
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*interface {
+		MarshalText() ([]byte, error)
+	})(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func schemaOfValue(t reflect.Type, v reflect.Value, visiting map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Value{}
+			} else {
+				v = v.Elem()
+			}
+		}
+	}
+	s := new(Schema)
+	if v.IsValid() && t.Kind() != reflect.Struct && !isZeroValue(v) {
+		s.Default = v.Interface()
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		// unknown output of json.Marshaler
+		return s, nil
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		s.Type = []string{"string"}
+		return s, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = []string{"boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = []string{"integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.Type = []string{"integer"}
+		min := 0.0
+		s.Minimum = &min
+	case reflect.Float32, reflect.Float64:
+		s.Type = []string{"number"}
+	case reflect.String:
+		s.Type = []string{"string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte encoded as base64 string
+			s.Type = []string{"string"}
+			break
+		}
+		s.Type = []string{"array"}
+		items, err := schemaOfValue(t.Elem(), reflect.Value{}, visiting)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("jsonx: unsupported map key type %v", t.Key())
+		}
+		s.Type = []string{"object"}
+	case reflect.Interface:
+		// any type
+	case reflect.Struct:
+		if visiting[t] {
+			// recursive type
+			s.Type = []string{"object"}
+			break
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		s.Type = []string{"object"}
+		s.Properties = make(map[string]*Schema)
+		if err := schemaOfFields(s, t, v, visiting); err != nil {
+			return nil, err
+		}
+		sort.Strings(s.Required)
+	default:
+		return nil, fmt.Errorf("jsonx: unsupported type %v", t)
+	}
+	return s, nil
+}
+
+func schemaOfFields(s *Schema, t reflect.Type, v reflect.Value, visiting map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				if fv.IsValid() {
+					if fv.IsNil() {
+						fv = reflect.Value{}
+					} else {
+						fv = fv.Elem()
+					}
+				}
+			}
+			if ft.Kind() == reflect.Struct {
+				// fields of embedded struct promoted
+				if err := schemaOfFields(s, ft, fv, visiting); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop, err := schemaOfValue(field.Type, fv, visiting)
+		if err != nil {
+			return err
+		}
+		prop.Description = field.Tag.Get("usage")
+		s.Properties[name] = prop
+		if !hasTagOption(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+func hasTagOption(opts, opt string) bool {
+	for opts != "" {
+		var o string
+		if i := strings.Index(opts, ","); i >= 0 {
+			o, opts = opts[:i], opts[i+1:]
+		} else {
+			o, opts = opts, ""
+		}
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
@@ -0,0 +1,152 @@
+package jsonx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/errors"
+)
+
+const testSchema = `{
+	// root must be an object
+	"type": "object",
+	"required": ["name", "port"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"mode": {"enum": ["debug", "release"]},
+		"ratio": {"type": "number", "exclusiveMaximum": 1},
+		"tags": {
+			"type": "array",
+			"maxItems": 2,
+			"items": {"type": "string"},
+		},
+	},
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ReadSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("ReadSchema error: %v", err)
+	}
+	for i, ts := range []struct {
+		src  string
+		errs []string
+	}{
+		{`{"name":"abc","port":80}`, nil},
+		{`{"name":"abc","port":80,"mode":"debug","ratio":0.5,"tags":["a","b"]}`, nil},
+		{`{"name":"abc","port":80.0}`, nil},
+		{`[]`, []string{"$: expect type object, but got array at <input>:1:1"}},
+		{`{"name":"abc"}`, []string{`$: missing required property "port" at <input>:1:1`}},
+		{`{"name":"Abc","port":0}`, []string{
+			`$.name: value "Abc" does not match pattern "^[a-z]+$" at <input>:1:9`,
+			`$.port: value 0 less than minimum 1 at <input>:1:22`,
+		}},
+		{`{"name":"abc","port":"80"}`, []string{`$.port: expect type integer, but got string at <input>:1:22`}},
+		{`{"name":"abc","port":1.5}`, []string{`$.port: expect type integer, but got number at <input>:1:22`}},
+		{`{"name":"abc","port":80,"mode":"test"}`, []string{`$.mode: value must be one of ["debug","release"] at <input>:1:32`}},
+		{`{"name":"abc","port":80,"ratio":1}`, []string{`$.ratio: value 1 must be less than 1 at <input>:1:33`}},
+		{`{"name":"abc","port":80,"tags":["a",1,"c"]}`, []string{
+			`$.tags: number of items 3 greater than maxItems 2 at <input>:1:32`,
+			`$.tags[1]: expect type string, but got integer at <input>:1:37`,
+		}},
+	} {
+		node, err := ReadBytes([]byte(ts.src))
+		if err != nil {
+			t.Errorf("%dth: read error: %v", i, err)
+			continue
+		}
+		err = schema.Validate(node)
+		if len(ts.errs) == 0 {
+			if err != nil {
+				t.Errorf("%dth: want nil, got error %v", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%dth: want errors, but got nil", i)
+			continue
+		}
+		list := err.(*errors.ErrorList).Errors()
+		if len(list) != len(ts.errs) {
+			t.Errorf("%dth: want %d errors, but got %d: %v", i, len(ts.errs), len(list), err)
+			continue
+		}
+		for j := range list {
+			if list[j].Error() != ts.errs[j] {
+				t.Errorf("%dth: want error %v, but got %v", i, ts.errs[j], list[j])
+			}
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(filename, []byte(`{"type": }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSchemaFile(filename); err == nil || !strings.Contains(err.Error(), filename+":1:") {
+		t.Errorf("want syntax error at %s, but got %v", filename, err)
+	}
+
+	if _, err := ReadSchema(strings.NewReader(`{"pattern": "a("}`)); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("want invalid pattern error, but got %v", err)
+	}
+
+	schema := &Schema{Type: []string{"object"}, Properties: map[string]*Schema{
+		"name": {Type: []string{"string"}, Pattern: "a("},
+	}}
+	if err := schema.Compile(); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("want invalid pattern error, but got %v", err)
+	}
+	node, err := ReadBytes([]byte(`{"name":"abc"}`))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if err := schema.Validate(node); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("want invalid pattern reported by Validate, but got %v", err)
+	}
+	schema.Properties["name"].Pattern = "^[a-z]+$"
+	if err := schema.Compile(); err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	if err := schema.Validate(node); err != nil {
+		t.Errorf("want nil, but got %v", err)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	type Server struct {
+		Host string `json:"host" usage:"listening host"`
+		Port uint16 `json:"port"`
+	}
+	type Conf struct {
+		Server Server   `json:"server"`
+		Debug  bool     `json:"debug,omitempty"`
+		Tags   []string `json:"tags,omitempty"`
+		Ignore int      `json:"-"`
+	}
+	schema, err := SchemaOf(&Conf{Server: Server{Host: "localhost", Port: 8080}})
+	if err != nil {
+		t.Fatalf("SchemaOf error: %v", err)
+	}
+	data, err := schema.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON error: %v", err)
+	}
+	want := `{"type":"object","required":["server"],"properties":{"debug":{"type":"boolean"},"server":{"type":"object","required":["host","port"],"properties":{"host":{"description":"listening host","default":"localhost","type":"string"},"port":{"default":8080,"type":"integer","minimum":0}}},"tags":{"type":"array","items":{"type":"string"}}}}`
+	if string(data) != want {
+		t.Errorf("want schema %s, but got %s", want, data)
+	}
+
+	node, err := ReadBytes([]byte(`{"server":{"host":"127.0.0.1","port":-1}}`))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	err = schema.Validate(node)
+	if err == nil || err.Error() != "$.server.port: value -1 less than minimum 0 at <input>:1:38" {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+}
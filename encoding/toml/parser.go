@@ -0,0 +1,606 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// parser parses TOML document
+type parser struct {
+	src      []byte
+	filename string
+	offset   int
+	line     int
+	column   int
+
+	root    *encoding.Value
+	current *encoding.Value          // current table
+	defined map[*encoding.Value]bool // tables defined by header
+	inline  map[*encoding.Value]bool // inline tables and static arrays which can't be extended
+	doc     []string                 // pending comment lines
+}
+
+func parse(src []byte, filename string) (*encoding.Value, error) {
+	p := &parser{
+		src:      src,
+		filename: filename,
+		line:     1,
+		column:   1,
+		root:     encoding.NewObject(),
+		defined:  make(map[*encoding.Value]bool),
+		inline:   make(map[*encoding.Value]bool),
+	}
+	p.root.Pos = p.pos()
+	p.current = p.root
+	if err := p.parseDocument(); err != nil {
+		return nil, err
+	}
+	return p.root, nil
+}
+
+func (p *parser) pos() scanner.Position {
+	return scanner.Position{Filename: p.filename, Offset: p.offset, Line: p.line, Column: p.column}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at %v", append(args, p.pos())...)
+}
+
+func (p *parser) eof() bool { return p.offset >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.offset]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.src[p.offset:], []byte(s))
+}
+
+func (p *parser) advance(n int) {
+	for i := 0; i < n && !p.eof(); i++ {
+		if p.src[p.offset] == '\n' {
+			p.line++
+			p.column = 1
+		} else {
+			p.column++
+		}
+		p.offset++
+	}
+}
+
+// skipSpace skips spaces and tabs
+func (p *parser) skipSpace() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.advance(1)
+	}
+}
+
+// skipNewline skips a newline, returns false if no newline
+func (p *parser) skipNewline() bool {
+	if p.hasPrefix("\r\n") {
+		p.advance(2)
+		return true
+	}
+	if p.peek() == '\n' {
+		p.advance(1)
+		return true
+	}
+	return false
+}
+
+// comment reads a comment if exists
+func (p *parser) comment() (string, bool) {
+	if p.peek() != '#' {
+		return "", false
+	}
+	start := p.offset
+	for !p.eof() && p.peek() != '\n' && !p.hasPrefix("\r\n") {
+		p.advance(1)
+	}
+	return strings.TrimSpace(string(p.src[start+1 : p.offset])), true
+}
+
+// endLine expects optional comment and end of line, returns the comment
+func (p *parser) endLine() (string, error) {
+	p.skipSpace()
+	text, _ := p.comment()
+	if !p.eof() && !p.skipNewline() {
+		return "", p.errorf("expect end of line, but got %q", p.peek())
+	}
+	return text, nil
+}
+
+func (p *parser) parseDocument() error {
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		if text, ok := p.comment(); ok {
+			p.doc = append(p.doc, text)
+			p.skipNewline()
+			continue
+		}
+		if p.skipNewline() {
+			if p.current == p.root && len(p.root.Fields) == 0 && len(p.doc) > 0 {
+				// comments separated from first item by blank line belong to document
+				p.root.Doc = append(p.root.Doc, p.doc...)
+				p.doc = nil
+			}
+			continue
+		}
+		var err error
+		if p.hasPrefix("[[") {
+			err = p.parseTableHeader(true)
+		} else if p.peek() == '[' {
+			err = p.parseTableHeader(false)
+		} else {
+			err = p.parseKeyValue(p.current, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(p.doc) > 0 {
+		// comments at end of document
+		p.root.Doc = append(p.root.Doc, p.doc...)
+		p.doc = nil
+	}
+	return nil
+}
+
+func (p *parser) parseTableHeader(array bool) error {
+	pos := p.pos()
+	open, close := "[", "]"
+	if array {
+		open, close = "[[", "]]"
+	}
+	p.advance(len(open))
+	p.skipSpace()
+	keys, err := p.parseKeys()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if !p.hasPrefix(close) {
+		return p.errorf("expect %s", close)
+	}
+	p.advance(len(close))
+
+	// find parent table
+	parent := p.root
+	for _, key := range keys[:len(keys)-1] {
+		next := parent.Get(key)
+		if next == nil {
+			next = encoding.NewObject()
+			next.Pos = pos
+			parent.Set(key, next)
+		} else if next.Kind == encoding.ArrayValue && !p.inline[next] && len(next.Elems) > 0 {
+			// last table of array of tables
+			next = next.Elems[len(next.Elems)-1]
+		} else if next.Kind != encoding.ObjectValue || p.inline[next] {
+			return fmt.Errorf("key %s is not a table at %v", key, pos)
+		}
+		parent = next
+	}
+	key := keys[len(keys)-1]
+	table := encoding.NewObject()
+	table.Pos = pos
+	if array {
+		arr := parent.Get(key)
+		if arr == nil {
+			arr = encoding.NewArray()
+			arr.Pos = pos
+			parent.Set(key, arr)
+		} else if arr.Kind != encoding.ArrayValue || p.inline[arr] {
+			return fmt.Errorf("key %s is not an array of tables at %v", key, pos)
+		}
+		arr.Elems = append(arr.Elems, table)
+	} else {
+		if existing := parent.Get(key); existing != nil {
+			if existing.Kind != encoding.ObjectValue || p.inline[existing] || p.defined[existing] {
+				return fmt.Errorf("table %s defined twice at %v", strings.Join(keys, "."), pos)
+			}
+			// table created implicitly by a sub-table
+			table = existing
+		} else {
+			parent.Set(key, table)
+		}
+		p.defined[table] = true
+	}
+	table.Doc = append(table.Doc, p.doc...)
+	p.doc = nil
+	comment, err := p.endLine()
+	if err != nil {
+		return err
+	}
+	table.Comment = comment
+	p.current = table
+	return nil
+}
+
+// parseKeys parses dotted keys
+func (p *parser) parseKeys() ([]string, error) {
+	var keys []string
+	for {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance(1)
+		p.skipSpace()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *parser) parseKey() (string, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		return p.parseBasicString()
+	case c == '\'':
+		return p.parseLiteralString()
+	case isBareKeyChar(c):
+		start := p.offset
+		for isBareKeyChar(p.peek()) {
+			p.advance(1)
+		}
+		return string(p.src[start:p.offset]), nil
+	}
+	return "", p.errorf("expect key")
+}
+
+// parseKeyValue parses `key = value` and sets it into table
+func (p *parser) parseKeyValue(table *encoding.Value, endLine bool) error {
+	pos := p.pos()
+	keys, err := p.parseKeys()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expect =")
+	}
+	p.advance(1)
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[:len(keys)-1] {
+		next := table.Get(key)
+		if next == nil {
+			next = encoding.NewObject()
+			next.Pos = pos
+			table.Set(key, next)
+		} else if next.Kind != encoding.ObjectValue || p.inline[next] || p.defined[next] {
+			return fmt.Errorf("key %s is not a table at %v", key, pos)
+		}
+		table = next
+	}
+	key := keys[len(keys)-1]
+	if table.Get(key) != nil {
+		return fmt.Errorf("key %s defined twice at %v", strings.Join(keys, "."), pos)
+	}
+	table.Set(key, value)
+	if endLine {
+		value.Doc = append(value.Doc, p.doc...)
+		p.doc = nil
+		if value.Comment, err = p.endLine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseValue() (*encoding.Value, error) {
+	pos := p.pos()
+	var (
+		v   *encoding.Value
+		err error
+	)
+	switch c := p.peek(); {
+	case c == '"', c == '\'':
+		var s string
+		if c == '"' {
+			s, err = p.parseBasicString()
+		} else {
+			s, err = p.parseLiteralString()
+		}
+		v = encoding.NewString(s)
+	case c == '[':
+		v, err = p.parseArray()
+	case c == '{':
+		v, err = p.parseInlineTable()
+	case p.hasPrefix("true"):
+		p.advance(4)
+		v = encoding.NewBool(true)
+	case p.hasPrefix("false"):
+		p.advance(5)
+		v = encoding.NewBool(false)
+	default:
+		v, err = p.parseNumberOrDate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Pos = pos
+	return v, nil
+}
+
+func (p *parser) parseNumberOrDate() (*encoding.Value, error) {
+	pos, start := p.pos(), p.offset
+	for !p.eof() {
+		c := p.peek()
+		if c == ' ' && isDate(string(p.src[start:p.offset])) && p.offset+1 < len(p.src) && isDigit(p.src[p.offset+1]) {
+			// date and time separated by space
+			p.advance(1)
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',' || c == ']' || c == '}' || c == '#' {
+			break
+		}
+		p.advance(1)
+	}
+	text := string(p.src[start:p.offset])
+	if text == "" {
+		return nil, p.errorf("expect value")
+	}
+	if isDate(text) || strings.Contains(text, ":") {
+		return encoding.NewString(text), nil
+	}
+	switch strings.TrimLeft(text, "+-") {
+	case "inf":
+		if text[0] == '-' {
+			return encoding.NewFloat(math.Inf(-1)), nil
+		}
+		return encoding.NewFloat(math.Inf(1)), nil
+	case "nan":
+		return encoding.NewFloat(math.NaN()), nil
+	}
+	if strings.Contains(text, "__") || strings.HasPrefix(text, "_") || strings.HasSuffix(text, "_") {
+		return nil, fmt.Errorf("invalid number %s at %v", text, pos)
+	}
+	clean := strings.Replace(text, "_", "", -1)
+	if strings.HasPrefix(clean, "0x") || strings.HasPrefix(clean, "0o") || strings.HasPrefix(clean, "0b") {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[clean[1]]
+		i, err := strconv.ParseInt(clean[2:], base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s at %v", text, pos)
+		}
+		return encoding.NewInt(i), nil
+	}
+	if !strings.ContainsAny(clean, ".eE") {
+		i, err := strconv.ParseInt(clean, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s at %v", text, pos)
+		}
+		return encoding.NewInt(i), nil
+	}
+	f, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid float %s at %v", text, pos)
+	}
+	return encoding.NewFloat(f), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// isDate reports whether s starts with a date YYYY-MM-DD
+func isDate(s string) bool {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return false
+	}
+	for _, i := range []int{0, 1, 2, 3, 5, 6, 8, 9} {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// skipArraySpace skips spaces, newlines and comments in array, comments are returned
+func (p *parser) skipArraySpace() []string {
+	var comments []string
+	for {
+		p.skipSpace()
+		if text, ok := p.comment(); ok {
+			comments = append(comments, text)
+			continue
+		}
+		if !p.skipNewline() {
+			return comments
+		}
+	}
+}
+
+func (p *parser) parseArray() (*encoding.Value, error) {
+	p.advance(1) // [
+	arr := encoding.NewArray()
+	p.inline[arr] = true
+	for {
+		doc := p.skipArraySpace()
+		if p.peek() == ']' {
+			p.advance(1)
+			return arr, nil
+		}
+		elem, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elem.Doc = doc
+		arr.Elems = append(arr.Elems, elem)
+		p.skipSpace()
+		if text, ok := p.comment(); ok {
+			elem.Comment = text
+		}
+		p.skipArraySpace()
+		if p.peek() == ',' {
+			p.advance(1)
+			p.skipSpace()
+			if text, ok := p.comment(); ok {
+				elem.Comment = text
+			}
+			continue
+		}
+		if p.peek() != ']' {
+			return nil, p.errorf("expect , or ]")
+		}
+	}
+}
+
+func (p *parser) parseInlineTable() (*encoding.Value, error) {
+	p.advance(1) // {
+	table := encoding.NewObject()
+	p.inline[table] = true
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.advance(1)
+		return table, nil
+	}
+	for {
+		p.skipSpace()
+		if err := p.parseKeyValue(table, false); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case '}':
+			p.advance(1)
+			return table, nil
+		default:
+			return nil, p.errorf("expect , or }")
+		}
+	}
+}
+
+func (p *parser) parseLiteralString() (string, error) {
+	if p.hasPrefix("'''") {
+		p.advance(3)
+		p.skipNewline()
+		start := p.offset
+		for !p.hasPrefix("'''") {
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			p.advance(1)
+		}
+		// up to two quotes are allowed before closing delimiter
+		for p.hasPrefix("''''") {
+			p.advance(1)
+		}
+		s := string(p.src[start:p.offset])
+		p.advance(3)
+		return s, nil
+	}
+	p.advance(1)
+	start := p.offset
+	for p.peek() != '\'' {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		p.advance(1)
+	}
+	s := string(p.src[start:p.offset])
+	p.advance(1)
+	return s, nil
+}
+
+func (p *parser) parseBasicString() (string, error) {
+	multiline := p.hasPrefix(`"""`)
+	if multiline {
+		p.advance(3)
+		p.skipNewline()
+	} else {
+		p.advance(1)
+	}
+	var buf strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if multiline && p.hasPrefix(`"""`) {
+			for p.hasPrefix(`""""`) {
+				buf.WriteByte('"')
+				p.advance(1)
+			}
+			p.advance(3)
+			return buf.String(), nil
+		}
+		c := p.peek()
+		if !multiline && c == '"' {
+			p.advance(1)
+			return buf.String(), nil
+		}
+		if !multiline && c == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if c != '\\' {
+			r, size := utf8.DecodeRune(p.src[p.offset:])
+			buf.WriteRune(r)
+			p.advance(size)
+			continue
+		}
+		p.advance(1)
+		c = p.peek()
+		switch c {
+		case 'b':
+			buf.WriteByte('\b')
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'e':
+			buf.WriteByte('\x1b')
+		case '"', '\\':
+			buf.WriteByte(c)
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if p.offset+1+size > len(p.src) {
+				return "", p.errorf("invalid escape")
+			}
+			r, err := strconv.ParseUint(string(p.src[p.offset+1:p.offset+1+size]), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid escape")
+			}
+			buf.WriteRune(rune(r))
+			p.advance(size)
+		default:
+			if multiline && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+				// line ending backslash trims whitespaces
+				for c := p.peek(); c == ' ' || c == '\t' || c == '\n' || c == '\r'; c = p.peek() {
+					p.advance(1)
+				}
+				continue
+			}
+			return "", p.errorf("invalid escape \\%c", c)
+		}
+		p.advance(1)
+	}
+}
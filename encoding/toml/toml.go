@@ -0,0 +1,57 @@
+// Package toml reads and writes TOML documents as format-neutral encoding.Value,
+// comments are kept.
+//
+// Dates and times are read as strings.
+package toml
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+// Read reads a TOML document from r
+func Read(r io.Reader) (*encoding.Value, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, "")
+}
+
+// ReadBytes reads a TOML document from bytes
+func ReadBytes(data []byte) (*encoding.Value, error) {
+	return parse(data, "")
+}
+
+// ReadFile reads a TOML document from file
+func ReadFile(filename string) (*encoding.Value, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, filename)
+}
+
+// Write writes v to w as a TOML document, v must be an object.
+// Null values are omitted since TOML has no null.
+func Write(w io.Writer, v *encoding.Value) error {
+	var buf bytes.Buffer
+	if err := newWriter(&buf).writeDocument(v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile writes v to file as a TOML document
+func WriteFile(filename string, v *encoding.Value, perm os.FileMode) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, v); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), perm)
+}
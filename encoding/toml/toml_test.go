@@ -0,0 +1,103 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+func TestRead(t *testing.T) {
+	src := `# config
+
+# name of app
+name = "app" # line
+ports = [80, 0x1bb]
+ratio = 1_000.5
+date = 1979-05-27T07:32:00Z
+
+[db]
+host = 'localhost'
+opts.timeout = 3
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`
+	v, err := ReadBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	for i, ts := range []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"name"}, "app"},
+		{[]string{"ports", "1"}, int64(443)},
+		{[]string{"ratio"}, 1000.5},
+		{[]string{"date"}, "1979-05-27T07:32:00Z"},
+		{[]string{"db", "opts", "timeout"}, int64(3)},
+		{[]string{"users", "1", "name"}, "b"},
+	} {
+		got := v.Lookup(ts.path...)
+		if got == nil || got.Interface() != ts.want {
+			t.Errorf("%dth: want %v, but got %v", i, ts.want, got)
+		}
+	}
+	if got := v.Doc; len(got) != 1 || got[0] != "config" {
+		t.Errorf("want document comment config, but got %q", got)
+	}
+	if name := v.Get("name"); len(name.Doc) != 1 || name.Doc[0] != "name of app" || name.Comment != "line" {
+		t.Errorf("want comments of name, but got %q and %q", name.Doc, name.Comment)
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, v); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	want := `# config
+
+# name of app
+name = "app" # line
+ports = [80, 443]
+ratio = 1000.5
+date = "1979-05-27T07:32:00Z"
+
+[db]
+host = "localhost"
+
+[db.opts]
+timeout = 3
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	for i, ts := range []struct {
+		src, err string
+	}{
+		{"a = 1\na = 2", "key a defined twice at <input>:2:1"},
+		{"[a]\n[a]", "table a defined twice at <input>:2:1"},
+		{"a = \"x", "unterminated string at <input>:1:7"},
+		{"a = 1 b", `expect end of line, but got 'b' at <input>:1:7`},
+		{"a = 1__0", "invalid number 1__0 at <input>:1:5"},
+	} {
+		_, err := ReadBytes([]byte(ts.src))
+		if err == nil || !strings.HasSuffix(err.Error(), ts.err) {
+			t.Errorf("%dth: want error %q, but got %v", i, ts.err, err)
+		}
+	}
+	if err := Write(new(strings.Builder), encoding.NewArray()); err == nil {
+		t.Errorf("want error for writing array, but got nil")
+	}
+}
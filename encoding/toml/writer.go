@@ -0,0 +1,228 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+type writer struct {
+	buf *bytes.Buffer
+}
+
+func newWriter(buf *bytes.Buffer) *writer {
+	return &writer{buf: buf}
+}
+
+func (w *writer) writeDocument(v *encoding.Value) error {
+	if v.Kind != encoding.ObjectValue {
+		return fmt.Errorf("toml: top-level value must be an object, but got %v", v.Kind)
+	}
+	if len(v.Doc) > 0 {
+		w.writeDoc("", v.Doc)
+		w.buf.WriteByte('\n')
+	}
+	return w.writeTable(nil, v)
+}
+
+// isTable reports whether v is written as a table
+func isTable(v *encoding.Value) bool {
+	return v.Kind == encoding.ObjectValue
+}
+
+// isTableArray reports whether v is written as an array of tables
+func isTableArray(v *encoding.Value) bool {
+	if v.Kind != encoding.ArrayValue || len(v.Elems) == 0 {
+		return false
+	}
+	for _, elem := range v.Elems {
+		if elem.Kind != encoding.ObjectValue {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTable writes key-value pairs of table, then sub-tables
+func (w *writer) writeTable(path []string, table *encoding.Value) error {
+	for _, f := range table.Fields {
+		if f.Value.Kind == encoding.NullValue || isTable(f.Value) || isTableArray(f.Value) {
+			continue
+		}
+		w.writeDoc("", f.Value.Doc)
+		w.buf.WriteString(formatKey(f.Key))
+		w.buf.WriteString(" = ")
+		if err := w.writeValue(f.Value); err != nil {
+			return err
+		}
+		w.writeComment(f.Value.Comment)
+		w.buf.WriteByte('\n')
+	}
+	for _, f := range table.Fields {
+		subpath := append(path[:len(path):len(path)], f.Key)
+		switch {
+		case isTable(f.Value):
+			if w.hasValues(f.Value) || len(f.Value.Doc) > 0 || f.Value.Comment != "" || len(f.Value.Fields) == 0 {
+				w.writeHeader("[", "]", subpath, f.Value)
+			}
+			if err := w.writeTable(subpath, f.Value); err != nil {
+				return err
+			}
+		case isTableArray(f.Value):
+			w.writeDoc("", f.Value.Doc)
+			for _, elem := range f.Value.Elems {
+				w.writeHeader("[[", "]]", subpath, elem)
+				if err := w.writeTable(subpath, elem); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasValues reports whether table has key-value pairs which are not tables
+func (w *writer) hasValues(table *encoding.Value) bool {
+	for _, f := range table.Fields {
+		if f.Value.Kind != encoding.NullValue && !isTable(f.Value) && !isTableArray(f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *writer) writeHeader(open, close string, path []string, table *encoding.Value) {
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+	w.writeDoc("", table.Doc)
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = formatKey(key)
+	}
+	w.buf.WriteString(open + strings.Join(keys, ".") + close)
+	w.writeComment(table.Comment)
+	w.buf.WriteByte('\n')
+}
+
+func (w *writer) writeDoc(indent string, doc []string) {
+	for _, line := range doc {
+		w.buf.WriteString(indent + "#")
+		if line != "" {
+			w.buf.WriteString(" " + line)
+		}
+		w.buf.WriteByte('\n')
+	}
+}
+
+func (w *writer) writeComment(comment string) {
+	if comment != "" {
+		w.buf.WriteString(" # " + comment)
+	}
+}
+
+// writeValue writes value inline
+func (w *writer) writeValue(v *encoding.Value) error {
+	switch v.Kind {
+	case encoding.NullValue:
+		return fmt.Errorf("toml: null value is not supported at %v", v.Pos)
+	case encoding.BoolValue, encoding.IntValue:
+		w.buf.WriteString(v.Text())
+	case encoding.FloatValue:
+		w.buf.WriteString(formatFloat(v.Float))
+	case encoding.StringValue:
+		w.buf.WriteString(quote(v.String))
+	case encoding.ArrayValue:
+		w.buf.WriteByte('[')
+		for i, elem := range v.Elems {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			if err := w.writeValue(elem); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte(']')
+	case encoding.ObjectValue:
+		w.buf.WriteByte('{')
+		n := 0
+		for _, f := range v.Fields {
+			if f.Value.Kind == encoding.NullValue {
+				continue
+			}
+			if n > 0 {
+				w.buf.WriteByte(',')
+			}
+			n++
+			w.buf.WriteString(" " + formatKey(f.Key) + " = ")
+			if err := w.writeValue(f.Value); err != nil {
+				return err
+			}
+		}
+		if n > 0 {
+			w.buf.WriteByte(' ')
+		}
+		w.buf.WriteByte('}')
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return encoding.FormatFloat(f)
+}
+
+func formatKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return quote(key)
+		}
+	}
+	return key
+}
+
+// quote quotes s as a TOML basic string
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				buf.WriteString(`\u` + fmt.Sprintf("%04x", r))
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,310 @@
+// Package xmlx reads and writes XML documents as format-neutral encoding.Value,
+// comments are kept.
+//
+// Mapping between XML and Value:
+//
+//	<root a="1">           {"root": {
+//	  <name>x</name>          "@a": "1",
+//	  <item>1</item>          "name": "x",
+//	  <item>2</item>          "item": ["1", "2"],
+//	  text                    "#text": "text"
+//	</root>                }}
+//
+// Elements which contain only text are read as strings, attributes as fields
+// prefixed with @, repeated elements as arrays.
+//
+// A well-formed XML document has exactly one root element, so values which
+// are not an object of single element, e.g. objects of several fields and
+// arrays, are written in root element <document>, and elements of arrays are
+// written as <item>. Root element <document> is unwrapped by Read.
+package xmlx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/scanner"
+	"unicode"
+
+	"github.com/mkideal/pkg/encoding"
+)
+
+const (
+	attrPrefix  = "@"
+	textKey     = "#text"
+	documentKey = "document"
+	itemKey     = "item"
+)
+
+// Read reads an XML document from r
+func Read(r io.Reader) (*encoding.Value, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return read(data, "")
+}
+
+// ReadBytes reads an XML document from bytes
+func ReadBytes(data []byte) (*encoding.Value, error) {
+	return read(data, "")
+}
+
+// ReadFile reads an XML document from file
+func ReadFile(filename string) (*encoding.Value, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return read(data, filename)
+}
+
+// element is an element being read
+type element struct {
+	value    *encoding.Value
+	name     string
+	text     strings.Builder
+	children bool
+}
+
+func read(data []byte, filename string) (*encoding.Value, error) {
+	var (
+		dec   = xml.NewDecoder(bytes.NewReader(data))
+		root  = encoding.NewObject()
+		stack = []*element{{value: root}}
+		doc   []string
+	)
+	// line and column are tracked incrementally since offset only grows
+	scanned, line, lineStart := 0, 1, 0
+	pos := func() scanner.Position {
+		offset := int(dec.InputOffset())
+		for ; scanned < offset; scanned++ {
+			if data[scanned] == '\n' {
+				line++
+				lineStart = scanned + 1
+			}
+		}
+		return scanner.Position{Filename: filename, Offset: offset, Line: line, Column: offset - lineStart + 1}
+	}
+	for {
+		start := pos()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v at %v", err, pos())
+		}
+		top := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			v := encoding.NewObject()
+			v.Pos = start
+			v.Doc, doc = doc, nil
+			for _, attr := range tok.Attr {
+				v.Set(attrPrefix+attr.Name.Local, encoding.NewString(attr.Value))
+			}
+			top.children = true
+			stack = append(stack, &element{value: v, name: tok.Name.Local})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			v := top.value
+			text := strings.TrimSpace(top.text.String())
+			if !top.children && len(v.Fields) == 0 {
+				// text-only element
+				v.Kind, v.String = encoding.StringValue, text
+			} else if text != "" {
+				v.Set(textKey, encoding.NewString(text))
+			}
+			addChild(stack[len(stack)-1].value, top.name, v)
+		case xml.CharData:
+			top.text.Write(tok)
+		case xml.Comment:
+			doc = append(doc, strings.TrimSpace(string(tok)))
+		}
+	}
+	if len(doc) > 0 {
+		// comments after root element
+		root.Doc = append(root.Doc, doc...)
+	}
+	return unwrapDocument(root), nil
+}
+
+// unwrapDocument unwraps root element <document> written by Write
+func unwrapDocument(root *encoding.Value) *encoding.Value {
+	if len(root.Fields) != 1 || root.Fields[0].Key != documentKey {
+		return root
+	}
+	v := root.Fields[0].Value
+	if v.Kind == encoding.ObjectValue && len(v.Fields) == 1 && v.Fields[0].Key == itemKey {
+		items := v.Fields[0].Value
+		if items.Kind != encoding.ArrayValue {
+			items = encoding.NewArray(items)
+		}
+		items.Pos, items.Comment = v.Pos, v.Comment
+		v = items
+	}
+	v.Doc = append(root.Doc, v.Doc...)
+	return v
+}
+
+// addChild adds child element to parent, repeated elements are converted to array
+func addChild(parent *encoding.Value, name string, child *encoding.Value) {
+	existing := parent.Get(name)
+	switch {
+	case existing == nil:
+		parent.Set(name, child)
+	case existing.Kind == encoding.ArrayValue:
+		existing.Elems = append(existing.Elems, child)
+	default:
+		parent.Set(name, encoding.NewArray(existing, child))
+	}
+}
+
+// Write writes v to w as an XML document. v should be an object with single
+// field which is the root element, otherwise v is written in root element
+// <document>.
+func Write(w io.Writer, v *encoding.Value) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	for _, line := range v.Doc {
+		writeComment(&buf, "", line)
+	}
+	if v.Kind == encoding.ObjectValue && len(v.Fields) == 1 && isElement(v.Fields[0]) &&
+		v.Fields[0].Value.Kind != encoding.ArrayValue {
+		if err := writeElement(&buf, "", v.Fields[0].Key, v.Fields[0].Value); err != nil {
+			return err
+		}
+	} else {
+		value := *v
+		value.Doc = nil
+		if v.Kind == encoding.ArrayValue {
+			value = encoding.Value{Kind: encoding.ObjectValue, Comment: v.Comment}
+			items := *v
+			items.Doc, items.Comment = nil, ""
+			value.Set(itemKey, &items)
+		}
+		if err := writeElement(&buf, "", documentKey, &value); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile writes v to file as an XML document
+func WriteFile(filename string, v *encoding.Value, perm os.FileMode) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, v); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), perm)
+}
+
+const indent = "  "
+
+func writeComment(buf *bytes.Buffer, prefix, text string) {
+	buf.WriteString(prefix + "<!-- " + strings.Replace(text, "--", "- -", -1) + " -->\n")
+}
+
+// isElement reports whether field f is written as an element
+func isElement(f *encoding.Field) bool {
+	return !strings.HasPrefix(f.Key, attrPrefix) && f.Key != textKey
+}
+
+// elementName replaces characters which are invalid in XML names by '_'
+func elementName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		valid := r == '_' || r == ':' || unicode.IsLetter(r)
+		if i > 0 {
+			valid = valid || r == '-' || r == '.' || unicode.IsDigit(r)
+		}
+		if !valid {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+func writeElement(buf *bytes.Buffer, prefix, name string, v *encoding.Value) error {
+	name = elementName(name)
+	if v.Kind == encoding.ArrayValue {
+		for _, line := range v.Doc {
+			writeComment(buf, prefix, line)
+		}
+		for _, elem := range v.Elems {
+			if elem.Kind == encoding.ArrayValue {
+				return fmt.Errorf("xmlx: nested array of %s is not supported", name)
+			}
+			if err := writeElement(buf, prefix, name, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, line := range v.Doc {
+		writeComment(buf, prefix, line)
+	}
+	buf.WriteString(prefix + "<" + name)
+	var text *encoding.Value
+	var children []*encoding.Field
+	if v.Kind == encoding.ObjectValue {
+		for _, f := range v.Fields {
+			switch {
+			case strings.HasPrefix(f.Key, attrPrefix):
+				buf.WriteString(" " + elementName(strings.TrimPrefix(f.Key, attrPrefix)) + `="`)
+				xml.EscapeText(buf, []byte(f.Value.Text()))
+				buf.WriteString(`"`)
+			case f.Key == textKey:
+				text = f.Value
+			default:
+				children = append(children, f)
+			}
+		}
+	} else if v.Kind != encoding.NullValue {
+		text = v
+	}
+	switch {
+	case len(children) > 0:
+		buf.WriteString(">")
+		if v.Comment != "" {
+			buf.WriteByte(' ')
+			writeComment(buf, "", v.Comment)
+		} else {
+			buf.WriteByte('\n')
+		}
+		if text != nil {
+			buf.WriteString(prefix + indent)
+			xml.EscapeText(buf, []byte(text.Text()))
+			buf.WriteByte('\n')
+		}
+		for _, f := range children {
+			if err := writeElement(buf, prefix+indent, f.Key, f.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(prefix + "</" + name + ">\n")
+		return nil
+	case text != nil:
+		buf.WriteString(">")
+		xml.EscapeText(buf, []byte(text.Text()))
+		buf.WriteString("</" + name + ">")
+	default:
+		buf.WriteString("/>")
+	}
+	if v.Comment != "" {
+		buf.WriteByte(' ')
+		writeComment(buf, "", v.Comment)
+	} else {
+		buf.WriteByte('\n')
+	}
+	return nil
+}
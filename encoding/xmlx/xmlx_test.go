@@ -0,0 +1,129 @@
+package xmlx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mkideal/pkg/encoding/jsonx"
+)
+
+func TestReadWrite(t *testing.T) {
+	src := `<?xml version="1.0" encoding="UTF-8"?>
+<config version="2">
+  <!-- name of app -->
+  <name>app</name>
+  <host>a</host>
+  <host>b</host>
+  <db><port>3306</port></db>
+  <empty/>
+</config>
+`
+	v, err := ReadBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	for i, ts := range []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"config", "@version"}, "2"},
+		{[]string{"config", "name"}, "app"},
+		{[]string{"config", "host", "1"}, "b"},
+		{[]string{"config", "db", "port"}, "3306"},
+		{[]string{"config", "empty"}, ""},
+	} {
+		got := v.Lookup(ts.path...)
+		if got == nil || got.Interface() != ts.want {
+			t.Errorf("%dth: want %v, but got %v", i, ts.want, got)
+		}
+	}
+	if name := v.Lookup("config", "name"); name.Pos.Line != 4 || len(name.Doc) != 1 || name.Doc[0] != "name of app" {
+		t.Errorf("want comment of name at line 4, but got %q at %v", name.Doc, name.Pos)
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, v); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<config version="2">
+  <!-- name of app -->
+  <name>app</name>
+  <host>a</host>
+  <host>b</host>
+  <db>
+    <port>3306</port>
+  </db>
+  <empty></empty>
+</config>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestWriteRoot(t *testing.T) {
+	for i, ts := range []struct {
+		src  string
+		want string
+	}{
+		{`{"a": "1", "b": {"c": "2"}}`, "<document>"},
+		{`{"a": ["1", "2"]}`, "<document>"},
+		{`["1", "2"]`, "<document>\n  <item>1</item>"},
+		{`["1"]`, "<document>\n  <item>1</item>"},
+		{`[{"a": "1"}, {"a": "2"}]`, "<document>\n  <item>"},
+		{`{"config": {"a": "1"}}`, "<config>"},
+	} {
+		node, err := jsonx.ReadBytes([]byte(ts.src))
+		if err != nil {
+			t.Fatalf("%dth: %v", i, err)
+		}
+		v := jsonx.ToValue(node)
+		var buf bytes.Buffer
+		if err := Write(&buf, v); err != nil {
+			t.Errorf("%dth: Write error: %v", i, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), "?>\n"+ts.want) {
+			t.Errorf("%dth: want root %s, but got\n%s", i, ts.want, buf.String())
+		}
+		if n := countRoots(t, buf.Bytes()); n != 1 {
+			t.Errorf("%dth: want 1 root element, but got %d\n%s", i, n, buf.String())
+		}
+		got, err := ReadBytes(buf.Bytes())
+		if err != nil {
+			t.Errorf("%dth: ReadBytes error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Interface(), v.Interface()) {
+			t.Errorf("%dth: want %v, but got %v", i, v.Interface(), got.Interface())
+		}
+	}
+}
+
+func countRoots(t *testing.T, data []byte) int {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth, roots := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return roots
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
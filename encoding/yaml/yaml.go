@@ -0,0 +1,293 @@
+// Package yaml reads and writes YAML documents as format-neutral encoding.Value,
+// comments are kept.
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/scanner"
+
+	"github.com/mkideal/pkg/encoding"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Read reads a YAML document from r
+func Read(r io.Reader) (*encoding.Value, error) {
+	return read(r, "")
+}
+
+// ReadBytes reads a YAML document from bytes
+func ReadBytes(data []byte) (*encoding.Value, error) {
+	return read(bytes.NewReader(data), "")
+}
+
+// ReadFile reads a YAML document from file
+func ReadFile(filename string) (*encoding.Value, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return read(file, filename)
+}
+
+func read(r io.Reader, filename string) (*encoding.Value, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind == 0 {
+		// empty document
+		return encoding.NewNull(), nil
+	}
+	c := &converter{filename: filename, expanding: make(map[*yamlv3.Node]bool)}
+	return c.toValue(&root)
+}
+
+// maxAliasExpansions limits number of aliases expanded in a document, so
+// documents like "billion laughs" are rejected
+const maxAliasExpansions = 10000
+
+type converter struct {
+	filename  string
+	expanding map[*yamlv3.Node]bool // anchored nodes being converted
+	aliases   int                   // number of aliases expanded
+}
+
+func (c *converter) pos(n *yamlv3.Node) scanner.Position {
+	return scanner.Position{Filename: c.filename, Line: n.Line, Column: n.Column}
+}
+
+func (c *converter) toValue(n *yamlv3.Node) (*encoding.Value, error) {
+	var (
+		v   *encoding.Value
+		err error
+	)
+	if n.Anchor != "" {
+		c.expanding[n] = true
+		defer delete(c.expanding, n)
+	}
+	switch n.Kind {
+	case yamlv3.DocumentNode:
+		if len(n.Content) == 0 {
+			return encoding.NewNull(), nil
+		}
+		if v, err = c.toValue(n.Content[0]); err != nil {
+			return nil, err
+		}
+		v.Doc = append(commentLines(n.HeadComment), v.Doc...)
+		return v, nil
+	case yamlv3.AliasNode:
+		if c.expanding[n.Alias] {
+			return nil, fmt.Errorf("cyclic alias *%s at %v", n.Value, c.pos(n))
+		}
+		if c.aliases++; c.aliases > maxAliasExpansions {
+			return nil, fmt.Errorf("too many alias expansions at %v", c.pos(n))
+		}
+		if v, err = c.toValue(n.Alias); err != nil {
+			return nil, err
+		}
+		copied := *v
+		copied.Doc, copied.Comment = nil, ""
+		v = &copied
+	case yamlv3.MappingNode:
+		v = encoding.NewObject()
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			child, err := c.toValue(value)
+			if err != nil {
+				return nil, err
+			}
+			if key.Value == "<<" && key.Tag == "!!merge" {
+				if err := merge(v, child); err != nil {
+					return nil, fmt.Errorf("%v at %v", err, c.pos(key))
+				}
+				continue
+			}
+			// comments of pair are attached to key node
+			child.Doc = append(commentLines(key.HeadComment), child.Doc...)
+			if child.Comment == "" {
+				child.Comment = strings.Join(commentLines(key.LineComment), " ")
+			}
+			v.Set(key.Value, child)
+		}
+	case yamlv3.SequenceNode:
+		v = encoding.NewArray()
+		for _, elem := range n.Content {
+			child, err := c.toValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v.Elems = append(v.Elems, child)
+		}
+	case yamlv3.ScalarNode:
+		if v, err = scalarValue(n); err != nil {
+			return nil, fmt.Errorf("%v at %v", err, c.pos(n))
+		}
+	default:
+		return nil, fmt.Errorf("unknown node kind %v at %v", n.Kind, c.pos(n))
+	}
+	v.Pos = c.pos(n)
+	v.Doc = append(v.Doc, commentLines(n.HeadComment)...)
+	if lines := commentLines(n.LineComment); len(lines) > 0 {
+		v.Comment = strings.Join(lines, " ")
+	}
+	return v, nil
+}
+
+// merge merges fields of src into dst for merge key `<<`, existing fields are kept
+func merge(dst, src *encoding.Value) error {
+	switch src.Kind {
+	case encoding.ObjectValue:
+		for _, f := range src.Fields {
+			if dst.Get(f.Key) == nil {
+				dst.Set(f.Key, f.Value)
+			}
+		}
+	case encoding.ArrayValue:
+		for _, elem := range src.Elems {
+			if err := merge(dst, elem); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("map merge requires map or sequence of maps")
+	}
+	return nil
+}
+
+func scalarValue(n *yamlv3.Node) (*encoding.Value, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return encoding.NewNull(), nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return encoding.NewBool(b), err
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			var f float64
+			err = n.Decode(&f)
+			return encoding.NewFloat(f), err
+		}
+		return encoding.NewInt(i), nil
+	case "!!float":
+		var f float64
+		err := n.Decode(&f)
+		return encoding.NewFloat(f), err
+	default:
+		return encoding.NewString(n.Value), nil
+	}
+}
+
+// commentLines splits YAML comment to lines without `#`
+func commentLines(comment string) []string {
+	if comment == "" {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+	}
+	return lines
+}
+
+// Write writes v to w as a YAML document
+func Write(w io.Writer, v *encoding.Value) error {
+	enc := yamlv3.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(toNode(v)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// WriteFile writes v to file as a YAML document
+func WriteFile(filename string, v *encoding.Value, perm os.FileMode) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, v); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), perm)
+}
+
+func toNode(v *encoding.Value) *yamlv3.Node {
+	n := &yamlv3.Node{Kind: yamlv3.ScalarNode}
+	switch v.Kind {
+	case encoding.ObjectValue:
+		n.Kind, n.Tag = yamlv3.MappingNode, "!!map"
+		for _, f := range v.Fields {
+			key := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: f.Key}
+			key.HeadComment = commentText(f.Value.Doc)
+			value := toNode(f.Value)
+			value.HeadComment = ""
+			n.Content = append(n.Content, key, value)
+		}
+	case encoding.ArrayValue:
+		n.Kind, n.Tag = yamlv3.SequenceNode, "!!seq"
+		for _, elem := range v.Elems {
+			n.Content = append(n.Content, toNode(elem))
+		}
+	case encoding.NullValue:
+		n.Tag, n.Value = "!!null", "null"
+	case encoding.BoolValue:
+		n.Tag, n.Value = "!!bool", v.Text()
+	case encoding.IntValue:
+		n.Tag, n.Value = "!!int", v.Text()
+	case encoding.FloatValue:
+		n.Tag, n.Value = "!!float", formatFloat(v.Float)
+	case encoding.StringValue:
+		n.Tag, n.Value = "!!str", v.String
+		if strings.Contains(v.String, "\n") {
+			n.Style = yamlv3.LiteralStyle
+		}
+	}
+	n.HeadComment = commentText(v.Doc)
+	if v.Comment != "" {
+		n.LineComment = "# " + v.Comment
+	}
+	return n
+}
+
+func formatFloat(f float64) string {
+	switch s := encoding.FormatFloat(f); s {
+	case "+Inf":
+		return ".inf"
+	case "-Inf":
+		return "-.inf"
+	case "NaN":
+		return ".nan"
+	default:
+		return s
+	}
+}
+
+func commentText(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("#")
+		if line != "" {
+			buf.WriteString(" " + line)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,88 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	src := `# name of app
+name: app # line
+base: &base
+  host: localhost
+  port: 80
+db:
+  <<: *base
+  port: 3306
+tags: [a, "1"]
+ratio: 0.5
+empty: null
+`
+	v, err := ReadBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("ReadBytes error: %v", err)
+	}
+	for i, ts := range []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"name"}, "app"},
+		{[]string{"db", "host"}, "localhost"},
+		{[]string{"db", "port"}, int64(3306)},
+		{[]string{"tags", "1"}, "1"},
+		{[]string{"ratio"}, 0.5},
+		{[]string{"empty"}, nil},
+	} {
+		got := v.Lookup(ts.path...)
+		if got == nil || got.Interface() != ts.want {
+			t.Errorf("%dth: want %v, but got %v", i, ts.want, got)
+		}
+	}
+	if name := v.Get("name"); name.Pos.Line != 2 || len(name.Doc) != 1 || name.Doc[0] != "name of app" || name.Comment != "line" {
+		t.Errorf("want comments of name at line 2, but got %q and %q at %v", name.Doc, name.Comment, name.Pos)
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, v); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	want := `# name of app
+name: app # line
+base:
+  host: localhost
+  port: 80
+db:
+  host: localhost
+  port: 3306
+tags:
+  - a
+  - "1"
+ratio: 0.5
+empty: null
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestReadAliases(t *testing.T) {
+	laughs := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for _, name := range "bcdefghi" {
+		prev := string(name - 1)
+		laughs += string(name) + ": &" + string(name) + " [" + strings.Repeat("*"+prev+", ", 9) + "*" + prev + "]\n"
+	}
+	for i, ts := range []struct {
+		src string
+		ok  bool
+	}{
+		{"a: &x\n  b: 1\nc: *x\n", true},
+		{"a: &x\n  b: *x\n", false},
+		{"a: &x [*x]\n", false},
+		{laughs, false},
+	} {
+		_, err := ReadBytes([]byte(ts.src))
+		if ok := err == nil; ok != ts.ok {
+			t.Errorf("%dth: want ok %v, but got error %v", i, ts.ok, err)
+		}
+	}
+}
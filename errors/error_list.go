@@ -17,6 +17,8 @@ func (list *ErrorList) Add(err error) {
 
 func (list *ErrorList) Len() int { return len(list.errs) }
 
+func (list *ErrorList) Errors() []error { return list.errs }
+
 func (list *ErrorList) Err() error {
 	if len(list.errs) > 0 {
 		return list
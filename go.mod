@@ -7,4 +7,5 @@ require (
 	github.com/mattn/go-colorable v0.1.7 // indirect
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20200707034311-ab3426394381
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,208 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Framer splits a stream into frames, i.e. packets
+type Framer interface {
+	// ReadFrame reads a frame of at most maxSize bytes from r, n is number
+	// of bytes read including framing. buf may be used as storage of frame.
+	ReadFrame(r *bufio.Reader, buf []byte, maxSize int) (frame []byte, n int, err error)
+	// AppendFrame appends framed data to dst
+	AppendFrame(dst, data []byte) ([]byte, error)
+}
+
+// Framers of length prefix
+var (
+	BigEndian16Framer    Framer = LengthFramer{Size: 2, Order: binary.BigEndian}
+	BigEndian32Framer    Framer = LengthFramer{Size: 4, Order: binary.BigEndian}
+	LittleEndian16Framer Framer = LengthFramer{Size: 2, Order: binary.LittleEndian}
+	LittleEndian32Framer Framer = LengthFramer{Size: 4, Order: binary.LittleEndian}
+
+	// DefaultFramer is used by PacketReader if no framer specified
+	DefaultFramer = BigEndian32Framer
+)
+
+// headerFramer is implemented by framers whose framing is a header before data,
+// so that PacketWriter writes data without copying
+type headerFramer interface {
+	appendHeader(dst []byte, n int) ([]byte, error)
+}
+
+// frameChecker is implemented by framers which check data of frames without
+// framing them
+type frameChecker interface {
+	checkFrame(data []byte) error
+}
+
+var errNewlineInFrame = errors.New("frame contains newline")
+
+// grow returns buf of length n, buf is reallocated if its capacity not enough
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// LengthFramer prefixes frames by length of data in 2 or 4 bytes
+type LengthFramer struct {
+	Size  int // size of prefix, 2 or 4
+	Order binary.ByteOrder
+}
+
+func (f LengthFramer) ReadFrame(r *bufio.Reader, buf []byte, maxSize int) ([]byte, int, error) {
+	var prefix [4]byte
+	n, err := io.ReadFull(r, prefix[:f.Size])
+	if err != nil {
+		return nil, n, err
+	}
+	var length int
+	switch f.Size {
+	case 2:
+		length = int(f.Order.Uint16(prefix[:]))
+	case 4:
+		length = int(f.Order.Uint32(prefix[:]))
+	default:
+		return nil, n, fmt.Errorf("unsupported length size %d", f.Size)
+	}
+	if length > maxSize || length < 0 {
+		return nil, n, errLengthTooBig
+	}
+	buf = grow(buf, length)
+	m, err := io.ReadFull(r, buf)
+	return buf, n + m, err
+}
+
+func (f LengthFramer) AppendFrame(dst, data []byte) ([]byte, error) {
+	dst, err := f.appendHeader(dst, len(data))
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
+
+func (f LengthFramer) appendHeader(dst []byte, n int) ([]byte, error) {
+	var prefix [4]byte
+	switch f.Size {
+	case 2:
+		if n > 0xFFFF {
+			return dst, errLengthTooBig
+		}
+		f.Order.PutUint16(prefix[:], uint16(n))
+	case 4:
+		if uint64(n) > 0xFFFFFFFF {
+			return dst, errLengthTooBig
+		}
+		f.Order.PutUint32(prefix[:], uint32(n))
+	default:
+		return dst, fmt.Errorf("unsupported length size %d", f.Size)
+	}
+	return append(dst, prefix[:f.Size]...), nil
+}
+
+// VarintFramer prefixes frames by length of data in unsigned varint
+var VarintFramer Framer = varintFramer{}
+
+type varintFramer struct{}
+
+func (varintFramer) ReadFrame(r *bufio.Reader, buf []byte, maxSize int) ([]byte, int, error) {
+	var (
+		length uint64
+		shift  uint
+		n      int
+	)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, n, err
+		}
+		n++
+		if n > binary.MaxVarintLen64 {
+			return nil, n, errLengthTooBig
+		}
+		length |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			break
+		}
+		shift += 7
+	}
+	if length > uint64(maxSize) {
+		return nil, n, errLengthTooBig
+	}
+	buf = grow(buf, int(length))
+	m, err := io.ReadFull(r, buf)
+	return buf, n + m, err
+}
+
+func (f varintFramer) AppendFrame(dst, data []byte) ([]byte, error) {
+	dst, _ = f.appendHeader(dst, len(data))
+	return append(dst, data...), nil
+}
+
+func (varintFramer) appendHeader(dst []byte, n int) ([]byte, error) {
+	var prefix [binary.MaxVarintLen64]byte
+	return append(dst, prefix[:binary.PutUvarint(prefix[:], uint64(n))]...), nil
+}
+
+// LineFramer delimits frames by newline, trailing "\n" or "\r\n" is removed
+// from frames. Data of frames written must not contain newline.
+var LineFramer Framer = lineFramer{}
+
+type lineFramer struct{}
+
+func (lineFramer) ReadFrame(r *bufio.Reader, buf []byte, maxSize int) ([]byte, int, error) {
+	buf = buf[:0]
+	n := 0
+	for {
+		line, err := r.ReadSlice('\n')
+		n += len(line)
+		// newline and carriage return are not counted in size
+		if len(buf)+len(line) > maxSize+2 {
+			return nil, n, errLengthTooBig
+		}
+		buf = append(buf, line...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, n, err
+		}
+		break
+	}
+	buf = buf[:len(buf)-1]
+	if len(buf) > 0 && buf[len(buf)-1] == '\r' {
+		buf = buf[:len(buf)-1]
+	}
+	if len(buf) > maxSize {
+		return nil, n, errLengthTooBig
+	}
+	return buf, n, nil
+}
+
+func (f lineFramer) AppendFrame(dst, data []byte) ([]byte, error) {
+	if err := f.checkFrame(data); err != nil {
+		return dst, err
+	}
+	dst = append(dst, data...)
+	return append(dst, '\n'), nil
+}
+
+func (lineFramer) checkFrame(data []byte) error {
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return errNewlineInFrame
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFramer(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	for i, ts := range []struct {
+		framer Framer
+		frames []string
+		prefix []byte // framing of the first frame
+	}{
+		{BigEndian16Framer, []string{"hello", "", long}, []byte{0, 5}},
+		{BigEndian32Framer, []string{"hello", "", long}, []byte{0, 0, 0, 5}},
+		{LittleEndian16Framer, []string{"hello", "", long}, []byte{5, 0}},
+		{LittleEndian32Framer, []string{"hello", "", long}, []byte{5, 0, 0, 0}},
+		{VarintFramer, []string{long, "", "hello"}, []byte{0xAC, 0x02}},
+		{LineFramer, []string{"hello", "", long}, nil},
+	} {
+		var (
+			data []byte
+			err  error
+		)
+		for _, frame := range ts.frames {
+			if data, err = ts.framer.AppendFrame(data, []byte(frame)); err != nil {
+				t.Fatalf("%dth: append frame error: %v", i, err)
+			}
+		}
+		if !bytes.HasPrefix(data, ts.prefix) {
+			t.Errorf("%dth: want prefix %v, but got %v", i, ts.prefix, data[:len(ts.prefix)])
+		}
+		r := bufio.NewReaderSize(bytes.NewReader(data), 16)
+		var (
+			buf   []byte
+			total int
+		)
+		for j, want := range ts.frames {
+			frame, n, err := ts.framer.ReadFrame(r, buf, 1024)
+			if err != nil || string(frame) != want {
+				t.Errorf("%dth: want frame %d %q, but got %q and error %v", i, j, want, frame, err)
+			}
+			buf = frame
+			total += n
+		}
+		if total != len(data) {
+			t.Errorf("%dth: want %d bytes read, but got %d", i, len(data), total)
+		}
+		if _, _, err := ts.framer.ReadFrame(r, buf, 1024); err != io.EOF {
+			t.Errorf("%dth: want EOF, but got %v", i, err)
+		}
+		// frame too large
+		r = bufio.NewReaderSize(bytes.NewReader(data), 16)
+		for _, frame := range ts.frames {
+			if _, _, err := ts.framer.ReadFrame(r, nil, 100); err != nil {
+				if err != errLengthTooBig || len(frame) <= 100 {
+					t.Errorf("%dth: unexpected error %v of frame of length %d", i, err, len(frame))
+				}
+				break
+			}
+		}
+	}
+	if _, err := LineFramer.AppendFrame(nil, []byte("a\nb")); err == nil {
+		t.Errorf("want error of newline in frame, but got nil")
+	}
+	if _, err := BigEndian16Framer.AppendFrame(nil, make([]byte, 1<<16)); err != errLengthTooBig {
+		t.Errorf("want errLengthTooBig, but got %v", err)
+	}
+}
+
+func TestPacketReaderFramer(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	var packets []string
+	reader := NewPacketReader(server, func(b []byte) {
+		packets = append(packets, string(b))
+	}, WithFramer(LineFramer), WithMaxPacketLength(8))
+	go func() {
+		client.Write([]byte("ping\r\npong\ntoo long line\n"))
+	}()
+	for i, want := range []struct {
+		n   int
+		err error
+	}{{6, nil}, {5, nil}, {14, errLengthTooBig}} {
+		if n, err := reader.ReadPacket(); n != want.n || err != want.err {
+			t.Errorf("%dth: want %d bytes and error %v, but got %d and %v", i, want.n, want.err, n, err)
+		}
+	}
+	if strings.Join(packets, ",") != "ping,pong" {
+		t.Errorf("unexpected packets %v", packets)
+	}
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"net"
@@ -32,16 +33,40 @@ type Config struct {
 	Protocol     string // websocket or tcp
 	Path         string // URL path for websocket protocol
 	ConWriteSize int
-	KeyFile      string
-	CertFile     string
+	// KeyFile and CertFile serve TLS, they are supported by tcp protocol only
+	KeyFile  string
+	CertFile string
+	// Framer frames packets read and sent if non-nil, otherwise packets are
+	// read by netutil.DefaultFramer and sent as they are
+	Framer netutil.Framer
+	// SendPolicy decides what sending does if queue of session is full,
+	// SendTimeout is timeout of sending blocked by netutil.OverflowBlock
+	SendPolicy  netutil.OverflowPolicy
+	SendTimeout time.Duration
+	// ReadTimeout is timeout of reading a packet, zero means no timeout
+	ReadTimeout time.Duration
+	// Heartbeat sends pings and quits idle sessions if non-nil
+	Heartbeat *netutil.Heartbeat
+
+	// limits of connections, zero means no limit
+	MaxConns      int
+	MaxConnsPerIP int
+	AcceptRate    float64 // connections accepted per second
+	AcceptBurst   int
+	// CIDRs or IPs of remote addresses allowed or denied
+	Allow []string
+	Deny  []string
 }
 
 type Gate struct {
 	config  Config
 	newUser func() User
+	server  *netutil.Server
+	quit    chan struct{}
 
-	locker sync.RWMutex
-	users  map[int64]User
+	locker   sync.RWMutex
+	users    map[int64]User
+	sessions map[netutil.Session]struct{}
 }
 
 func New(cfg Config, newUser func() User) *Gate {
@@ -49,57 +74,136 @@ func New(cfg Config, newUser func() User) *Gate {
 		cfg.Protocol = protocol.TCP
 	}
 	return &Gate{
-		config:  cfg,
-		users:   make(map[int64]User),
-		newUser: newUser,
+		config:   cfg,
+		users:    make(map[int64]User),
+		sessions: make(map[netutil.Session]struct{}),
+		newUser:  newUser,
+		quit:     make(chan struct{}),
 	}
 }
 
+// Startup starts serving, it blocks until gate shut down if async is false
 func (gate *Gate) Startup(async bool) error {
-	var (
-		cert tls.Certificate
-		err  error
-	)
-	if gate.config.KeyFile != "" {
-		cert, err = tls.LoadX509KeyPair(gate.config.CertFile, gate.config.KeyFile)
-		if err != nil {
-			return err
-		}
+	opts, err := gate.serverOptions()
+	if err != nil {
+		return err
 	}
+	var server *netutil.Server
 	switch gate.config.Protocol {
 	case protocol.TCP:
-		err = netutil.ListenAndServeTCP(gate.config.Addr, gate.handleConn, async, cert)
+		server, err = netutil.ListenAndServeTCP(gate.config.Addr, gate.handleConn, true, opts...)
 	case protocol.Websocket:
-		err = netutil.ListenAndServeWebsocket(gate.config.Addr, gate.config.Path, gate.handleConn, async)
+		server, err = netutil.ListenAndServeWebsocket(gate.config.Addr, gate.config.Path, gate.handleConn, true, opts...)
 	default:
 		err = ErrUnsupportedProtocol
 	}
-	// clear unauthorized users
-	go func() {
-		for range time.Tick(time.Minute) {
-			expire := time.Now().Add(-time.Second * 30).Unix()
-			gate.locker.Lock()
-			for key, user := range gate.users {
-				if user.Authorized() {
-					continue
-				}
-				if lastUnauthorizedTime := user.LastUnauthorizedTime(); lastUnauthorizedTime < expire {
-					delete(gate.users, key)
-					session := user.GetSession()
-					if session != nil {
-						session.Quit()
-					}
+	if err != nil {
+		return err
+	}
+	gate.locker.Lock()
+	gate.server = server
+	gate.locker.Unlock()
+	go gate.clearUnauthorizedUsers()
+	if !async {
+		return server.Wait()
+	}
+	return nil
+}
+
+func (gate *Gate) serverOptions() ([]netutil.ServerOption, error) {
+	cfg := gate.config
+	var opts []netutil.ServerOption
+	if cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, netutil.WithCertificates(cert))
+	}
+	if len(cfg.Allow) > 0 {
+		nets, err := netutil.ParseCIDRs(cfg.Allow...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, netutil.WithAllow(nets...))
+	}
+	if len(cfg.Deny) > 0 {
+		nets, err := netutil.ParseCIDRs(cfg.Deny...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, netutil.WithDeny(nets...))
+	}
+	if cfg.AcceptRate > 0 {
+		opts = append(opts, netutil.WithAcceptRate(cfg.AcceptRate, cfg.AcceptBurst))
+	}
+	opts = append(opts, netutil.WithMaxConns(cfg.MaxConns), netutil.WithMaxConnsPerIP(cfg.MaxConnsPerIP))
+	return opts, nil
+}
+
+// Stats returns counters of connections, zero returned if gate not started
+func (gate *Gate) Stats() netutil.ServerStats {
+	gate.locker.RLock()
+	server := gate.server
+	gate.locker.RUnlock()
+	if server == nil {
+		return netutil.ServerStats{}
+	}
+	return server.Stats()
+}
+
+// clearUnauthorizedUsers clears unauthorized users every minute until gate shut down
+func (gate *Gate) clearUnauthorizedUsers() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gate.quit:
+			return
+		case <-ticker.C:
+		}
+		expire := time.Now().Add(-time.Second * 30).Unix()
+		gate.locker.Lock()
+		for key, user := range gate.users {
+			if user.Authorized() {
+				continue
+			}
+			if lastUnauthorizedTime := user.LastUnauthorizedTime(); lastUnauthorizedTime < expire {
+				delete(gate.users, key)
+				session := user.GetSession()
+				if session != nil {
+					session.Quit()
 				}
 			}
-			gate.locker.Unlock()
 		}
-	}()
-	return err
+		gate.locker.Unlock()
+	}
 }
 
-func (gate *Gate) Shutdown(wg *sync.WaitGroup) {
-	//TODO
-	wg.Done()
+// Shutdown stops accepting connections, quits all sessions and waits for them
+// to end. Connections are closed if ctx done before that.
+func (gate *Gate) Shutdown(ctx context.Context) error {
+	gate.locker.Lock()
+	server := gate.server
+	select {
+	case <-gate.quit:
+	default:
+		close(gate.quit)
+	}
+	gate.locker.Unlock()
+	if server == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(ctx)
+	}()
+	gate.locker.RLock()
+	for session := range gate.sessions {
+		session.Quit()
+	}
+	gate.locker.RUnlock()
+	return <-done
 }
 
 func (gate *Gate) UserCount() int {
@@ -111,10 +215,31 @@ func (gate *Gate) UserCount() int {
 func (gate *Gate) handleConn(conn net.Conn) {
 	id := conn.RemoteAddr().String()
 	user := gate.newUser()
-	reader := netutil.NewPacketReader(conn, user.OnRecv)
-	session := netutil.NewRWSession(id, gate.config.ConWriteSize, reader)
+	opts := []netutil.SessionOption{
+		netutil.WithOverflowPolicy(gate.config.SendPolicy),
+		netutil.WithSendTimeout(gate.config.SendTimeout),
+	}
+	var reader netutil.PacketReader
+	if framer := gate.config.Framer; framer != nil {
+		reader = netutil.NewPacketReader(conn, user.OnRecv, netutil.WithFramer(framer))
+		writer := netutil.NewPacketWriter(conn, netutil.WithFramer(framer))
+		opts = append(opts, netutil.WithPacketWriter(writer))
+	} else {
+		reader = netutil.NewPacketReader(conn, user.OnRecv)
+	}
+	reader.SetTimeout(gate.config.ReadTimeout)
+	if hb := gate.config.Heartbeat; hb != nil {
+		opts = append(opts, netutil.WithHeartbeat(*hb))
+	}
+	session := netutil.NewRWSession(id, gate.config.ConWriteSize, reader, opts...)
 	user.SetSession(session)
+	gate.locker.Lock()
+	gate.sessions[session] = struct{}{}
+	gate.locker.Unlock()
 	session.Run(user.OnNewSession, user.OnQuitSession)
+	gate.locker.Lock()
+	delete(gate.sessions, session)
+	gate.locker.Unlock()
 	user.SetSession(nil)
 }
 
@@ -149,6 +274,9 @@ func (gate *Gate) ForEachUser(visitor UserVisitor) (_break bool) {
 	return
 }
 
+// Broadcast sends packet to receivers, or all users if receivers empty. Errors
+// of sending are ignored, set a non-blocking SendPolicy so that slow users
+// can't block broadcasting.
 func (gate *Gate) Broadcast(receivers []int64, packet netutil.Packet) {
 	gate.locker.RLock()
 	defer gate.locker.RUnlock()
@@ -165,13 +293,15 @@ func (gate *Gate) Broadcast(receivers []int64, packet netutil.Packet) {
 	}
 }
 
-func (gate *Gate) Send(user User, packet netutil.Packet) {
+// Send sends packet to authorized user, error of session returned
+func (gate *Gate) Send(user User, packet netutil.Packet) error {
 	if user.Authorized() {
 		session := user.GetSession()
 		if session != nil {
-			session.Send(packet)
+			return session.Send(packet)
 		}
 	}
+	return nil
 }
 
 func (gate *Gate) GetUser(uid int64) (User, bool) {
@@ -0,0 +1,119 @@
+package netutil
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat configures keepalive of RWSession, see WithHeartbeat
+type Heartbeat struct {
+	// Interval of sending pings, zero means no pings
+	Interval time.Duration
+	// IdleTimeout quits session if nothing received for the duration, zero
+	// means no timeout
+	IdleTimeout time.Duration
+	// Ping is packet sent every Interval
+	Ping Packet
+	// IsPong reports whether received packet is a pong. Pongs are consumed by
+	// session to measure round-trip time, they are not passed to handler.
+	IsPong func(b []byte) bool
+}
+
+// WithHeartbeat returns an option which sends pings and quits idle sessions
+// by hb. Round-trip time is measured from queuing of the latest ping to
+// receiving of the next pong. It takes effect for RWSession, and pongs are
+// recognized only if reader of session is created by NewPacketReader.
+func WithHeartbeat(hb Heartbeat) SessionOption {
+	return func(ws *WSession) {
+		ws.heartbeat = hb
+	}
+}
+
+// pongInterceptor is implemented by readers which let session consume pongs
+type pongInterceptor interface {
+	interceptPong(isPong func([]byte) bool, onPong func())
+}
+
+func (r *packetReader) interceptPong(isPong func([]byte) bool, onPong func()) {
+	handler := r.packetHandler
+	r.packetHandler = func(b []byte) {
+		if isPong(b) {
+			onPong()
+			return
+		}
+		handler(b)
+	}
+}
+
+// received records time of receiving
+func (ws *WSession) received(now time.Time) {
+	atomic.StoreInt64(&ws.lastRecv, now.UnixNano())
+}
+
+// onPong records round-trip time of the outstanding ping
+func (ws *WSession) onPong() {
+	atomic.AddInt64(&ws.pongs, 1)
+	sent := atomic.SwapInt64(&ws.pingSent, 0)
+	if sent == 0 {
+		return
+	}
+	rtt := time.Now().UnixNano() - sent
+	atomic.StoreInt64(&ws.rtt, rtt)
+	// smoothed like TCP: srtt = 7/8 srtt + 1/8 rtt
+	for {
+		old := atomic.LoadInt64(&ws.srtt)
+		srtt := rtt
+		if old > 0 {
+			srtt = old - old/8 + rtt/8
+		}
+		if atomic.CompareAndSwapInt64(&ws.srtt, old, srtt) {
+			return
+		}
+	}
+}
+
+// startHeartbeatLoop sends pings and checks idle until session quit
+func (ws *WSession) startHeartbeatLoop() {
+	hb := ws.heartbeat
+	pinging := hb.Ping != nil && hb.Interval > 0
+	var tick time.Duration
+	if pinging {
+		tick = hb.Interval
+	}
+	if hb.IdleTimeout > 0 && (tick <= 0 || hb.IdleTimeout/2 < tick) {
+		tick = hb.IdleTimeout / 2
+	}
+	if tick <= 0 {
+		return
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	start := time.Now()
+	var lastPing time.Time
+	for {
+		select {
+		case <-ws.ctx.Done():
+			return
+		case now := <-ticker.C:
+			last := start
+			if t := atomic.LoadInt64(&ws.lastRecv); t > 0 {
+				last = time.Unix(0, t)
+			}
+			if hb.IdleTimeout > 0 && now.Sub(last) >= hb.IdleTimeout {
+				atomic.StoreInt32(&ws.idleTimedOut, 1)
+				ws.Quit()
+				return
+			}
+			if !pinging || now.Sub(lastPing) < hb.Interval {
+				continue
+			}
+			lastPing = now
+			atomic.StoreInt64(&ws.pingSent, now.UnixNano())
+			if ws.Send(hb.Ping) == nil {
+				atomic.AddInt64(&ws.pings, 1)
+			} else {
+				atomic.StoreInt64(&ws.pingSent, 0)
+			}
+		}
+	}
+}
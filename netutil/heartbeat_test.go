@@ -0,0 +1,79 @@
+package netutil
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionHeartbeat(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	reader := NewPacketReader(server, func(b []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(b))
+	}, WithFramer(LineFramer))
+	session := NewRWSession("test", 8, reader,
+		WithPacketWriter(NewPacketWriter(server, WithFramer(LineFramer))),
+		WithHeartbeat(Heartbeat{
+			Interval:    10 * time.Millisecond,
+			IdleTimeout: 100 * time.Millisecond,
+			Ping:        BytesPacket("ping"),
+			IsPong:      func(b []byte) bool { return string(b) == "pong" },
+		}),
+	)
+	done := make(chan struct{})
+	go func() {
+		session.Run(nil, nil)
+		close(done)
+	}()
+
+	// reply 3 pings, then keep reading but stop replying
+	go func() {
+		r := bufio.NewReader(client)
+		pongs := 0
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "ping\n" && pongs < 3 {
+				pongs++
+				client.Write([]byte("pong\ndata\n"))
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle session not quit")
+	}
+	stats := session.Stats()
+	if !stats.IdleTimedOut {
+		t.Errorf("want session quit for idle timeout")
+	}
+	if stats.Pongs != 3 || stats.Pings < 3 {
+		t.Errorf("want 3 pongs of at least 3 pings, but got %d pongs of %d pings", stats.Pongs, stats.Pings)
+	}
+	if stats.RTT <= 0 || stats.SmoothedRTT <= 0 || stats.LastRecv.IsZero() {
+		t.Errorf("want RTT and time of receiving measured, but got %+v", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Errorf("want 3 packets passed to handler, but got %q", received)
+	}
+	for _, p := range received {
+		if p != "data" {
+			t.Errorf("want pongs consumed by session, but got %q", p)
+		}
+	}
+}
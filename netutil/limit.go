@@ -0,0 +1,229 @@
+package netutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerOption represents a function for setting options of Server
+type ServerOption func(*Server)
+
+// WithCertificates returns an option which serves TLS with certs
+func WithCertificates(certs ...tls.Certificate) ServerOption {
+	return func(s *Server) {
+		if len(certs) > 0 {
+			s.tlsConfig = &tls.Config{Certificates: certs}
+		}
+	}
+}
+
+// WithMaxConns returns an option which limits number of concurrent
+// connections, connections over the limit are rejected. Zero means no limit.
+func WithMaxConns(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP returns an option which limits number of concurrent
+// connections of each remote IP. Zero means no limit.
+func WithMaxConnsPerIP(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// WithAcceptRate returns an option which limits rate of accepting connections
+// to rate per second with bursts of at most burst connections. Connections
+// over the rate are rejected.
+func WithAcceptRate(rate float64, burst int) ServerOption {
+	return func(s *Server) {
+		if burst < 1 {
+			burst = 1
+		}
+		s.limiter = &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+	}
+}
+
+// WithAllow returns an option which rejects connections whose remote IP is
+// not in any of nets, see ParseCIDRs
+func WithAllow(nets ...*net.IPNet) ServerOption {
+	return func(s *Server) {
+		s.allow = append(s.allow, nets...)
+	}
+}
+
+// WithDeny returns an option which rejects connections whose remote IP is in
+// any of nets. Deny list is checked before allow list.
+func WithDeny(nets ...*net.IPNet) ServerOption {
+	return func(s *Server) {
+		s.deny = append(s.deny, nets...)
+	}
+}
+
+// ParseCIDRs parses CIDRs like 10.0.0.0/8, or IPs which are parsed as
+// networks of single IP
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// ServerStats holds counters of connections of Server
+type ServerStats struct {
+	Accepted int64 // connections admitted
+	Active   int64 // connections being served
+	Rejected int64 // connections rejected for any reason
+
+	RejectedByFilter        int64 // rejected by allow and deny lists
+	RejectedByRate          int64 // rejected by accept rate
+	RejectedByMaxConns      int64 // rejected by max connections
+	RejectedByMaxConnsPerIP int64 // rejected by max connections of remote IP
+}
+
+// Stats returns counters of connections
+func (s *Server) Stats() ServerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// rateLimiter is a token bucket
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func remoteIP(conn net.Conn) net.IP {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit checks limits and filters of conn before it's handled, it returns a
+// release function of admitted conn, or nil if conn rejected
+func (s *Server) admit(conn net.Conn) func() {
+	ip := remoteIP(conn)
+	key := ip.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rejected := func(counter *int64) func() {
+		*counter++
+		s.stats.Rejected++
+		return nil
+	}
+	if (len(s.deny) > 0 || len(s.allow) > 0) && ip == nil {
+		return rejected(&s.stats.RejectedByFilter)
+	}
+	if containsIP(s.deny, ip) || (len(s.allow) > 0 && !containsIP(s.allow, ip)) {
+		return rejected(&s.stats.RejectedByFilter)
+	}
+	if s.limiter != nil && !s.limiter.allow(time.Now()) {
+		return rejected(&s.stats.RejectedByRate)
+	}
+	if s.maxConns > 0 && s.stats.Active >= int64(s.maxConns) {
+		return rejected(&s.stats.RejectedByMaxConns)
+	}
+	if s.maxConnsPerIP > 0 && s.ipConns[key] >= s.maxConnsPerIP {
+		return rejected(&s.stats.RejectedByMaxConnsPerIP)
+	}
+	s.stats.Accepted++
+	s.stats.Active++
+	s.ipConns[key]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.stats.Active--
+			if s.ipConns[key]--; s.ipConns[key] <= 0 {
+				delete(s.ipConns, key)
+			}
+		})
+	}
+}
+
+// admitListener admits connections accepted from Listener, admitted
+// connections are released when closed
+type admitListener struct {
+	net.Listener
+	s *Server
+}
+
+func (l admitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if release := l.s.admit(conn); release != nil {
+			return &admittedConn{Conn: conn, release: release}, nil
+		}
+		conn.Close()
+	}
+}
+
+type admittedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *admittedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
@@ -1,7 +1,7 @@
 package netutil
 
 import (
-	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"time"
@@ -43,7 +43,7 @@ func KeepAliveTCPConn(conn net.Conn, d time.Duration) {
 }
 
 func listenTCP(addrStr string) (net.Listener, error) {
-	addr, err := net.ResolveTCPAddr("tcp4", addrStr)
+	addr, err := net.ResolveTCPAddr("tcp", addrStr)
 	if err != nil {
 		return nil, err
 	}
@@ -60,45 +60,42 @@ func listenUDP(addrStr string) (*net.UDPConn, error) {
 	return listener, err
 }
 
-func serve(listener net.Listener, handler func(net.Conn), async bool) error {
-	serveFunc := func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				continue
-			}
-			go handler(conn)
-		}
-	}
+var errWebsocketTLS = errors.New("netutil: certificates are not supported by websocket server")
+
+func serve(server *Server, serveFunc func() error, async bool) (*Server, error) {
 	if async {
 		go serveFunc()
-	} else {
-		serveFunc()
+		return server, nil
 	}
-	return nil
+	return server, serveFunc()
 }
 
-func ListenAndServeTCP(addrStr string, handler func(net.Conn), async bool, certs ...tls.Certificate) error {
-	var (
-		listener net.Listener
-		err      error
-	)
-	if len(certs) > 0 {
-		config := &tls.Config{Certificates: certs}
-		listener, err = tls.Listen("tcp", addrStr, config)
-	} else {
-		listener, err = listenTCP(addrStr)
-	}
-	if err == nil {
-		err = serve(listener, handler, async)
+// ListenAndServeTCP listens on TCP address addrStr and handles connections
+// by handler with options, e.g. WithCertificates for TLS. If async is true, it
+// serves in background and returns the Server, otherwise it blocks until the
+// Server shut down and returns ErrServerClosed, or an error of accepting.
+func ListenAndServeTCP(addrStr string, handler func(net.Conn), async bool, opts ...ServerOption) (*Server, error) {
+	listener, err := listenTCP(addrStr)
+	if err != nil {
+		return nil, err
 	}
-	return err
+	server := NewServer(handler, opts...)
+	// set listener before serving, so Addr of async server is available
+	server.listener = listener
+	return serve(server, func() error { return server.Serve(listener) }, async)
 }
 
-func ListenAndServeWebsocket(addrStr, path string, handler func(net.Conn), async bool) error {
+// ListenAndServeWebsocket listens on TCP address addrStr and handles websocket
+// connections of URL path by handler, async and opts are same as
+// ListenAndServeTCP except that certificates are not supported
+func ListenAndServeWebsocket(addrStr, path string, handler func(net.Conn), async bool, opts ...ServerOption) (*Server, error) {
+	server := NewServer(handler, opts...)
+	if server.tlsConfig != nil {
+		return nil, errWebsocketTLS
+	}
 	mux := http.NewServeMux()
 	mux.Handle(path, websocket.Handler(func(conn *websocket.Conn) {
-		handler(conn)
+		server.handle(conn, nil)
 	}))
 	httpServer := &http.Server{
 		Addr:           addrStr,
@@ -107,33 +104,33 @@ func ListenAndServeWebsocket(addrStr, path string, handler func(net.Conn), async
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	if async {
-		ln, err := net.Listen("tcp", httpServer.Addr)
-		if err != nil {
-			return err
-		}
-		go httpServer.Serve(NewTCPKeepAliveListener(ln.(*net.TCPListener), time.Minute*3))
-		return nil
+	ln, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		return nil, err
 	}
-	return httpServer.ListenAndServe()
+	server.mu.Lock()
+	server.listener = ln
+	server.httpServer = httpServer
+	server.mu.Unlock()
+	// connections are admitted before http handshake
+	listener := admitListener{Listener: NewTCPKeepAliveListener(ln.(*net.TCPListener), time.Minute*3), s: server}
+	return serve(server, func() error {
+		err := httpServer.Serve(listener)
+		if err == http.ErrServerClosed {
+			err = ErrServerClosed
+		}
+		return server.end(err)
+	}, async)
 }
 
-func ListenAndServeUDP(addrStr string, handler func(*net.UDPConn), async bool) error {
+// ListenAndServeUDP listens on UDP address addrStr and calls handler with the
+// UDP connection repeatedly, async is same as ListenAndServeTCP
+func ListenAndServeUDP(addrStr string, handler func(*net.UDPConn), async bool) (*Server, error) {
 	udpconn, err := listenUDP(addrStr)
 	if err != nil {
-		return err
-	}
-
-	serveFunc := func() {
-		defer udpconn.Close()
-		for {
-			handler(udpconn)
-		}
-	}
-	if async {
-		go serveFunc()
-	} else {
-		serveFunc()
+		return nil, err
 	}
-	return nil
+	server := NewServer(nil)
+	server.udpConn = udpconn
+	return serve(server, func() error { return server.ServeUDP(udpconn, handler) }, async)
 }
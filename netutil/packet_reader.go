@@ -1,7 +1,7 @@
 package netutil
 
 import (
-	"encoding/binary"
+	"bufio"
 	"errors"
 	"net"
 	"time"
@@ -20,20 +20,59 @@ type PacketReader interface {
 	SetTimeout(d time.Duration)
 }
 
+// PacketOption represents a function for setting options of PacketReader and
+// PacketWriter, so that both sides of a connection use same framing
+type PacketOption func(*packetOptions)
+
+type packetOptions struct {
+	framer    Framer
+	maxLength int
+}
+
+func applyPacketOptions(opts []PacketOption) packetOptions {
+	o := packetOptions{
+		framer:    DefaultFramer,
+		maxLength: MaxPacketLength,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFramer returns an option which sets framer of packets, default is
+// DefaultFramer which prefixes packets by 4 bytes big-endian length
+func WithFramer(framer Framer) PacketOption {
+	return func(o *packetOptions) {
+		o.framer = framer
+	}
+}
+
+// WithMaxPacketLength returns an option which sets max length of packets,
+// default is MaxPacketLength
+func WithMaxPacketLength(n int) PacketOption {
+	return func(o *packetOptions) {
+		o.maxLength = n
+	}
+}
+
 type packetReader struct {
+	packetOptions
 	id            string
 	conn          net.Conn
+	reader        *bufio.Reader
 	timeout       time.Duration
 	buf           []byte
-	byte1         [LengthNeedSize]byte
 	packetHandler PacketHandler
 }
 
 // NewPacketReader creates a PacketReader with net.Conn and PacketHandler
-func NewPacketReader(conn net.Conn, packetHandler PacketHandler) PacketReader {
+func NewPacketReader(conn net.Conn, packetHandler PacketHandler, opts ...PacketOption) PacketReader {
 	return &packetReader{
+		packetOptions: applyPacketOptions(opts),
 		id:            conn.RemoteAddr().String(),
 		conn:          conn,
+		reader:        bufio.NewReader(conn),
 		packetHandler: packetHandler,
 	}
 }
@@ -43,50 +82,24 @@ func (r *packetReader) SetTimeout(d time.Duration) { r.timeout = d }
 
 const (
 	LengthNeedSize  = 4
-	MaxPacketLength = 4 * 1024 * 1024 // 4M
+	MaxPacketLength = 4 * 1024 * 1024 // 4M, default max length of packets
 )
 
-func (r *packetReader) read(b []byte) (int, error) {
-	length := len(b)
-	readedNum := 0
-	for readedNum < length {
-		n, err := r.conn.Read(b[readedNum:length])
-		readedNum += n
-		if err != nil {
-			return readedNum, err
-		}
-	}
-	return readedNum, nil
-}
-
 func (r *packetReader) ReadPacket() (int, error) {
-	total := 0
 	// set read timeout
 	if r.timeout > 0 {
 		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
 	}
-	// read packet length(lenof(packet.length)+lenof(packet.body)
-	n, err := r.read(r.byte1[:])
-	total += n
+	packet, n, err := r.framer.ReadFrame(r.reader, r.buf, r.maxLength)
 	if err != nil {
-		return total, err
-	}
-	// parse packet length
-	length := binary.BigEndian.Uint32(r.byte1[:])
-	if length > MaxPacketLength {
-		return total, errLengthTooBig
+		return n, err
 	}
-	// read packet body
-	if len(r.buf) < int(length) {
-		r.buf = make([]byte, length)
-	}
-	n, err = r.read(r.buf[:length])
-	total += n
-	if err != nil {
-		return total, err
+	// reuse buffer of packet
+	if cap(packet) > cap(r.buf) {
+		r.buf = packet[:0]
 	}
 
 	// handle readed body
-	r.packetHandler(r.buf[:length])
-	return total, nil
+	r.packetHandler(packet)
+	return n, nil
 }
@@ -0,0 +1,129 @@
+package netutil
+
+import (
+	"net"
+	"time"
+)
+
+// PacketWriter writes network packets framed same as PacketReader
+type PacketWriter interface {
+	Conn() net.Conn
+	// WritePackets frames packets and writes them in a single write, e.g.
+	// writev(2) for TCP connections
+	WritePackets(packets ...Packet) (n int64, err error)
+	SetTimeout(d time.Duration)
+}
+
+// packetChecker is implemented by writers which check packets before queued
+type packetChecker interface {
+	checkPacket(p Packet) error
+}
+
+type packetWriter struct {
+	packetOptions
+	conn    net.Conn
+	timeout time.Duration
+	headers []byte // headers of packets being written
+	offsets []int  // end offsets of headers
+	buffers net.Buffers
+	frames  []byte // framed packets of framers which are not headerFramer
+}
+
+// NewPacketWriter creates a PacketWriter with net.Conn, options are same as
+// PacketReader of the other side
+func NewPacketWriter(conn net.Conn, opts ...PacketOption) PacketWriter {
+	return &packetWriter{
+		packetOptions: applyPacketOptions(opts),
+		conn:          conn,
+	}
+}
+
+// newRawPacketWriter creates a PacketWriter which writes packets without framing
+func newRawPacketWriter(conn net.Conn) PacketWriter {
+	return &packetWriter{conn: conn}
+}
+
+func (w *packetWriter) Conn() net.Conn             { return w.conn }
+func (w *packetWriter) SetTimeout(d time.Duration) { w.timeout = d }
+
+func (w *packetWriter) WritePackets(packets ...Packet) (int64, error) {
+	if err := w.frame(packets); err != nil {
+		return 0, err
+	}
+	// set write timeout
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+	// WriteTo consumes buffers, so keep the slice for reusing
+	buffers := w.buffers
+	n, err := buffers.WriteTo(w.conn)
+	for i := range w.buffers {
+		w.buffers[i] = nil
+	}
+	return n, err
+}
+
+// checkPacket reports error of framing p, so that a bad packet is rejected
+// before it's queued with others
+func (w *packetWriter) checkPacket(p Packet) error {
+	if w.framer == nil {
+		return nil
+	}
+	if w.maxLength > 0 && p.Len() > w.maxLength {
+		return errLengthTooBig
+	}
+	switch f := w.framer.(type) {
+	case headerFramer:
+		var header [16]byte
+		_, err := f.appendHeader(header[:0], p.Len())
+		return err
+	case frameChecker:
+		return f.checkFrame(p.Bytes())
+	default:
+		_, err := f.AppendFrame(nil, p.Bytes())
+		return err
+	}
+}
+
+// frame builds buffers of packets
+func (w *packetWriter) frame(packets []Packet) error {
+	w.buffers = w.buffers[:0]
+	w.headers = w.headers[:0]
+	w.offsets = w.offsets[:0]
+	w.frames = w.frames[:0]
+	if w.framer == nil {
+		for _, p := range packets {
+			w.buffers = append(w.buffers, p.Bytes())
+		}
+		return nil
+	}
+	for _, p := range packets {
+		if w.maxLength > 0 && p.Len() > w.maxLength {
+			return errLengthTooBig
+		}
+	}
+	if hf, ok := w.framer.(headerFramer); ok {
+		var err error
+		for _, p := range packets {
+			if w.headers, err = hf.appendHeader(w.headers, p.Len()); err != nil {
+				return err
+			}
+			w.offsets = append(w.offsets, len(w.headers))
+		}
+		// slice headers after all appended since appending may reallocate
+		start := 0
+		for i, p := range packets {
+			w.buffers = append(w.buffers, w.headers[start:w.offsets[i]], p.Bytes())
+			start = w.offsets[i]
+		}
+		return nil
+	}
+	var err error
+	for _, p := range packets {
+		if w.frames, err = w.framer.AppendFrame(w.frames, p.Bytes()); err != nil {
+			return err
+		}
+	}
+	w.buffers = append(w.buffers, w.frames)
+	return nil
+}
@@ -0,0 +1,105 @@
+package netutil
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPacketWriter(t *testing.T) {
+	for i, framer := range []Framer{BigEndian32Framer, LittleEndian16Framer, VarintFramer, LineFramer} {
+		client, server := net.Pipe()
+		writer := NewPacketWriter(client, WithFramer(framer), WithMaxPacketLength(16))
+		var packets []string
+		reader := NewPacketReader(server, func(b []byte) {
+			packets = append(packets, string(b))
+		}, WithFramer(framer), WithMaxPacketLength(16))
+		if _, err := writer.WritePackets(BytesPacket(strings.Repeat("x", 17))); err != errLengthTooBig {
+			t.Errorf("%dth: want errLengthTooBig, but got %v", i, err)
+		}
+		go func() {
+			writer.WritePackets(BytesPacket("a"), BytesPacket("bc"), BytesPacket(""))
+			writer.WritePackets(BytesPacket("def"))
+		}()
+		for j := 0; j < 4; j++ {
+			if _, err := reader.ReadPacket(); err != nil {
+				t.Fatalf("%dth: read packet error: %v", i, err)
+			}
+		}
+		if got := strings.Join(packets, ","); got != "a,bc,,def" {
+			t.Errorf("%dth: unexpected packets %s", i, got)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestSessionPacketWriter(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	writer := NewPacketWriter(server, WithFramer(VarintFramer))
+	session := NewWSession("test", server, 8, WithPacketWriter(writer))
+	go session.Run(nil, nil)
+	session.Send(BytesPacket("hello"))
+	session.Send(BytesPacket("world"))
+
+	packets := make(chan string, 2)
+	reader := NewPacketReader(client, func(b []byte) {
+		packets <- string(b)
+	}, WithFramer(VarintFramer))
+	go func() {
+		for {
+			if _, err := reader.ReadPacket(); err != nil {
+				return
+			}
+		}
+	}()
+	for _, want := range []string{"hello", "world"} {
+		select {
+		case p := <-packets:
+			if p != want {
+				t.Errorf("want packet %s, but got %s", want, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("packet %s not received", want)
+		}
+	}
+	session.Quit()
+}
+
+func TestSessionSendInvalidPacket(t *testing.T) {
+	for i, ts := range []struct {
+		framer  Framer
+		packets []string
+		valid   string
+	}{
+		{BigEndian16Framer, []string{"ok", "toolong", "ok2"}, "ok,ok2"},
+		{LineFramer, []string{"ok", "a\nb", "ok2"}, "ok,ok2"},
+	} {
+		client, server := net.Pipe()
+		writer := NewPacketWriter(server, WithFramer(ts.framer), WithMaxPacketLength(4))
+		session := NewWSession("test", server, 8, WithPacketWriter(writer))
+		go session.Run(nil, nil)
+		var valid []string
+		for _, p := range ts.packets {
+			if err := session.Send(BytesPacket(p)); err == nil {
+				valid = append(valid, p)
+			}
+		}
+		if got := strings.Join(valid, ","); got != ts.valid {
+			t.Errorf("%dth: want packets %s accepted, but got %s", i, ts.valid, got)
+		}
+		reader := NewPacketReader(client, func(b []byte) {}, WithFramer(ts.framer))
+		for range valid {
+			if _, err := reader.ReadPacket(); err != nil {
+				t.Errorf("%dth: read packet error: %v", i, err)
+			}
+		}
+		if session.Closed() {
+			t.Errorf("%dth: want session not closed", i)
+		}
+		session.Quit()
+		client.Close()
+	}
+}
@@ -0,0 +1,250 @@
+package netutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve methods of Server after Shutdown or Close
+var ErrServerClosed = errors.New("netutil: Server closed")
+
+// Server serves connections of a listener, or packets of an UDP connection.
+// Each connection is handled in its own goroutine.
+//
+//	server, err := netutil.ListenAndServeTCP(":8000", handler, true)
+//	if err != nil {
+//		return err
+//	}
+//	defer server.Shutdown(ctx)
+type Server struct {
+	handler       func(net.Conn)
+	tlsConfig     *tls.Config
+	maxConns      int
+	maxConnsPerIP int
+	limiter       *rateLimiter
+	allow         []*net.IPNet
+	deny          []*net.IPNet
+
+	mu         sync.Mutex
+	closed     bool
+	listener   net.Listener
+	udpConn    *net.UDPConn
+	httpServer *http.Server
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup // handlers and UDP loop in flight
+	ipConns    map[string]int // number of connections of each remote IP
+	stats      ServerStats
+
+	done chan struct{} // closed after serving ended
+	err  error         // error of serving
+}
+
+// NewServer creates a Server which handles connections by handler. Limits and
+// filters of options are checked before handler runs, rejected connections
+// are closed and counted in Stats.
+func NewServer(handler func(net.Conn), opts ...ServerOption) *Server {
+	s := &Server{
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+		ipConns: make(map[string]int),
+		done:    make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Wait waits until serving of Serve or ServeUDP ended and returns its error,
+// e.g. serving of async servers returned by ListenAndServe functions
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// end records error of serving, only the first serving is waited by Wait
+func (s *Server) end(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+	default:
+		s.err = err
+		close(s.done)
+	}
+	return err
+}
+
+// Addr returns address of listener or UDP connection, nil returned if not serving
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr()
+	}
+	if s.udpConn != nil {
+		return s.udpConn.LocalAddr()
+	}
+	return nil
+}
+
+// Serve accepts connections from listener until Shutdown or Close called, it
+// always returns a non-nil error and closes listener. Temporary errors of
+// accepting are retried after a delay which grows exponentially to 1 second.
+// Listener is wrapped by TLS if certificates set by WithCertificates.
+func (s *Server) Serve(listener net.Listener) error {
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return s.end(ErrServerClosed)
+	}
+	s.listener = listener
+	s.mu.Unlock()
+	defer listener.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return s.end(ErrServerClosed)
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return s.end(err)
+		}
+		delay = 0
+		release := s.admit(conn)
+		if release == nil {
+			conn.Close()
+			continue
+		}
+		go s.handle(conn, release)
+	}
+}
+
+// ServeUDP calls handler with conn repeatedly until Shutdown or Close called,
+// handler should read one packet from conn at a time
+func (s *Server) ServeUDP(conn *net.UDPConn, handler func(*net.UDPConn)) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return s.end(ErrServerClosed)
+	}
+	s.udpConn = conn
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+	defer conn.Close()
+	for !s.isClosed() {
+		handler(conn)
+	}
+	return s.end(ErrServerClosed)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// handle handles conn, conn is tracked until handler returned. release is
+// called after that if it's not nil.
+func (s *Server) handle(conn net.Conn, release func()) {
+	if release != nil {
+		defer release()
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	s.handler(conn)
+}
+
+// stop stops accepting connections and reading UDP packets
+func (s *Server) stop() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	listener, udpConn, httpServer := s.listener, s.udpConn, s.httpServer
+	s.mu.Unlock()
+	if httpServer != nil {
+		// websocket connections are hijacked, they are tracked by s
+		httpServer.Close()
+	}
+	if listener != nil {
+		listener.Close()
+	}
+	if udpConn != nil {
+		// interrupt reading of handler, conn is closed after handler returned
+		udpConn.SetReadDeadline(time.Now())
+	}
+}
+
+// Shutdown stops accepting connections and waits for handlers to return. If
+// ctx done before that, connections still being handled are closed and error
+// of ctx returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting connections and closes all connections immediately
+func (s *Server) Close() error {
+	s.stop()
+	s.closeConns()
+	return nil
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+}
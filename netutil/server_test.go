@@ -0,0 +1,196 @@
+package netutil
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	handled := make(chan struct{}, 2)
+	server, err := ListenAndServeTCP("127.0.0.1:0", func(conn net.Conn) {
+		defer conn.Close()
+		// echo until connection closed
+		io.Copy(conn, conn)
+		handled <- struct{}{}
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn1, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn1.Close()
+	conn2, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn1.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn1, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("want echo ping, but got %q and error %v", buf, err)
+	}
+	conn2.Write([]byte("ping"))
+	if _, err := io.ReadFull(conn2, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// handler of conn1 ends before deadline
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn1.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, but got %v", err)
+	}
+	// conn2 is closed by server after deadline
+	if data, err := ioutil.ReadAll(conn2); err != nil || len(data) != 0 {
+		t.Errorf("want conn closed, but got %q and error %v", data, err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("handler %d not returned", i)
+		}
+	}
+	if err := server.Wait(); err != ErrServerClosed {
+		t.Errorf("want ErrServerClosed, but got %v", err)
+	}
+	if _, err := net.Dial("tcp", server.Addr().String()); err == nil {
+		t.Errorf("want error of dialing closed server, but got nil")
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("want nil error of shutting down again, but got %v", err)
+	}
+}
+
+func TestServerUDP(t *testing.T) {
+	packets := make(chan string, 1)
+	server, err := ListenAndServeUDP("127.0.0.1:0", func(conn *net.UDPConn) {
+		buf := make([]byte, 64)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err == nil {
+			packets <- string(buf[:n])
+		}
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	select {
+	case p := <-packets:
+		if p != "hello" {
+			t.Errorf("want packet hello, but got %s", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("packet not received")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("want nil error, but got %v", err)
+	}
+	if err := server.Wait(); err != ErrServerClosed {
+		t.Errorf("want ErrServerClosed, but got %v", err)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	loopback, err := ParseCIDRs("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParseCIDRs("10.0.0.1", "::1")
+	if err != nil || other[0].String() != "10.0.0.1/32" || other[1].String() != "::1/128" {
+		t.Fatalf("unexpected networks %v and error %v", other, err)
+	}
+	if _, err := ParseCIDRs("10.0.0.1/33"); err == nil {
+		t.Errorf("want error of invalid CIDR, but got nil")
+	}
+
+	for i, ts := range []struct {
+		opts     []ServerOption
+		accepted int
+		stats    ServerStats
+	}{
+		{[]ServerOption{WithMaxConns(2)}, 2, ServerStats{Accepted: 2, Active: 2, Rejected: 1, RejectedByMaxConns: 1}},
+		{[]ServerOption{WithMaxConnsPerIP(1)}, 1, ServerStats{Accepted: 1, Active: 1, Rejected: 2, RejectedByMaxConnsPerIP: 2}},
+		{[]ServerOption{WithAcceptRate(0.001, 2)}, 2, ServerStats{Accepted: 2, Active: 2, Rejected: 1, RejectedByRate: 1}},
+		{[]ServerOption{WithDeny(loopback...)}, 0, ServerStats{Rejected: 3, RejectedByFilter: 3}},
+		{[]ServerOption{WithAllow(other...)}, 0, ServerStats{Rejected: 3, RejectedByFilter: 3}},
+		{[]ServerOption{WithAllow(loopback...)}, 3, ServerStats{Accepted: 3, Active: 3}},
+	} {
+		quit := make(chan struct{})
+		server, err := ListenAndServeTCP("127.0.0.1:0", func(conn net.Conn) {
+			conn.Write([]byte("x"))
+			<-quit
+			conn.Close()
+		}, true, ts.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conns []net.Conn
+		accepted := 0
+		for j := 0; j < 3; j++ {
+			conn, err := net.Dial("tcp", server.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// accepted connections receive x, rejected ones are closed
+			buf := make([]byte, 1)
+			if n, _ := conn.Read(buf); n == 1 {
+				accepted++
+			}
+			conns = append(conns, conn)
+		}
+		if accepted != ts.accepted {
+			t.Errorf("%dth: want %d connections accepted, but got %d", i, ts.accepted, accepted)
+		}
+		if stats := server.Stats(); stats != ts.stats {
+			t.Errorf("%dth: want stats %+v, but got %+v", i, ts.stats, stats)
+		}
+		close(quit)
+		server.Shutdown(context.Background())
+		for _, conn := range conns {
+			conn.Close()
+		}
+		if stats := server.Stats(); stats.Active != 0 {
+			t.Errorf("%dth: want no active connections, but got %d", i, stats.Active)
+		}
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	// IPv6 addresses are supported by TCP servers with or without TLS
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Log("IPv6 not available")
+	} else {
+		ln.Close()
+		for i, opts := range [][]ServerOption{nil, {WithCertificates(tls.Certificate{})}} {
+			server, err := ListenAndServeTCP("[::1]:0", func(net.Conn) {}, true, opts...)
+			if err != nil {
+				t.Errorf("%dth: listen IPv6 error: %v", i, err)
+				continue
+			}
+			server.Close()
+		}
+	}
+
+	if _, err := ListenAndServeWebsocket("127.0.0.1:0", "/", func(net.Conn) {}, true, WithCertificates(tls.Certificate{})); err != errWebsocketTLS {
+		t.Errorf("want error of certificates of websocket server, but got %v", err)
+	}
+}
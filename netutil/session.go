@@ -1,11 +1,20 @@
 package netutil
 
 import (
+	"context"
+	"errors"
 	"net"
 	"sync/atomic"
 	"time"
 )
 
+var (
+	ErrSessionClosed = errors.New("session closed")
+	ErrSendTimeout   = errors.New("send timeout")
+	ErrPacketDropped = errors.New("packet dropped")
+	ErrSlowConsumer  = errors.New("slow consumer disconnected")
+)
+
 type Packet interface {
 	Len() int
 	Bytes() []byte
@@ -19,7 +28,8 @@ func (p BytesPacket) Bytes() []byte { return []byte(p) }
 type Session interface {
 	Id() string
 	Closed() bool
-	Send(Packet)
+	Send(Packet) error
+	Stats() SessionStats
 	Run(onNewSession, onQuitSession func())
 	Quit()
 }
@@ -28,31 +38,144 @@ type nullSession struct{}
 
 var NullSession = nullSession{}
 
-func (session nullSession) Id() string         { return "" }
-func (session nullSession) Send(Packet)        {}
-func (session nullSession) Run(func(), func()) {}
-func (session nullSession) Quit()              {}
+func (session nullSession) Id() string          { return "" }
+func (session nullSession) Closed() bool        { return true }
+func (session nullSession) Send(Packet) error   { return nil }
+func (session nullSession) Stats() SessionStats { return SessionStats{} }
+func (session nullSession) Run(func(), func())  {}
+func (session nullSession) Quit()               {}
+
+// OverflowPolicy decides what Send does if queue of session is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks until queue has room, or returns ErrSendTimeout
+	// after timeout set by WithSendTimeout
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops packet being sent and returns ErrPacketDropped
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued packet to make room
+	OverflowDropOldest
+	// OverflowDisconnect quits session and returns ErrSlowConsumer
+	OverflowDisconnect
+)
+
+func (policy OverflowPolicy) String() string {
+	switch policy {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDisconnect:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// SessionStats holds counters of session
+type SessionStats struct {
+	Queued   int   // packets in queue
+	Capacity int   // capacity of queue
+	Sent     int64 // packets written
+	Dropped  int64 // packets dropped by overflow policy
+	Timeouts int64 // sends timed out
+
+	// heartbeat, see WithHeartbeat
+	LastRecv     time.Time     // time of the last packet received
+	RTT          time.Duration // round-trip time of the last pong
+	SmoothedRTT  time.Duration // smoothed round-trip time
+	Pings        int64         // pings sent
+	Pongs        int64         // pongs received
+	IdleTimedOut bool          // session quit for idle timeout
+}
+
+// SessionOption represents a function for setting options of sessions
+type SessionOption func(*WSession)
+
+// WithPacketWriter returns an option which writes packets by writer, e.g. a
+// PacketWriter created by NewPacketWriter frames packets same as PacketReader.
+// Packets are written without framing by default.
+func WithPacketWriter(writer PacketWriter) SessionOption {
+	return func(ws *WSession) {
+		ws.writer = writer
+	}
+}
+
+// WithOverflowPolicy returns an option which sets policy of Send if queue is
+// full, default is OverflowBlock
+func WithOverflowPolicy(policy OverflowPolicy) SessionOption {
+	return func(ws *WSession) {
+		ws.policy = policy
+	}
+}
+
+// WithSendTimeout returns an option which sets timeout of Send blocked by
+// OverflowBlock, zero means no timeout
+func WithSendTimeout(d time.Duration) SessionOption {
+	return func(ws *WSession) {
+		ws.sendTimeout = d
+	}
+}
+
+// WithFlushTimeout returns an option which sets timeout of writing packets
+// queued before session quit, default is 5 seconds
+func WithFlushTimeout(d time.Duration) SessionOption {
+	return func(ws *WSession) {
+		ws.flushTimeout = d
+	}
+}
+
+// maxWriteBatch is max number of queued packets written at once
+const maxWriteBatch = 64
 
 // Write-only Session
 type WSession struct {
 	conn   net.Conn
 	id     string
 	closed int32
-
-	writeQuit chan struct{}
+	writer PacketWriter
+
+	policy       OverflowPolicy
+	sendTimeout  time.Duration
+	flushTimeout time.Duration
+	sent         int64
+	dropped      int64
+	timeouts     int64
+
+	heartbeat    Heartbeat
+	lastRecv     int64 // unix nanoseconds
+	pingSent     int64 // unix nanoseconds of the outstanding ping
+	rtt          int64
+	srtt         int64
+	pings        int64
+	pongs        int64
+	idleTimedOut int32
+
+	ctx       context.Context // done after session quit
+	cancel    context.CancelFunc
 	writeChan chan Packet
 }
 
-func NewWSession(id string, conn net.Conn, conWriteSize int) *WSession {
+func NewWSession(id string, conn net.Conn, conWriteSize int, opts ...SessionOption) *WSession {
 	if conWriteSize <= 0 {
 		conWriteSize = 64
 	}
-	return &WSession{
-		conn:      conn,
-		id:        id,
-		writeQuit: make(chan struct{}),
-		writeChan: make(chan Packet, conWriteSize),
+	ws := &WSession{
+		conn:         conn,
+		id:           id,
+		flushTimeout: 5 * time.Second,
+		writeChan:    make(chan Packet, conWriteSize),
+	}
+	ws.ctx, ws.cancel = context.WithCancel(context.Background())
+	for _, o := range opts {
+		o(ws)
 	}
+	if ws.writer == nil {
+		ws.writer = newRawPacketWriter(conn)
+	}
+	return ws
 }
 
 func (ws *WSession) Id() string      { return ws.id }
@@ -60,43 +183,142 @@ func (ws *WSession) Closed() bool    { return ws.getClosed() }
 func (ws *WSession) setClosed()      { atomic.StoreInt32(&ws.closed, 1) }
 func (ws *WSession) getClosed() bool { return atomic.LoadInt32(&ws.closed) == 1 }
 
-func (ws *WSession) Send(p Packet) {
-	if p.Len() > 0 && !ws.getClosed() {
-		ws.writeChan <- p
+// Send queues p to be written, behavior of full queue is decided by overflow
+// policy. ErrSessionClosed returned if session closed, and error of framing
+// returned if p is too long or can't be framed by writer of session.
+func (ws *WSession) Send(p Packet) error {
+	if ws.getClosed() {
+		return ErrSessionClosed
+	}
+	if p.Len() == 0 {
+		return nil
+	}
+	if c, ok := ws.writer.(packetChecker); ok {
+		if err := c.checkPacket(p); err != nil {
+			return err
+		}
+	}
+	select {
+	case ws.writeChan <- p:
+		return nil
+	default:
+	}
+	switch ws.policy {
+	case OverflowDropNewest:
+		atomic.AddInt64(&ws.dropped, 1)
+		return ErrPacketDropped
+	case OverflowDropOldest:
+		for {
+			select {
+			case ws.writeChan <- p:
+				return nil
+			default:
+			}
+			select {
+			case <-ws.writeChan:
+				atomic.AddInt64(&ws.dropped, 1)
+			default:
+			}
+		}
+	case OverflowDisconnect:
+		atomic.AddInt64(&ws.dropped, 1)
+		ws.Quit()
+		return ErrSlowConsumer
+	}
+	var timeout <-chan time.Time
+	if ws.sendTimeout > 0 {
+		timer := time.NewTimer(ws.sendTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case ws.writeChan <- p:
+		return nil
+	case <-ws.ctx.Done():
+		return ErrSessionClosed
+	case <-timeout:
+		atomic.AddInt64(&ws.timeouts, 1)
+		return ErrSendTimeout
+	}
+}
+
+// Stats returns counters of session
+func (ws *WSession) Stats() SessionStats {
+	stats := SessionStats{
+		Queued:       len(ws.writeChan),
+		Capacity:     cap(ws.writeChan),
+		Sent:         atomic.LoadInt64(&ws.sent),
+		Dropped:      atomic.LoadInt64(&ws.dropped),
+		Timeouts:     atomic.LoadInt64(&ws.timeouts),
+		RTT:          time.Duration(atomic.LoadInt64(&ws.rtt)),
+		SmoothedRTT:  time.Duration(atomic.LoadInt64(&ws.srtt)),
+		Pings:        atomic.LoadInt64(&ws.pings),
+		Pongs:        atomic.LoadInt64(&ws.pongs),
+		IdleTimedOut: atomic.LoadInt32(&ws.idleTimedOut) == 1,
+	}
+	if t := atomic.LoadInt64(&ws.lastRecv); t > 0 {
+		stats.LastRecv = time.Unix(0, t)
 	}
+	return stats
 }
 
+// Context returns context of session which is done after session quit
+func (ws *WSession) Context() context.Context { return ws.ctx }
+
 func (ws *WSession) startWriteLoop(startWrite, endWrite chan<- struct{}) {
 	startWrite <- struct{}{}
-	remain := 0
-	for {
-		if ws.getClosed() {
-			remain = len(ws.writeChan)
-			break
-		}
+	batch := make([]Packet, 0, maxWriteBatch)
+	for quit := false; !quit; {
 		select {
+		case <-ws.ctx.Done():
+			quit = true
 		case p := <-ws.writeChan:
-			_, err := ws.conn.Write(p.Bytes())
-			if err != nil {
-				ws.setClosed()
+			// write queued packets together
+			batch = append(batch[:0], p)
+			for n := len(ws.writeChan); n > 0 && len(batch) < maxWriteBatch; n-- {
+				batch = append(batch, <-ws.writeChan)
+			}
+			if _, err := ws.writer.WritePackets(batch...); err != nil {
+				ws.Quit()
+				quit = true
+			} else {
+				atomic.AddInt64(&ws.sent, int64(len(batch)))
 			}
-		case <-time.After(time.Second):
 		}
 	}
+	ws.flush(batch[:0])
+	ws.conn.Close()
+	endWrite <- struct{}{}
+}
 
-	for i := 0; i < remain; i++ {
-		p := <-ws.writeChan
-		_, err := ws.conn.Write(p.Bytes())
-		if err != nil {
-			break
+// flush writes packets queued before session quit until flush timeout
+func (ws *WSession) flush(batch []Packet) {
+	remain := len(ws.writeChan)
+	if remain == 0 {
+		return
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(ws.flushTimeout))
+	for remain > 0 {
+		batch = batch[:0]
+		for ; remain > 0 && len(batch) < maxWriteBatch; remain-- {
+			batch = append(batch, <-ws.writeChan)
+		}
+		if _, err := ws.writer.WritePackets(batch...); err != nil {
+			return
 		}
+		atomic.AddInt64(&ws.sent, int64(len(batch)))
 	}
-
-	ws.conn.Close()
-	endWrite <- struct{}{}
 }
 
+// Run runs session until Quit called or writing failed
 func (ws *WSession) Run(onNewSession, onQuitSession func()) {
+	ws.RunContext(context.Background(), onNewSession, onQuitSession)
+}
+
+// RunContext is same as Run, but session quits after ctx done too
+func (ws *WSession) RunContext(ctx context.Context, onNewSession, onQuitSession func()) {
+	stop := ws.quitOnDone(ctx)
+	defer stop()
 	startWrite := make(chan struct{})
 	endWrite := make(chan struct{})
 
@@ -118,8 +340,30 @@ func (ws *WSession) Run(onNewSession, onQuitSession func()) {
 	}
 }
 
+// quitOnDone quits session after ctx done, returned stop function must be
+// called after session ended
+func (ws *WSession) quitOnDone(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.Quit()
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// Quit quits session, both reading and writing loops are interrupted
+// immediately and packets queued are flushed before connection closed
 func (ws *WSession) Quit() {
 	ws.setClosed()
+	ws.cancel()
+	// interrupt blocked reading, connection is closed after flushing
+	ws.conn.SetReadDeadline(time.Now())
 }
 
 // Readable and Writable Session
@@ -132,29 +376,42 @@ func NewRWSession(
 	id string,
 	conWriteSize int,
 	packetReader PacketReader,
+	opts ...SessionOption,
 ) *RWSession {
 	s := new(RWSession)
 	conn := packetReader.Conn()
-	s.WSession = NewWSession(id, conn, conWriteSize)
+	s.WSession = NewWSession(id, conn, conWriteSize, opts...)
 	s.packetReader = packetReader
+	if hb := s.heartbeat; hb.IsPong != nil {
+		if r, ok := packetReader.(pongInterceptor); ok {
+			r.interceptPong(hb.IsPong, s.onPong)
+		}
+	}
 	return s
 }
 
 func (s *RWSession) startReadLoop(startRead, endRead chan<- struct{}) {
 	startRead <- struct{}{}
-	for {
-		_, err := s.packetReader.ReadPacket()
-		if err != nil {
-			s.setClosed()
-		}
-		if s.getClosed() {
-			break
+	for !s.getClosed() {
+		if _, err := s.packetReader.ReadPacket(); err != nil {
+			s.Quit()
+		} else {
+			s.received(time.Now())
 		}
 	}
 	endRead <- struct{}{}
 }
 
+// Run runs session until Quit called, reading or writing failed, or session
+// is idle for IdleTimeout of heartbeat
 func (s *RWSession) Run(onNewSession, onQuitSession func()) {
+	s.RunContext(context.Background(), onNewSession, onQuitSession)
+}
+
+// RunContext is same as Run, but session quits after ctx done too
+func (s *RWSession) RunContext(ctx context.Context, onNewSession, onQuitSession func()) {
+	stop := s.quitOnDone(ctx)
+	defer stop()
 	startRead := make(chan struct{})
 	startWrite := make(chan struct{})
 	endRead := make(chan struct{})
@@ -162,6 +419,7 @@ func (s *RWSession) Run(onNewSession, onQuitSession func()) {
 
 	go s.startReadLoop(startRead, endRead)
 	go s.startWriteLoop(startWrite, endWrite)
+	go s.startHeartbeatLoop()
 
 	<-startRead
 	<-startWrite
@@ -0,0 +1,133 @@
+package netutil
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks writing until released
+type blockingWriter struct {
+	conn     net.Conn
+	started  chan struct{}
+	release  chan struct{}
+	mu       sync.Mutex
+	received []string
+}
+
+func (w *blockingWriter) Conn() net.Conn           { return w.conn }
+func (w *blockingWriter) SetTimeout(time.Duration) {}
+
+func (w *blockingWriter) WritePackets(packets ...Packet) (int64, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range packets {
+		w.received = append(w.received, string(p.Bytes()))
+	}
+	return 0, nil
+}
+
+func TestSessionOverflow(t *testing.T) {
+	for i, ts := range []struct {
+		policy   OverflowPolicy
+		err      error
+		received string
+		stats    SessionStats
+	}{
+		{OverflowBlock, ErrSendTimeout, "p0,p1,p2", SessionStats{Capacity: 2, Sent: 3, Timeouts: 1}},
+		{OverflowDropNewest, ErrPacketDropped, "p0,p1,p2", SessionStats{Capacity: 2, Sent: 3, Dropped: 1}},
+		{OverflowDropOldest, nil, "p0,p2,p3", SessionStats{Capacity: 2, Sent: 3, Dropped: 1}},
+		{OverflowDisconnect, ErrSlowConsumer, "p0,p1,p2", SessionStats{Capacity: 2, Sent: 3, Dropped: 1}},
+	} {
+		client, server := net.Pipe()
+		writer := &blockingWriter{conn: server, started: make(chan struct{}, 1), release: make(chan struct{})}
+		session := NewWSession("test", server, 2,
+			WithPacketWriter(writer),
+			WithOverflowPolicy(ts.policy),
+			WithSendTimeout(10*time.Millisecond),
+		)
+		done := make(chan struct{})
+		go func() {
+			session.Run(nil, nil)
+			close(done)
+		}()
+		// p0 is being written, p1 and p2 fill the queue
+		session.Send(BytesPacket("p0"))
+		<-writer.started
+		for _, p := range []string{"p1", "p2"} {
+			if err := session.Send(BytesPacket(p)); err != nil {
+				t.Fatalf("%dth: send %s error: %v", i, p, err)
+			}
+		}
+		if stats := session.Stats(); stats.Queued != 2 {
+			t.Errorf("%dth: want 2 packets queued, but got %d", i, stats.Queued)
+		}
+		if err := session.Send(BytesPacket("p3")); err != ts.err {
+			t.Errorf("%dth: want error %v, but got %v", i, ts.err, err)
+		}
+		session.Quit()
+		close(writer.release)
+		<-done
+		if got := strings.Join(writer.received, ","); got != ts.received {
+			t.Errorf("%dth: want packets %s written, but got %s", i, ts.received, got)
+		}
+		if stats := session.Stats(); stats != ts.stats {
+			t.Errorf("%dth: want stats %+v, but got %+v", i, ts.stats, stats)
+		}
+		if err := session.Send(BytesPacket("p4")); err != ErrSessionClosed {
+			t.Errorf("%dth: want ErrSessionClosed, but got %v", i, err)
+		}
+		client.Close()
+	}
+}
+
+func TestSessionQuit(t *testing.T) {
+	for i, cancel := range []bool{false, true} {
+		client, server := net.Pipe()
+		reader := NewPacketReader(server, func([]byte) {})
+		session := NewRWSession("test", 8, reader, WithPacketWriter(NewPacketWriter(server)))
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		quit := make(chan struct{})
+		go session.RunContext(ctx, nil, func() { close(quit) })
+
+		// packets queued but not read by client yet
+		session.Send(BytesPacket("a"))
+		session.Send(BytesPacket("b"))
+		received := make(chan string, 1)
+		go func() {
+			data, _ := ioutil.ReadAll(client)
+			received <- string(data)
+		}()
+		start := time.Now()
+		if cancel {
+			cancelFunc()
+		} else {
+			session.Quit()
+		}
+		select {
+		case <-quit:
+		case <-time.After(time.Second):
+			t.Fatalf("%dth: session not quit", i)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("%dth: quit takes too long: %v", i, d)
+		}
+		if data := <-received; data != "\x00\x00\x00\x01a\x00\x00\x00\x01b" {
+			t.Errorf("%dth: want queued packets flushed, but got %q", i, data)
+		}
+		if err := session.Context().Err(); err != context.Canceled {
+			t.Errorf("%dth: want context canceled, but got %v", i, err)
+		}
+		cancelFunc()
+		client.Close()
+	}
+}